@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+)
+
+// Weight of the last poll in the moving average of the new items.
+const avgNewItemsWeight = 0.3
+
+// Returns the bounds of the adaptive interval of the watcher, its own or the configured ones.
+func adaptiveBounds(watcher db.WatcherURL, cfg Config) (minInterval, maxInterval time.Duration) {
+	minInterval = cfg.AdaptiveMinInterval
+	maxInterval = cfg.AdaptiveMaxInterval
+	if watcher.MinIntervalSeconds > 0 {
+		minInterval = time.Duration(watcher.MinIntervalSeconds) * time.Second
+	}
+	if watcher.MaxIntervalSeconds > 0 {
+		maxInterval = time.Duration(watcher.MaxIntervalSeconds) * time.Second
+	}
+
+	minInterval = max(minInterval, MinInterval)
+	maxInterval = max(maxInterval, minInterval)
+
+	return minInterval, maxInterval
+}
+
+// Returns the interval after a poll which found newItems new items on the page of pageSize items.
+// A fully new page means some items were probably missed, so the interval is halved. A poll without
+// new items backs off by a quarter. The result stays within the bounds.
+func nextAdaptiveInterval(current time.Duration, newItems, pageSize int, minInterval, maxInterval time.Duration) time.Duration {
+	next := current
+	switch {
+	case pageSize > 0 && newItems >= pageSize:
+		next = current / 2
+	case newItems == 0:
+		next = current * 5 / 4
+	case pageSize > 0 && newItems*2 > pageSize:
+		next = current * 3 / 4
+	}
+
+	return min(max(next, minInterval), maxInterval)
+}
+
+// Updates the statistics of the watcher after a poll. The adaptive interval is changed only
+// for the adaptive watchers, and not after their first poll, whose items are all new.
+func updateStats(stats db.WatcherStats, watcher db.WatcherURL, cfg Config, newItems, pageSize int, now time.Time) db.WatcherStats {
+	firstPoll := stats.Polls == 0
+	if firstPoll {
+		stats.AvgNewItems = float64(newItems)
+	} else {
+		stats.AvgNewItems = avgNewItemsWeight*float64(newItems) + (1-avgNewItemsWeight)*stats.AvgNewItems
+	}
+	stats.WatcherID = watcher.ID
+	stats.LastNewItems = newItems
+	stats.Polls++
+	stats.LastPoll = now
+
+	switch {
+	case watcher.Adaptive && firstPoll:
+		// The page says nothing about the listing rate yet
+	case watcher.Adaptive:
+		minInterval, maxInterval := adaptiveBounds(watcher, cfg)
+
+		current := time.Duration(stats.IntervalSeconds) * time.Second
+		if current == 0 {
+			current = baseInterval(watcher)
+		}
+
+		stats.IntervalSeconds = int(nextAdaptiveInterval(current, newItems, pageSize, minInterval, maxInterval) / time.Second)
+	default:
+		stats.IntervalSeconds = 0
+	}
+
+	return stats
+}
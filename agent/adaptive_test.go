@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+)
+
+func TestNextAdaptiveInterval(t *testing.T) {
+	const (
+		minInterval = time.Minute
+		maxInterval = 10 * time.Minute
+	)
+
+	tests := []struct {
+		name     string
+		current  time.Duration
+		newItems int
+		pageSize int
+		want     time.Duration
+	}{
+		{
+			name:     "fully new page",
+			current:  4 * time.Minute,
+			newItems: 16,
+			pageSize: 16,
+			want:     2 * time.Minute,
+		},
+		{
+			name:     "mostly new page",
+			current:  4 * time.Minute,
+			newItems: 10,
+			pageSize: 16,
+			want:     3 * time.Minute,
+		},
+		{
+			name:     "few new items",
+			current:  4 * time.Minute,
+			newItems: 3,
+			pageSize: 16,
+			want:     4 * time.Minute,
+		},
+		{
+			name:     "nothing new",
+			current:  4 * time.Minute,
+			newItems: 0,
+			pageSize: 16,
+			want:     5 * time.Minute,
+		},
+		{
+			name:     "lower bound",
+			current:  90 * time.Second,
+			newItems: 16,
+			pageSize: 16,
+			want:     minInterval,
+		},
+		{
+			name:     "upper bound",
+			current:  9 * time.Minute,
+			newItems: 0,
+			pageSize: 16,
+			want:     maxInterval,
+		},
+		{
+			name:     "empty page",
+			current:  4 * time.Minute,
+			newItems: 0,
+			pageSize: 0,
+			want:     5 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextAdaptiveInterval(tt.current, tt.newItems, tt.pageSize, minInterval, maxInterval); got != tt.want {
+				t.Errorf("nextAdaptiveInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateStats(t *testing.T) {
+	cfg := DefaultConfig()
+	now := time.Now()
+
+	watcher := db.WatcherURL{ID: 7, IntervalSeconds: 240, Adaptive: true}
+	// The first page of a new watcher is all new items, it does not speed the watcher up
+	stats := updateStats(db.WatcherStats{}, watcher, cfg, 16, 16, now)
+	if stats.WatcherID != 7 || stats.Polls != 1 || stats.IntervalSeconds != 0 || stats.AvgNewItems != 16 {
+		t.Errorf("updateStats() after the first poll = %+v", stats)
+	}
+
+	stats = updateStats(stats, watcher, cfg, 16, 16, now)
+	if stats.Polls != 2 || stats.IntervalSeconds != 120 {
+		t.Errorf("updateStats() after the second poll = %+v", stats)
+	}
+
+	stats = updateStats(stats, watcher, cfg, 0, 16, now)
+	if stats.Polls != 3 || stats.IntervalSeconds != 150 || stats.LastNewItems != 0 {
+		t.Errorf("updateStats() after the third poll = %+v", stats)
+	}
+
+	watcher.Adaptive = false
+	stats = updateStats(stats, watcher, cfg, 0, 16, now)
+	if stats.IntervalSeconds != 0 {
+		t.Errorf("updateStats() of not adaptive watcher kept interval %d", stats.IntervalSeconds)
+	}
+}
@@ -1,11 +1,14 @@
 package agent
 
 import (
+	"context"
 	"log"
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/smatand/vinted_go/currency"
 	"github.com/smatand/vinted_go/db"
 	vintedApi "github.com/smatand/vinted_go/vintedApi"
 )
@@ -13,10 +16,68 @@ import (
 const (
 	watchersFilePath = "watchers.json"
 	itemsFilePath    = "items.json"
-	maxRandWait      = 120
+	statsFilePath    = "watcher_stats.json"
+	statusFilePath   = "item_status.json"
+	// Items bookmarked by the users, re-checked like the notified ones.
+	favouritesFilePath = "favourites.json"
+	// Polling of the watchers without own interval, 120 to 240 seconds.
+	defaultInterval = 180 * time.Second
+	defaultJitter   = 60 * time.Second
+	// The watchers are never polled more often, whatever the user sets.
+	MinInterval = 30 * time.Second
 )
 
+// Configuration of the agent's scheduler.
+type Config struct {
+	// Number of watchers polled at the same time.
+	Workers int
+	// Minimal gap between two requests to the same Vinted host, a random jitter of the same length is added.
+	HostInterval time.Duration
+	// How often the watchers file is checked for added, edited and removed watchers.
+	ReloadInterval time.Duration
+	// Bounds of the adaptive interval for the watchers without own bounds.
+	AdaptiveMinInterval time.Duration
+	AdaptiveMaxInterval time.Duration
+	// URL the exchange rates are refreshed from, e.g. https://api.frankfurter.app/latest. The stored
+	// or built-in rates are used if empty.
+	RatesSource          string
+	RatesRefreshInterval time.Duration
+	// How often the notified items are checked for being sold, reserved or removed, and for how long
+	// after they were notified.
+	RecheckInterval time.Duration
+	RecheckWindow   time.Duration
+	// Maximal number of bits, 1 to 64, the photo hashes of a repost and the original item differ in,
+	// and for how long the reposts of a notified item are recognized.
+	RepostDistance int
+	RepostWindow   time.Duration
+}
+
+// Returns the configuration used when a field of the Config is not set.
+func DefaultConfig() Config {
+	return Config{
+		Workers:        4,
+		HostInterval:   5 * time.Second,
+		ReloadInterval: 15 * time.Second,
+
+		AdaptiveMinInterval: time.Minute,
+		AdaptiveMaxInterval: 15 * time.Minute,
+
+		RatesRefreshInterval: 12 * time.Hour,
+
+		RecheckInterval: 10 * time.Minute,
+		RecheckWindow:   48 * time.Hour,
+
+		RepostDistance: 8,
+		RepostWindow:   7 * 24 * time.Hour,
+	}
+}
+
 func itemContainsCurrency(item vintedApi.VintedItemResp, currencies []string) bool {
+	// No currencies chosen, all sellers are welcome
+	if len(currencies) == 0 {
+		return true
+	}
+
 	itemCurrency := item.Conversion.SellerCurrency
 	// If the item's currency is empty, probably it is from same country as user
 	if itemCurrency == "" {
@@ -32,59 +93,180 @@ func itemContainsCurrency(item vintedApi.VintedItemResp, currencies []string) bo
 	return false
 }
 
-func Run(newItemsChan chan<- []vintedApi.VintedItemResp) {
-	for {
-		watcher, err := db.ReadWatchers(watchersFilePath)
-		if err != nil {
-			log.Fatalf("error while getting urls to watch: %v", err)
-		}
+// Returns the interval of the watcher without the jitter, its own or the default one.
+func baseInterval(watcher db.WatcherURL) time.Duration {
+	if watcher.IntervalSeconds > 0 {
+		return time.Duration(watcher.IntervalSeconds) * time.Second
+	}
 
-		if watcher == nil {
-			log.Println("no watcher to watch")
-		}
+	return defaultInterval
+}
 
-		// Parse user given url and then fethc item from the parsed API url
-		for _, url := range watcher {
-			items, err := vintedApi.GetVintedItems(url.URL)
-			if err != nil {
-				log.Printf("error while getting items: %v", err)
+// Returns the random time between two polls of the watcher, its interval plus or minus its jitter.
+// The adaptive interval, if not 0, replaces the watcher's interval.
+func pollInterval(watcher db.WatcherURL, adaptive time.Duration) time.Duration {
+	interval := baseInterval(watcher)
+	jitter := defaultJitter
+	// The own jitter applies to the default interval as well
+	if watcher.IntervalSeconds > 0 || watcher.JitterSeconds > 0 {
+		jitter = time.Duration(watcher.JitterSeconds) * time.Second
+	}
 
-				break
-			}
+	if adaptive > 0 {
+		interval = adaptive
+		jitter = time.Duration(watcher.JitterSeconds) * time.Second
+		if jitter == 0 {
+			jitter = adaptive / 6
+		}
+	}
 
-			var itemIDs []db.ItemID
-			var uniqueItems []vintedApi.VintedItemResp
-			for _, item := range items.Items {
-				itemID := db.ItemID{Id: item.ID}
+	if jitter > 0 {
+		interval += time.Duration(rand.Int63n(int64(2*jitter))) - jitter
+	}
 
-				// The item was already added to the db, skip
-				if db.ItemExists(itemID) {
-					continue
-				}
+	return max(interval, MinInterval)
+}
 
-				itemIDs = append(itemIDs, itemID)
+// Waits for the duration d or until the ctx is cancelled. Returns false if the ctx was cancelled.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-				// The item is sold by other seller's nationality than the user wants, skip
-				// But keep the record of it so it won't have to be processed later again
-				if !itemContainsCurrency(item, url.SellerCurrency) {
-					continue
-				}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
 
-				uniqueItems = append(uniqueItems, item)
-			}
-			db.AppendItemIDs(itemsFilePath, itemIDs)
+// Watches the stored watchers and publishes the events about their items.
+type Agent struct {
+	cfg       Config
+	scheduler *scheduler
+	bus       eventBus
 
-			// Pass the details of items to discordBot
-			newItemsChan <- uniqueItems
+	rates         *currency.Table
+	ratesFilePath string
+}
 
-			// To prevent API overload
-			randomWait := time.Duration(rand.Intn(10)+1) * time.Second
+// Creates the agent, the unset fields of cfg are taken from DefaultConfig.
+func New(cfg Config) *Agent {
+	defaults := DefaultConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.HostInterval <= 0 {
+		cfg.HostInterval = defaults.HostInterval
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = defaults.ReloadInterval
+	}
+	if cfg.AdaptiveMinInterval <= 0 {
+		cfg.AdaptiveMinInterval = defaults.AdaptiveMinInterval
+	}
+	if cfg.AdaptiveMaxInterval <= 0 {
+		cfg.AdaptiveMaxInterval = defaults.AdaptiveMaxInterval
+	}
+	if cfg.RatesRefreshInterval <= 0 {
+		cfg.RatesRefreshInterval = defaults.RatesRefreshInterval
+	}
+	if cfg.RecheckInterval <= 0 {
+		cfg.RecheckInterval = defaults.RecheckInterval
+	}
+	if cfg.RecheckWindow <= 0 {
+		cfg.RecheckWindow = defaults.RecheckWindow
+	}
+	if cfg.RepostDistance <= 0 {
+		cfg.RepostDistance = defaults.RepostDistance
+	}
+	if cfg.RepostWindow <= 0 {
+		cfg.RepostWindow = defaults.RepostWindow
+	}
+
+	a := &Agent{cfg: cfg, ratesFilePath: ratesFilePath}
+	a.scheduler = newScheduler(cfg, a.bus.publish)
+	a.rates = a.scheduler.rates
 
-			time.Sleep(randomWait)
+	vintedApi.OnBreakerStateChange(func(from, to string) {
+		if to == "open" {
+			// The breaker is locked during the call, do not wait for the subscribers
+			go a.bus.publish(Event{Type: EventBreakerOpened})
 		}
+	})
+
+	return a
+}
+
+// Returns a channel receiving all events of the agent, it is closed when Run returns.
+// The subscriber must keep reading the channel, a full channel blocks the agent.
+func (a *Agent) Subscribe(buffer int) <-chan Event {
+	return a.bus.subscribe(buffer)
+}
+
+// Polls the watchers until the ctx is cancelled. Every watcher is polled on its own timer by a pool
+// of workers. The watchers being processed are always finished, so their items are not lost after
+// they are marked as seen. The channels of the subscribers are closed on return, when nothing of
+// the agent writes anymore.
+func (a *Agent) Run(ctx context.Context) {
+	defer a.bus.close()
+
+	// The stored rates are loaded before the first poll
+	rates, ok, err := db.ReadRates(a.ratesFilePath)
+	if err != nil {
+		log.Printf("error loading the exchange rates, using the built-in ones: %v", err)
+	}
+	if ok {
+		a.rates.Set(rates)
+	}
+	// The recheck publishes events too, it must stop before the subscribers are closed, and the
+	// refresh stores the rates, it must stop before the files are flushed
+	var wg sync.WaitGroup
+	if a.cfg.RatesSource != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.refreshRates(ctx, a.cfg.RatesSource, a.cfg.RatesRefreshInterval)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.scheduler.recheckItems(ctx)
+	}()
+
+	a.scheduler.run(ctx)
+	wg.Wait()
+
+	log.Println("agent stopped")
+}
+
+// Starts checking the status and the price of the item notified by the watcher, e.g. when the
+// watcher starts tracking its price after it was notified.
+func (a *Agent) TrackItem(watcher db.WatcherURL, id int) {
+	a.scheduler.trackItem(watcher, vintedApi.VintedItemResp{ID: id})
+}
 
-		// And again, another wait
-		randomInterval := time.Duration(rand.Intn(maxRandWait)+maxRandWait) * time.Second
-		time.Sleep(randomInterval)
+// Returns the time the watcher with the given id is polled next, ok is false if it is not scheduled (yet).
+func (a *Agent) NextPoll(id int) (next time.Time, ok bool) {
+	return a.scheduler.nextPoll(id)
+}
+
+// Fetches the detail of the item from the host of the watcher, ahead of the polls waiting for the host.
+func (a *Agent) ItemDetail(ctx context.Context, watcher db.WatcherURL, id int) (*vintedApi.VintedItemDetail, error) {
+	if err := a.scheduler.limiter.wait(ctx, hostOf(watcher.URL), db.PriorityHigh); err != nil {
+		return nil, err
 	}
+
+	return a.scheduler.fetchItem(ctx, watcher.URL, id)
+}
+
+// Returns the exchange rates the prices are converted with.
+func (a *Agent) Rates() *currency.Table {
+	return a.rates
+}
+
+// Returns the polling statistics of the watcher with the given id, ok is false if it was not polled yet.
+func (a *Agent) Stats(id int) (stats db.WatcherStats, ok bool) {
+	return a.scheduler.stats(id)
 }
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// A country the sellers on Vinted come from.
+type Country struct {
+	Code string
+	Name string
+}
+
+// Countries usable in db.WatcherURL.Countries, the nearby markets first.
+var Countries = []Country{
+	{"SK", "Slovakia"}, {"CZ", "Czechia"}, {"PL", "Poland"}, {"HU", "Hungary"}, {"AT", "Austria"},
+	{"DE", "Germany"}, {"FR", "France"}, {"IT", "Italy"}, {"ES", "Spain"}, {"PT", "Portugal"},
+	{"BE", "Belgium"}, {"NL", "Netherlands"}, {"LU", "Luxembourg"}, {"LT", "Lithuania"}, {"LV", "Latvia"},
+	{"EE", "Estonia"}, {"FI", "Finland"}, {"SE", "Sweden"}, {"DK", "Denmark"}, {"IE", "Ireland"},
+	{"GR", "Greece"}, {"HR", "Croatia"}, {"RO", "Romania"}, {"SI", "Slovenia"}, {"GB", "United Kingdom"},
+}
+
+// The currencies used by a single country on Vinted. EUR says nothing about the country.
+var currencyCountries = map[string]string{
+	"CZK": "CZ",
+	"PLN": "PL",
+	"HUF": "HU",
+	"RON": "RO",
+	"SEK": "SE",
+	"DKK": "DK",
+	"GBP": "GB",
+}
+
+// Reports whether the code is one of Countries.
+func ValidCountry(code string) bool {
+	return slices.ContainsFunc(Countries, func(c Country) bool { return c.Code == code })
+}
+
+// Splits the list of country codes separated by commas or spaces, e.g. "sk, cz".
+// Returns the first unknown code if any.
+func ParseCountries(list string) ([]string, string) {
+	var codes []string
+	for _, code := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		code = strings.ToUpper(code)
+		if !ValidCountry(code) {
+			return nil, code
+		}
+		if !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+
+	return codes, ""
+}
+
+// Reports whether the seller of the item comes from one of the countries of the watcher. The country
+// is taken from the seller profile, or from the seller currency if the profile is not available.
+// The sellers of unknown country are let through.
+func (s *scheduler) sellerCountryAllowed(ctx context.Context, watcher db.WatcherURL, item vintedApi.VintedItemResp) bool {
+	if len(watcher.Countries) == 0 {
+		return itemContainsCurrency(item, watcher.SellerCurrency)
+	}
+
+	country := item.User.Country()
+	if country == "" {
+		if profile, ok := s.sellerProfile(ctx, watcher, item.User); ok {
+			country = profile.country
+		}
+	}
+	if country == "" {
+		country = currencyCountries[item.Conversion.SellerCurrency]
+	}
+
+	return country == "" || slices.Contains(watcher.Countries, country)
+}
+
+// Describes the sellers the watcher accepts, e.g. "sellers from SK, CZ".
+func DescribeSellers(watcher db.WatcherURL) string {
+	switch {
+	case len(watcher.Countries) > 0:
+		return "sellers from " + strings.Join(watcher.Countries, ", ")
+	case len(watcher.SellerCurrency) > 0:
+		return "sellers paid in " + strings.Join(watcher.SellerCurrency, ", ")
+	default:
+		return "sellers from all countries"
+	}
+}
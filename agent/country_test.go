@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestParseCountries(t *testing.T) {
+	tests := []struct {
+		list        string
+		want        []string
+		wantUnknown string
+	}{
+		{list: ""},
+		{list: "sk, CZ pl,sk", want: []string{"SK", "CZ", "PL"}},
+		{list: "SK, XX", wantUnknown: "XX"},
+	}
+
+	for _, tt := range tests {
+		got, unknown := ParseCountries(tt.list)
+		if !slices.Equal(got, tt.want) || unknown != tt.wantUnknown {
+			t.Errorf("ParseCountries(%q) = %v, %q, want %v, %q", tt.list, got, unknown, tt.want, tt.wantUnknown)
+		}
+	}
+}
+
+func TestSellerCountryAllowed(t *testing.T) {
+	s := newScheduler(Config{Workers: 1}, func(Event) {})
+	s.fetchUser = func(ctx context.Context, url string, id int) (*vintedApi.VintedUser, error) {
+		switch id {
+		case 1:
+			return &vintedApi.VintedUser{ID: id, CountryISOCode: "cz"}, nil
+		case 2:
+			return &vintedApi.VintedUser{ID: id, CountryISOCode: "DE"}, nil
+		}
+		return nil, errors.New("status code: 404")
+	}
+	watcher := db.WatcherURL{URL: "https://www.vinted.sk/api/v2/catalog/items", Countries: []string{"SK", "CZ"}}
+
+	item := func(seller vintedApi.VintedUser, currency string) vintedApi.VintedItemResp {
+		return vintedApi.VintedItemResp{User: seller, Conversion: vintedApi.VintedConversion{SellerCurrency: currency}}
+	}
+
+	tests := []struct {
+		name    string
+		watcher db.WatcherURL
+		item    vintedApi.VintedItemResp
+		want    bool
+	}{
+		{name: "country in the item", watcher: watcher, item: item(vintedApi.VintedUser{ID: 9, CountryISOCode: "SK"}, ""), want: true},
+		{name: "country in the profile", watcher: watcher, item: item(vintedApi.VintedUser{ID: 1}, "EUR"), want: true},
+		{name: "other country in the profile", watcher: watcher, item: item(vintedApi.VintedUser{ID: 2}, "EUR")},
+		{name: "country from the currency", watcher: watcher, item: item(vintedApi.VintedUser{ID: 3}, "PLN")},
+		{name: "unknown country", watcher: watcher, item: item(vintedApi.VintedUser{ID: 3}, "EUR"), want: true},
+		{name: "all countries", item: item(vintedApi.VintedUser{ID: 2}, "EUR"), want: true},
+		{
+			name:    "legacy currencies",
+			watcher: db.WatcherURL{SellerCurrency: []string{"CZK"}},
+			item:    item(vintedApi.VintedUser{ID: 1}, "EUR"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.sellerCountryAllowed(context.Background(), tt.watcher, tt.item); got != tt.want {
+				t.Errorf("sellerCountryAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
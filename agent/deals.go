@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+const (
+	marketFilePath = "market.json"
+	// The samples are kept in one currency, so the watchers of different domains share the buckets.
+	marketCurrency = "EUR"
+	// The typical price is the median of the latest samples of the market.
+	maxMarketSamples = 200
+	marketWindow     = 30 * 24 * time.Hour
+	// The typical price is not known until the market has enough samples.
+	minMarketSamples = 10
+)
+
+// Returns the key of the market of all items of the watcher.
+func watcherMarket(watcher db.WatcherURL) string {
+	return "watcher:" + strconv.Itoa(watcher.ID)
+}
+
+// Returns the key of the brand, category and size market of the item, false if the item has none of them.
+func bucketMarket(item vintedApi.VintedItemResp) (string, bool) {
+	if item.BrandTitle == "" && item.CatalogID == 0 && item.SizeTitle == "" {
+		return "", false
+	}
+
+	return strings.ToLower("bucket:" + item.BrandTitle + "|" + strconv.Itoa(item.CatalogID) + "|" + item.SizeTitle), true
+}
+
+// Returns the market the deal score of the item is computed in, and what its typical price is of.
+func dealMarket(watcher db.WatcherURL, item vintedApi.VintedItemResp) (key string, basis string, ok bool) {
+	if watcher.DealBasis != db.DealBasisBucket {
+		return watcherMarket(watcher), "this search", true
+	}
+
+	key, ok = bucketMarket(item)
+	var parts []string
+	for _, part := range []string{item.BrandTitle, item.SizeTitle} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "this category")
+	}
+
+	return key, strings.Join(parts, ", "), ok
+}
+
+// Returns the median price of the samples.
+func medianPrice(samples []db.PriceSample) currency.Amount {
+	prices := make([]currency.Amount, len(samples))
+	for i, sample := range samples {
+		prices[i] = sample.Price
+	}
+	slices.Sort(prices)
+
+	middle := len(prices) / 2
+	if len(prices)%2 == 0 {
+		return (prices[middle-1] + prices[middle]) / 2
+	}
+
+	return prices[middle]
+}
+
+// Returns the deal score of the item in its market, nil if the typical price is not known yet.
+func (s *scheduler) dealOf(watcher db.WatcherURL, item vintedApi.VintedItemResp, prices itemPrices, markets map[string][]db.PriceSample) *db.Deal {
+	key, basis, ok := dealMarket(watcher, item)
+	if !ok || !prices.ok || len(markets[key]) < minMarketSamples {
+		return nil
+	}
+
+	price, ok := s.rates.Convert(prices.price, marketCurrency)
+	if !ok {
+		return nil
+	}
+
+	typical := medianPrice(markets[key])
+	if typical <= 0 {
+		return nil
+	}
+
+	score := float64(typical-price.Amount) / float64(typical) * 100
+
+	return &db.Deal{Score: int(math.Round(score)), Basis: basis}
+}
+
+// Adds the prices of the new items to the markets of the watcher and of their buckets.
+func (s *scheduler) recordMarketSamples(watcher db.WatcherURL, items []vintedApi.VintedItemResp, now time.Time) {
+	samples := make(map[string][]db.PriceSample)
+	for _, item := range items {
+		prices := s.itemPrices(watcher, item)
+		if !prices.ok {
+			continue
+		}
+		price, ok := s.rates.Convert(prices.price, marketCurrency)
+		if !ok {
+			continue
+		}
+
+		sample := db.PriceSample{Price: price.Amount, SeenAt: now}
+		samples[watcherMarket(watcher)] = append(samples[watcherMarket(watcher)], sample)
+		if key, ok := bucketMarket(item); ok {
+			samples[key] = append(samples[key], sample)
+		}
+	}
+
+	if len(samples) == 0 {
+		return
+	}
+
+	if err := db.AddMarketSamples(s.marketFilePath, samples, maxMarketSamples, now.Add(-marketWindow)); err != nil {
+		log.Printf("error saving the market prices of watcher %d: %v", watcher.ID, err)
+	}
+}
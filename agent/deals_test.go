@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestMedianPrice(t *testing.T) {
+	samples := func(prices ...currency.Amount) []db.PriceSample {
+		var result []db.PriceSample
+		for _, price := range prices {
+			result = append(result, db.PriceSample{Price: price})
+		}
+		return result
+	}
+
+	if got := medianPrice(samples(500, 100, 300)); got != 300 {
+		t.Errorf("medianPrice() of odd count = %v, want 3.00", got)
+	}
+	if got := medianPrice(samples(400, 100, 300, 200)); got != 250 {
+		t.Errorf("medianPrice() of even count = %v, want 2.50", got)
+	}
+}
+
+func TestDealOf(t *testing.T) {
+	s := newScheduler(Config{Workers: 1}, func(Event) {})
+	s.rates.Set(currency.Rates{Base: "EUR", Rates: map[string]float64{"CZK": 25}})
+	s.marketFilePath = filepath.Join(t.TempDir(), "market.json")
+
+	watcher := db.WatcherURL{ID: 1, URL: "https://www.vinted.sk/api/v2/catalog/items"}
+	item := func(id int, price string) vintedApi.VintedItemResp {
+		return vintedApi.VintedItemResp{ID: id, BrandTitle: "Nike", SizeTitle: "M", Price: vintedApi.VintedPrice{Amount: price, CurrencyCode: "EUR"}}
+	}
+
+	var seen []vintedApi.VintedItemResp
+	for i := range minMarketSamples {
+		seen = append(seen, item(i, "50.0"))
+	}
+
+	cheap := item(100, "34.0")
+	if deal := s.dealOf(watcher, cheap, s.itemPrices(watcher, cheap), nil); deal != nil {
+		t.Errorf("dealOf() without samples = %+v, want unknown", deal)
+	}
+
+	s.recordMarketSamples(watcher, seen, time.Now())
+	markets, err := db.ReadMarketSamples(s.marketFilePath)
+	if err != nil {
+		t.Fatalf("ReadMarketSamples() error = %v", err)
+	}
+
+	deal := s.dealOf(watcher, cheap, s.itemPrices(watcher, cheap), markets)
+	if deal == nil || deal.Score != 32 || deal.Basis != "this search" {
+		t.Errorf("dealOf() = %+v, want 32%% below the typical price of this search", deal)
+	}
+
+	// The samples are shared with the watchers of other domains
+	czech := db.WatcherURL{ID: 2, URL: "https://www.vinted.cz/api/v2/catalog/items", DealBasis: db.DealBasisBucket}
+	expensive := item(101, "1500")
+	expensive.Price.CurrencyCode = "CZK"
+	deal = s.dealOf(czech, expensive, s.itemPrices(czech, expensive), markets)
+	if deal == nil || deal.Score != -20 || deal.Basis != "Nike, M" {
+		t.Errorf("dealOf() in the bucket = %+v, want 20%% above the typical price of Nike, M", deal)
+	}
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// Kind of the event produced by the agent.
+type EventType string
+
+const (
+	// A new item matching the watcher was found.
+	EventNewItem EventType = "new_item"
+	// The price of a seen item went down, OldPrice holds the previous price and Price the new one.
+	EventPriceDropped EventType = "price_dropped"
+	// A notified item was sold, reserved, removed or became available again, Status holds the new
+	// status and Item only the ID, title and URL. Published for every watcher that notified the item.
+	EventItemStatusChanged EventType = "item_status_changed"
+	// Polling of the watcher failed, Err holds the reason.
+	EventWatcherError EventType = "watcher_error"
+	// The circuit breaker in front of the Vinted API opened, the requests fail until it closes.
+	EventBreakerOpened EventType = "breaker_opened"
+)
+
+// Event produced by the agent. WatcherID and Watcher are not set for EventBreakerOpened.
+type Event struct {
+	Type      EventType
+	WatcherID int
+	Watcher   db.WatcherURL
+	Time      time.Time
+
+	// Set for the item events.
+	Item   vintedApi.VintedItemResp
+	Status string
+	// Price of the item and the price including the fees in the display currency of the watcher.
+	Price      currency.Money
+	TotalPrice currency.Money
+	OldPrice   currency.Money
+	// Comparison with the typical price, nil if it is not known yet.
+	Deal *db.Deal
+	// ID of the recently notified item of the same seller the new item is a repost of, 0 if none.
+	RepostOf int
+	// Stars of the seller, 0 if they are not known.
+	SellerRating float64
+
+	Err error
+}
+
+// Delivers every published event to all subscribers.
+type eventBus struct {
+	// Held for reading during the publishing, so the channels are not closed under the hands.
+	mu          sync.RWMutex
+	subscribers []chan Event
+	closed      bool
+}
+
+// Returns a new channel receiving all events. The subscriber must keep reading it until it is closed,
+// a full channel blocks the agent.
+func (b *eventBus) subscribe(buffer int) <-chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, buffer)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+
+	b.subscribers = append(b.subscribers, ch)
+
+	return ch
+}
+
+func (b *eventBus) publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.WatcherID = event.Watcher.ID
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return
+	}
+
+	for _, ch := range b.subscribers {
+		ch <- event
+	}
+}
+
+// Closes the channels of all subscribers, the later events are dropped.
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+
+	for _, ch := range b.subscribers {
+		close(ch)
+	}
+}
@@ -0,0 +1,32 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/smatand/vinted_go/db"
+)
+
+func TestEventBusSubscribers(t *testing.T) {
+	var bus eventBus
+	first := bus.subscribe(1)
+	second := bus.subscribe(1)
+
+	bus.publish(Event{Type: EventNewItem, Watcher: db.WatcherURL{ID: 4}})
+
+	for _, ch := range []<-chan Event{first, second} {
+		got := <-ch
+		if got.Type != EventNewItem || got.WatcherID != 4 || got.Time.IsZero() {
+			t.Errorf("received %+v, want new item event of watcher 4 with time", got)
+		}
+	}
+
+	bus.close()
+	bus.publish(Event{Type: EventNewItem})
+
+	if _, open := <-first; open {
+		t.Errorf("channel of the subscriber not closed")
+	}
+	if _, open := <-bus.subscribe(1); open {
+		t.Errorf("subscription after close not closed")
+	}
+}
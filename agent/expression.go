@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"strconv"
+
+	"github.com/smatand/vinted_go/expr"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// Fields of the item available in the filter expressions.
+var ItemFields = map[string]expr.Type{
+	"id":                expr.Number,
+	"title":             expr.String,
+	"brand":             expr.String,
+	"price":             expr.Number,
+	"total_price":       expr.Number,
+	"service_fee":       expr.Number,
+	"currency":          expr.String,
+	"original_price":    expr.Number,
+	"original_currency": expr.String,
+	"seller_currency":   expr.String,
+	"condition":         expr.String,
+	"status":            expr.String,
+	"promoted":          expr.Bool,
+	"seller":            expr.String,
+	"seller_id":         expr.Number,
+	"url":               expr.String,
+	"photo":             expr.String,
+}
+
+// Returns the values of ItemFields for the item. The prices are in the display currency of the watcher,
+// the original ones in the currency of the item.
+func itemEnv(item vintedApi.VintedItemResp, prices itemPrices) map[string]any {
+	original, _ := strconv.ParseFloat(item.Price.Amount, 64)
+
+	return map[string]any{
+		"id":                item.ID,
+		"title":             item.Title,
+		"brand":             item.BrandTitle,
+		"price":             prices.price.Amount.Float64(),
+		"total_price":       prices.total.Amount.Float64(),
+		"service_fee":       prices.fee.Amount.Float64(),
+		"currency":          prices.price.Currency,
+		"original_price":    original,
+		"original_currency": item.Price.CurrencyCode,
+		"seller_currency":   item.Conversion.SellerCurrency,
+		"condition":         conditionOf(item),
+		"status":            item.Status,
+		"promoted":          item.Promoted,
+		"seller":            item.User.Login,
+		"seller_id":         item.User.ID,
+		"url":               item.Url,
+		"photo":             item.Photo.Url,
+	}
+}
@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/expr"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+const (
+	// How long the fetched seller profiles are reused.
+	sellerCacheTTL = 24 * time.Hour
+	// The expired profiles are dropped when the cache grows over this size.
+	maxCachedSellers = 10000
+)
+
+// Conditions usable in db.Filters.Conditions with their Vinted status IDs.
+var Conditions = map[string]int{
+	"new_with_tags":    6,
+	"new_without_tags": 1,
+	"very_good":        2,
+	"good":             3,
+	"satisfactory":     4,
+}
+
+// Names of the conditions on the Vinted domains, the catalog items carry only the name.
+var conditionNames = map[string][]string{
+	"new_with_tags":    {"new with tags", "nové s visačkou", "nowy z metką", "neu mit etikett"},
+	"new_without_tags": {"new without tags", "nové bez visačky", "nowy bez metki", "neu ohne etikett"},
+	"very_good":        {"very good", "veľmi dobré", "velmi dobrý", "bardzo dobry", "sehr gut"},
+	"good":             {"good", "dobré", "dobrý", "dobry", "gut"},
+	"satisfactory":     {"satisfactory", "uspokojivé", "uspokojivý", "zadowalający", "zufriedenstellend"},
+}
+
+// Checks the filters before they are saved with the watcher.
+func ValidateFilters(f db.Filters) error {
+	_, err := newItemFilter(f)
+	return err
+}
+
+// The filters of a watcher with the regular expressions compiled.
+type itemFilter struct {
+	db.Filters
+	include    *regexp.Regexp
+	exclude    *regexp.Regexp
+	expression *expr.Program
+}
+
+func newItemFilter(f db.Filters) (*itemFilter, error) {
+	filter := &itemFilter{Filters: f}
+
+	var err error
+	if f.IncludeRegex != "" {
+		if filter.include, err = regexp.Compile("(?i)" + f.IncludeRegex); err != nil {
+			return nil, fmt.Errorf("invalid include regex: %v", err)
+		}
+	}
+	if f.ExcludeRegex != "" {
+		if filter.exclude, err = regexp.Compile("(?i)" + f.ExcludeRegex); err != nil {
+			return nil, fmt.Errorf("invalid exclude regex: %v", err)
+		}
+	}
+
+	if f.Expression != "" {
+		if filter.expression, err = expr.Compile(f.Expression, ItemFields); err != nil {
+			return nil, fmt.Errorf("invalid expression: %w", err)
+		}
+	}
+
+	if f.MaxTotalPrice < 0 {
+		return nil, fmt.Errorf("max total price cannot be negative")
+	}
+	if f.MinDealScore < 0 || f.MinDealScore > 100 {
+		return nil, fmt.Errorf("minimal deal score must be between 0 and 100 percent")
+	}
+	if f.MinSellerRating < 0 || f.MinSellerRating > 5 {
+		return nil, fmt.Errorf("seller rating must be between 0 and 5 stars")
+	}
+	for _, condition := range f.Conditions {
+		if _, ok := Conditions[condition]; !ok {
+			return nil, fmt.Errorf("unknown condition %q", condition)
+		}
+	}
+
+	return filter, nil
+}
+
+// Returns the rule the item fails or "" if it passes all of them. The seller rating is looked up
+// only if needed, rating returns false if it is unknown.
+func (f *itemFilter) reject(item vintedApi.VintedItemResp, prices itemPrices, deal *db.Deal, rating func(vintedApi.VintedUser) (float64, bool)) string {
+	text := strings.ToLower(item.Title + " " + item.BrandTitle)
+
+	if len(f.IncludeKeywords) > 0 && !slices.ContainsFunc(f.IncludeKeywords, func(k string) bool {
+		return strings.Contains(text, strings.ToLower(k))
+	}) {
+		return "include keywords"
+	}
+	if slices.ContainsFunc(f.ExcludeKeywords, func(k string) bool {
+		return strings.Contains(text, strings.ToLower(k))
+	}) {
+		return "exclude keywords"
+	}
+	if f.include != nil && !f.include.MatchString(text) {
+		return "include regex"
+	}
+	if f.exclude != nil && f.exclude.MatchString(text) {
+		return "exclude regex"
+	}
+
+	if f.ExcludePromoted && item.Promoted {
+		return "promoted"
+	}
+
+	if slices.ContainsFunc(f.BlockedSellers, func(seller string) bool {
+		return seller == strconv.Itoa(item.User.ID) || strings.EqualFold(seller, item.User.Login)
+	}) {
+		return "blocked seller"
+	}
+
+	// The prices in another currency than the limit are let through, like the unknown ones
+	if f.MaxTotalPrice > 0 && prices.converted && prices.total.Amount.Float64() > f.MaxTotalPrice {
+		return "max total price"
+	}
+
+	// The unknown typical prices let the item through, like the unknown ratings
+	if f.MinDealScore > 0 && deal != nil && deal.Score < f.MinDealScore {
+		return "deal score"
+	}
+
+	if len(f.Conditions) > 0 && !slices.Contains(f.Conditions, conditionOf(item)) {
+		return "condition"
+	}
+
+	if f.expression != nil {
+		// The expression cannot be evaluated without the prices it compares, the item is not notified
+		if !prices.converted && f.expression.Uses(priceFields...) {
+			return "expression"
+		}
+		if ok, err := f.expression.Eval(itemEnv(item, prices)); err != nil || !ok {
+			return "expression"
+		}
+	}
+
+	// The unknown ratings let the item through, a failing profile lookup should not hide the items
+	if f.MinSellerRating > 0 {
+		if stars, ok := rating(item.User); ok && stars < f.MinSellerRating {
+			return "seller rating"
+		}
+	}
+
+	return ""
+}
+
+// Returns the key of the item condition in Conditions, "" if not known.
+func conditionOf(item vintedApi.VintedItemResp) string {
+	for key, id := range Conditions {
+		if item.StatusID != 0 && item.StatusID == id {
+			return key
+		}
+	}
+
+	status := strings.ToLower(strings.TrimSpace(item.Status))
+	for key, names := range conditionNames {
+		if slices.Contains(names, status) {
+			return key
+		}
+	}
+
+	return ""
+}
+
+// Caches the profiles of the sellers, they are fetched only for the watchers filtering by the seller.
+type sellerCache struct {
+	mu       sync.Mutex
+	profiles map[int]sellerProfile
+}
+
+type sellerProfile struct {
+	stars   float64
+	country string
+	fetched time.Time
+}
+
+// Returns the stars of the seller, fetching the profile if needed. Returns false if the
+// profile cannot be fetched.
+func (s *scheduler) sellerRating(ctx context.Context, watcher db.WatcherURL, seller vintedApi.VintedUser) (float64, bool) {
+	if seller.FeedbackCount > 0 {
+		return seller.FeedbackReputation * 5, true
+	}
+
+	profile, ok := s.sellerProfile(ctx, watcher, seller)
+
+	return profile.stars, ok
+}
+
+// Returns the stars of the seller if they are known without fetching the profile.
+func (s *scheduler) knownSellerRating(seller vintedApi.VintedUser) (float64, bool) {
+	if seller.FeedbackCount > 0 {
+		return seller.FeedbackReputation * 5, true
+	}
+
+	s.sellers.mu.Lock()
+	defer s.sellers.mu.Unlock()
+
+	cached, ok := s.sellers.profiles[seller.ID]
+	if !ok || time.Since(cached.fetched) >= sellerCacheTTL {
+		return 0, false
+	}
+
+	return cached.stars, true
+}
+
+// Returns the cached profile of the seller or fetches it. Returns false if it cannot be fetched.
+func (s *scheduler) sellerProfile(ctx context.Context, watcher db.WatcherURL, seller vintedApi.VintedUser) (sellerProfile, bool) {
+	s.sellers.mu.Lock()
+	cached, ok := s.sellers.profiles[seller.ID]
+	s.sellers.mu.Unlock()
+	if ok && time.Since(cached.fetched) < sellerCacheTTL {
+		return cached, true
+	}
+
+	if err := s.limiter.wait(ctx, hostOf(watcher.URL), watcher.Priority); err != nil {
+		return sellerProfile{}, false
+	}
+
+	user, err := s.fetchUser(ctx, watcher.URL, seller.ID)
+	if err != nil {
+		log.Printf("error fetching seller %d: %v", seller.ID, err)
+		return sellerProfile{}, false
+	}
+
+	profile := sellerProfile{stars: user.FeedbackReputation * 5, country: user.Country(), fetched: time.Now()}
+
+	s.sellers.mu.Lock()
+	defer s.sellers.mu.Unlock()
+
+	if len(s.sellers.profiles) >= maxCachedSellers {
+		for id, p := range s.sellers.profiles {
+			if time.Since(p.fetched) >= sellerCacheTTL {
+				delete(s.sellers.profiles, id)
+			}
+		}
+	}
+	s.sellers.profiles[seller.ID] = profile
+
+	return profile, true
+}
@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestItemFilter(t *testing.T) {
+	item := vintedApi.VintedItemResp{
+		ID:             1,
+		Title:          "Gore-Tex Jacket",
+		BrandTitle:     "Arc'teryx",
+		Price:          vintedApi.VintedPrice{Amount: "40.0"},
+		TotalItemPrice: vintedApi.VintedPrice{Amount: "42.7"},
+		Status:         "Veľmi dobré",
+		Promoted:       true,
+		User:           vintedApi.VintedUser{ID: 77, Login: "seller77"},
+	}
+
+	tests := []struct {
+		name    string
+		filters db.Filters
+		stars   float64
+		deal    *db.Deal
+		want    string
+	}{
+		{name: "no rules", filters: db.Filters{}},
+		{name: "include keyword", filters: db.Filters{IncludeKeywords: []string{"boots", "gore-tex"}}},
+		{name: "include keyword missing", filters: db.Filters{IncludeKeywords: []string{"boots"}}, want: "include keywords"},
+		{name: "exclude brand", filters: db.Filters{ExcludeKeywords: []string{"ARC'TERYX"}}, want: "exclude keywords"},
+		{name: "include regex", filters: db.Filters{IncludeRegex: `gore-?tex`}},
+		{name: "exclude regex", filters: db.Filters{ExcludeRegex: `^gore`}, want: "exclude regex"},
+		{name: "total price within", filters: db.Filters{MaxTotalPrice: 45}},
+		{name: "total price with fee above", filters: db.Filters{MaxTotalPrice: 41}, want: "max total price"},
+		{name: "condition", filters: db.Filters{Conditions: []string{"new_with_tags", "very_good"}}},
+		{name: "other condition", filters: db.Filters{Conditions: []string{"good"}}, want: "condition"},
+		{name: "promoted", filters: db.Filters{ExcludePromoted: true}, want: "promoted"},
+		{name: "blocked by login", filters: db.Filters{BlockedSellers: []string{"Seller77"}}, want: "blocked seller"},
+		{name: "blocked by id", filters: db.Filters{BlockedSellers: []string{"77"}}, want: "blocked seller"},
+		{name: "rating enough", filters: db.Filters{MinSellerRating: 4.5}, stars: 4.8},
+		{name: "rating low", filters: db.Filters{MinSellerRating: 4.5}, stars: 3, want: "seller rating"},
+		{name: "rating unknown", filters: db.Filters{MinSellerRating: 4.5}, stars: -1},
+		{name: "deal enough", filters: db.Filters{MinDealScore: 20}, deal: &db.Deal{Score: 32}},
+		{name: "deal low", filters: db.Filters{MinDealScore: 20}, deal: &db.Deal{Score: 5}, want: "deal score"},
+		{name: "deal unknown", filters: db.Filters{MinDealScore: 20}},
+	}
+
+	s := newScheduler(Config{Workers: 1}, func(Event) {})
+	prices := s.itemPrices(db.WatcherURL{URL: "https://www.vinted.sk/api/v2/catalog/items"}, item)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newItemFilter(tt.filters)
+			if err != nil {
+				t.Fatalf("newItemFilter() error = %v", err)
+			}
+
+			rating := func(vintedApi.VintedUser) (float64, bool) {
+				return tt.stars, tt.stars >= 0
+			}
+			if got := f.reject(item, prices, tt.deal, rating); got != tt.want {
+				t.Errorf("reject() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters db.Filters
+		wantErr bool
+	}{
+		{name: "valid", filters: db.Filters{IncludeRegex: `\bnike\b`, Conditions: []string{"good"}, MinSellerRating: 4}},
+		{name: "invalid regex", filters: db.Filters{ExcludeRegex: `(`}, wantErr: true},
+		{name: "unknown condition", filters: db.Filters{Conditions: []string{"mint"}}, wantErr: true},
+		{name: "rating above 5", filters: db.Filters{MinSellerRating: 6}, wantErr: true},
+		{name: "deal score above 100", filters: db.Filters{MinDealScore: 101}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFilters(tt.filters); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSellerRatingCache(t *testing.T) {
+	s := newScheduler(Config{Workers: 1}, func(Event) {})
+	fetched := 0
+	s.fetchUser = func(ctx context.Context, url string, id int) (*vintedApi.VintedUser, error) {
+		fetched++
+		if id == 2 {
+			return nil, errors.New("status code: 404")
+		}
+		return &vintedApi.VintedUser{ID: id, FeedbackReputation: 0.9, FeedbackCount: 10}, nil
+	}
+	watcher := db.WatcherURL{URL: "https://www.vinted.sk/api/v2/catalog/items"}
+
+	for range 2 {
+		if stars, ok := s.sellerRating(context.Background(), watcher, vintedApi.VintedUser{ID: 1}); !ok || stars != 4.5 {
+			t.Errorf("sellerRating() = %v, %v, want 4.5 stars", stars, ok)
+		}
+	}
+	if fetched != 1 {
+		t.Errorf("profile fetched %d times, want once", fetched)
+	}
+
+	if _, ok := s.sellerRating(context.Background(), watcher, vintedApi.VintedUser{ID: 2}); ok {
+		t.Errorf("sellerRating() of a failing profile is known")
+	}
+}
+
+func TestItemFilterExpression(t *testing.T) {
+	item := vintedApi.VintedItemResp{
+		Title:      "Gore-Tex Jacket",
+		BrandTitle: "Arc'teryx",
+		Price:      vintedApi.VintedPrice{Amount: "55.0", CurrencyCode: "EUR"},
+		Status:     "Very good",
+	}
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{expression: `title contains "gore-tex" and price < 40 or brand == "Arc'teryx"`},
+		{expression: `condition in ["new_with_tags", "very_good"] and currency == "eur"`},
+		{expression: `title contains "gore-tex" and price < 40`, want: "expression"},
+		{expression: `price / (total_price - price) > 1`, want: "expression"},
+	}
+
+	s := newScheduler(Config{Workers: 1}, func(Event) {})
+	prices := s.itemPrices(db.WatcherURL{URL: "https://www.vinted.sk/api/v2/catalog/items"}, item)
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			f, err := newItemFilter(db.Filters{Expression: tt.expression})
+			if err != nil {
+				t.Fatalf("newItemFilter() error = %v", err)
+			}
+			if got := f.reject(item, prices, nil, nil); got != tt.want {
+				t.Errorf("reject() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemFilterWithoutRate(t *testing.T) {
+	// 5000 HUF is below 45 only as a number, there is no rate to EUR
+	item := vintedApi.VintedItemResp{Title: "Gore-Tex Jacket", Price: vintedApi.VintedPrice{Amount: "5000", CurrencyCode: "HUF"}}
+
+	tests := []struct {
+		filters db.Filters
+		want    string
+	}{
+		// Let through like an unknown price
+		{filters: db.Filters{MaxTotalPrice: 45}},
+		{filters: db.Filters{Expression: `title contains "gore-tex"`}},
+		{filters: db.Filters{Expression: `price < 45`}, want: "expression"},
+		{filters: db.Filters{Expression: `price > 45`}, want: "expression"},
+	}
+
+	s := newScheduler(Config{Workers: 1}, func(Event) {})
+	s.rates.Set(currency.Rates{Base: "EUR", Rates: map[string]float64{"CZK": 25}})
+	prices := s.itemPrices(db.WatcherURL{URL: "https://www.vinted.sk/api/v2/catalog/items"}, item)
+	if prices.converted {
+		t.Fatalf("itemPrices() = %+v, want not converted", prices)
+	}
+
+	for _, tt := range tests {
+		f, err := newItemFilter(tt.filters)
+		if err != nil {
+			t.Fatalf("newItemFilter() error = %v", err)
+		}
+		if got := f.reject(item, prices, nil, nil); got != tt.want {
+			t.Errorf("reject() with %+v = %q, want %q", tt.filters, got, tt.want)
+		}
+	}
+}
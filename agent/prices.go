@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+const ratesFilePath = "rates.json"
+
+// Prices of an item in the display currency of the watcher. They stay in the currency of the item
+// if there is no rate for it, ok is false if the price of the item cannot be parsed.
+type itemPrices struct {
+	price currency.Money
+	fee   currency.Money
+	total currency.Money
+	ok    bool
+	// The prices are in the display currency, they can be compared with the limits of the filters.
+	converted bool
+}
+
+// Fields of the filter expressions holding the prices in the display currency.
+var priceFields = []string{"price", "total_price", "service_fee"}
+
+// Returns the currency the prices of the watcher are shown and filtered in, its own or the one
+// of its Vinted domain.
+func DisplayCurrency(watcher db.WatcherURL) string {
+	if watcher.Currency != "" {
+		return watcher.Currency
+	}
+
+	return currency.ForHost(hostOf(watcher.URL))
+}
+
+// Parses the prices of the item and converts them to the display currency of the watcher.
+func (s *scheduler) itemPrices(watcher db.WatcherURL, item vintedApi.VintedItemResp) itemPrices {
+	// The prices without the currency code are in the currency of the domain
+	domain := currency.ForHost(hostOf(watcher.URL))
+	price, err := currency.Parse(item.Price.Amount, priceCurrency(item.Price, item, domain))
+	if err != nil {
+		return itemPrices{}
+	}
+
+	// The fee and the total are missing in some responses
+	fee, err := currency.Parse(item.ServiceFee.Amount, priceCurrency(item.ServiceFee, item, domain))
+	if err != nil {
+		fee = currency.Money{Currency: price.Currency}
+	}
+	total, err := currency.Parse(item.TotalItemPrice.Amount, priceCurrency(item.TotalItemPrice, item, domain))
+	if err != nil || total.Currency != price.Currency {
+		total = currency.Money{Amount: price.Amount + fee.Amount, Currency: price.Currency}
+	}
+
+	prices := itemPrices{price: price, fee: fee, total: total, ok: true}
+
+	rates := s.rates.Rates()
+	to := DisplayCurrency(watcher)
+	convertedPrice, priceOK := rates.Convert(price, to)
+	convertedFee, feeOK := rates.Convert(fee, to)
+	convertedTotal, totalOK := rates.Convert(total, to)
+	if !priceOK || !feeOK || !totalOK {
+		log.Printf("no exchange rate from %s to %s, the price filters cannot compare item %d", price.Currency, to, item.ID)
+		return prices
+	}
+
+	prices.price, prices.fee, prices.total = convertedPrice, convertedFee, convertedTotal
+	prices.converted = true
+
+	return prices
+}
+
+// Returns the currency of the price, the one of the item price or the fallback if it has none.
+func priceCurrency(price vintedApi.VintedPrice, item vintedApi.VintedItemResp, fallback string) string {
+	if price.CurrencyCode != "" {
+		return price.CurrencyCode
+	}
+	if item.Price.CurrencyCode != "" {
+		return item.Price.CurrencyCode
+	}
+
+	return fallback
+}
+
+// Refreshes the rates from the source until the ctx is cancelled, the refreshed rates are stored.
+func (a *Agent) refreshRates(ctx context.Context, source string, interval time.Duration) {
+	for {
+		rates, err := currency.Fetch(ctx, source)
+		if err == nil {
+			a.rates.Set(rates)
+			if err := db.SaveRates(a.ratesFilePath, rates); err != nil {
+				log.Printf("error saving the exchange rates: %v", err)
+			}
+			log.Printf("exchange rates of %s refreshed", rates.Date)
+		} else if ctx.Err() == nil {
+			log.Printf("error refreshing the exchange rates: %v", err)
+		}
+
+		if !sleep(ctx, interval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestItemPrices(t *testing.T) {
+	s := newScheduler(Config{Workers: 1}, func(Event) {})
+	s.rates.Set(currency.Rates{Base: "EUR", Rates: map[string]float64{"CZK": 25, "PLN": 4}})
+
+	tests := []struct {
+		name      string
+		watcher   db.WatcherURL
+		item      vintedApi.VintedItemResp
+		wantPrice string
+		wantTotal string
+	}{
+		{
+			name:    "domain currency",
+			watcher: db.WatcherURL{URL: "https://www.vinted.sk/api/v2/catalog/items"},
+			item: vintedApi.VintedItemResp{
+				Price:          vintedApi.VintedPrice{Amount: "40.0"},
+				TotalItemPrice: vintedApi.VintedPrice{Amount: "42.7"},
+			},
+			wantPrice: "40.00 EUR",
+			wantTotal: "42.70 EUR",
+		},
+		{
+			name:    "converted to the watcher currency",
+			watcher: db.WatcherURL{URL: "https://www.vinted.sk/api/v2/catalog/items", Currency: "CZK"},
+			item: vintedApi.VintedItemResp{
+				Price:      vintedApi.VintedPrice{Amount: "10.0", CurrencyCode: "EUR"},
+				ServiceFee: vintedApi.VintedPrice{Amount: "1.2", CurrencyCode: "EUR"},
+			},
+			wantPrice: "250.00 CZK",
+			wantTotal: "280.00 CZK",
+		},
+		{
+			name:    "converted to the domain currency",
+			watcher: db.WatcherURL{URL: "https://www.vinted.cz/api/v2/catalog/items"},
+			item:    vintedApi.VintedItemResp{Price: vintedApi.VintedPrice{Amount: "100", CurrencyCode: "PLN"}},
+			// 100 PLN is 25 EUR
+			wantPrice: "625.00 CZK",
+			wantTotal: "625.00 CZK",
+		},
+		{
+			name:      "no rate",
+			watcher:   db.WatcherURL{URL: "https://www.vinted.sk/api/v2/catalog/items"},
+			item:      vintedApi.VintedItemResp{Price: vintedApi.VintedPrice{Amount: "5000", CurrencyCode: "HUF"}},
+			wantPrice: "5000.00 HUF",
+			wantTotal: "5000.00 HUF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.itemPrices(tt.watcher, tt.item)
+			if !got.ok || got.price.String() != tt.wantPrice || got.total.String() != tt.wantTotal || got.converted != (tt.name != "no rate") {
+				t.Errorf("itemPrices() = %+v, want price %s and total %s", got, tt.wantPrice, tt.wantTotal)
+			}
+		})
+	}
+
+	if got := s.itemPrices(db.WatcherURL{}, vintedApi.VintedItemResp{}); got.ok {
+		t.Errorf("itemPrices() of an item without price = %+v, want not ok", got)
+	}
+}
+
+func TestFetchPriceDrops(t *testing.T) {
+	price := "30.0"
+	s := newScheduler(Config{Workers: 1, HostInterval: time.Millisecond}, func(Event) {})
+	s.itemsFilePath = filepath.Join(t.TempDir(), "items.json")
+	s.marketFilePath = filepath.Join(t.TempDir(), "market.json")
+	s.fetchItems = func(ctx context.Context, url string) (*vintedApi.VintedItemsResp, error) {
+		return &vintedApi.VintedItemsResp{Items: []vintedApi.VintedItemResp{
+			{ID: 1, Price: vintedApi.VintedPrice{Amount: price, CurrencyCode: "EUR"}},
+		}}, nil
+	}
+	watcher := db.WatcherURL{URL: "https://www.vinted.sk/api/v2/catalog/items", PriceDrops: true}
+
+	fetch := func() []Event {
+		t.Helper()
+		events, _, err := s.fetch(context.Background(), watcher)
+		if err != nil {
+			t.Fatalf("fetch() error = %v", err)
+		}
+		return events
+	}
+
+	if events := fetch(); len(events) != 1 || events[0].Type != EventNewItem {
+		t.Fatalf("first fetch() = %+v, want the new item", events)
+	}
+
+	price = "35.0"
+	if events := fetch(); len(events) != 0 {
+		t.Errorf("fetch() after the price went up = %+v, want no events", events)
+	}
+
+	price = "28.0"
+	events := fetch()
+	if len(events) != 1 || events[0].Type != EventPriceDropped ||
+		events[0].OldPrice.String() != "35.00 EUR" || events[0].Price.String() != "28.00 EUR" {
+		t.Errorf("fetch() after the price drop = %+v, want drop from 35.00 to 28.00 EUR", events)
+	}
+
+	watcher.PriceDrops = false
+	price = "20.0"
+	if events := fetch(); len(events) != 0 {
+		t.Errorf("fetch() of a watcher without price drops = %+v, want no events", events)
+	}
+
+	// Tracked items report their drops anyway
+	watcher.TrackedItems = []int{1}
+	price = "18.0"
+	if events := fetch(); len(events) != 1 || events[0].Type != EventPriceDropped {
+		t.Errorf("fetch() of a tracked item = %+v, want the price drop", events)
+	}
+}
+
+func TestFetchPriceDropsOverlappingWatchers(t *testing.T) {
+	price := "30.0"
+	s := newScheduler(Config{Workers: 1, HostInterval: time.Millisecond}, func(Event) {})
+	s.itemsFilePath = filepath.Join(t.TempDir(), "items.json")
+	s.marketFilePath = filepath.Join(t.TempDir(), "market.json")
+	s.fetchItems = func(ctx context.Context, url string) (*vintedApi.VintedItemsResp, error) {
+		return &vintedApi.VintedItemsResp{Items: []vintedApi.VintedItemResp{
+			{ID: 1, Price: vintedApi.VintedPrice{Amount: price, CurrencyCode: "EUR"}},
+		}}, nil
+	}
+	url := "https://www.vinted.sk/api/v2/catalog/items"
+	quiet := db.WatcherURL{ID: 1, URL: url}
+	drops := db.WatcherURL{ID: 2, URL: url, PriceDrops: true}
+
+	fetch := func(watcher db.WatcherURL) []Event {
+		t.Helper()
+		events, _, err := s.fetch(context.Background(), watcher)
+		if err != nil {
+			t.Fatalf("fetch() error = %v", err)
+		}
+		return events
+	}
+
+	fetch(quiet)
+	fetch(drops)
+
+	// The watcher without price drops sees the change first, the other one still gets it
+	price = "25.0"
+	if events := fetch(quiet); len(events) != 0 {
+		t.Errorf("fetch() of the watcher without price drops = %+v, want no events", events)
+	}
+	events := fetch(drops)
+	if len(events) != 1 || events[0].Type != EventPriceDropped || events[0].OldPrice.String() != "30.00 EUR" {
+		t.Errorf("fetch() of the watcher with price drops = %+v, want the drop from 30.00 EUR", events)
+	}
+
+	if events := fetch(drops); len(events) != 0 {
+		t.Errorf("repeated fetch() = %+v, want the drop reported once", events)
+	}
+}
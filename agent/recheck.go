@@ -0,0 +1,233 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// Items checked in one round at most, the checks share the host limits with the polls.
+const recheckBatch = 20
+
+// Starts tracking the status and the price of the notified item, for the watchers marking the sold
+// items or tracking the price of the item.
+func (s *scheduler) trackItem(watcher db.WatcherURL, item vintedApi.VintedItemResp) {
+	err := db.TrackItem(s.statusFilePath, db.ItemStatus{
+		ItemID:     item.ID,
+		URL:        watcher.URL,
+		Title:      item.Title,
+		ItemURL:    item.Url,
+		WatcherIDs: []int{watcher.ID},
+		NotifiedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("error tracking item %d: %v", item.ID, err)
+	}
+}
+
+// Checks the status of the recently notified items every RecheckInterval until the ctx is cancelled.
+func (s *scheduler) recheckItems(ctx context.Context) {
+	for sleep(ctx, s.cfg.RecheckInterval) {
+		if err := db.PruneItemStatuses(s.statusFilePath, time.Now().Add(-s.cfg.RecheckWindow)); err != nil {
+			log.Printf("error pruning the item statuses: %v", err)
+		}
+
+		s.recheckDueItems(ctx, time.Now())
+		s.recheckFavourites(ctx, time.Now())
+	}
+}
+
+// Checks the items not checked for RecheckInterval whose status can still change.
+func (s *scheduler) recheckDueItems(ctx context.Context, now time.Time) {
+	statuses, err := db.ReadItemStatuses(s.statusFilePath)
+	if err != nil {
+		log.Printf("error reading the item statuses: %v", err)
+		return
+	}
+
+	checked := 0
+	for _, item := range statuses {
+		if checked >= recheckBatch || ctx.Err() != nil {
+			return
+		}
+		// Sold and deleted items do not come back
+		if item.Status == vintedApi.ItemSold || item.Status == vintedApi.ItemDeleted {
+			continue
+		}
+		if now.Sub(item.CheckedAt) < s.cfg.RecheckInterval {
+			continue
+		}
+
+		// The checks give way to the polls
+		if err := s.limiter.wait(ctx, hostOf(item.URL), db.PriorityLow); err != nil {
+			return
+		}
+		checked++
+
+		status := vintedApi.ItemDeleted
+		detail, err := s.fetchItem(ctx, item.URL, item.ItemID)
+		switch {
+		case errors.Is(err, vintedApi.ErrItemNotFound):
+		case err != nil:
+			log.Printf("error checking the status of item %d: %v", item.ItemID, err)
+			continue
+		default:
+			status = detail.Status()
+			s.recheckPrice(item, *detail, now)
+		}
+
+		previous, changed, err := db.RecordItemStatus(s.statusFilePath, item.ItemID, status, now)
+		if err != nil {
+			log.Printf("error recording the status of item %d: %v", item.ItemID, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		log.Printf("item %d changed from %q to %s", item.ItemID, previous, status)
+		s.publishStatus(item, status, now)
+	}
+}
+
+// Records the price of the checked item as seen by every watcher that notified it, and publishes
+// its drop for the watchers wanting the price drops or tracking the item, like the polls do. The
+// item may be gone from the search results of the watcher, so the check is the only one seeing it.
+func (s *scheduler) recheckPrice(item db.ItemStatus, detail vintedApi.VintedItemDetail, now time.Time) {
+	resp := vintedApi.VintedItemResp{ID: item.ItemID, Title: detail.Title, Url: detail.Url, Price: detail.Price}
+	if resp.Title == "" {
+		resp.Title = item.Title
+	}
+	if resp.Url == "" {
+		resp.Url = item.ItemURL
+	}
+
+	for _, watcher := range s.itemWatchers(item) {
+		domain := currency.ForHost(hostOf(watcher.URL))
+		price, err := currency.Parse(detail.Price.Amount, priceCurrency(detail.Price, resp, domain))
+		if err != nil {
+			log.Printf("error parsing the price of item %d: %v", item.ItemID, err)
+			continue
+		}
+
+		seen := []db.ItemID{{Id: item.ItemID, Prices: []db.PricePoint{{Price: price, SeenAt: now}}}}
+		_, changes, err := db.RecordItems(s.itemsFilePath, watcher.ID, seen)
+		if err != nil {
+			log.Printf("error recording the price of item %d: %v", item.ItemID, err)
+			continue
+		}
+
+		// The drops found while snoozed are seen, but not notified
+		wanted := watcher.PriceDrops || slices.Contains(watcher.TrackedItems, item.ItemID)
+		if !wanted || watcher.SnoozedUntil.After(now) {
+			continue
+		}
+		for _, change := range changes {
+			if change.New.Price.Amount >= change.Old.Price.Amount {
+				continue
+			}
+
+			prices := s.itemPrices(watcher, resp)
+			event := Event{
+				Type:       EventPriceDropped,
+				Watcher:    watcher,
+				Time:       now,
+				Item:       resp,
+				Price:      prices.price,
+				TotalPrice: prices.total,
+				OldPrice:   change.Old.Price,
+			}
+			if old, ok := s.rates.Convert(change.Old.Price, prices.price.Currency); ok {
+				event.OldPrice = old
+			}
+			log.Printf("price of item %d dropped from %s to %s", item.ItemID, change.Old.Price, change.New.Price)
+			s.publish(event)
+		}
+	}
+}
+
+// Returns the watchers that notified the item and still exist.
+func (s *scheduler) itemWatchers(item db.ItemStatus) []db.WatcherURL {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var watchers []db.WatcherURL
+	for _, id := range item.WatcherIDs {
+		if sw, ok := s.watchers[id]; ok {
+			watchers = append(watchers, sw.watcher)
+		}
+	}
+
+	return watchers
+}
+
+// Publishes the status change of the item for every watcher that notified it and still exists.
+func (s *scheduler) publishStatus(item db.ItemStatus, status string, at time.Time) {
+	for _, watcher := range s.itemWatchers(item) {
+		s.publish(Event{
+			Type:    EventItemStatusChanged,
+			Watcher: watcher,
+			Time:    at,
+			Item:    vintedApi.VintedItemResp{ID: item.ItemID, Title: item.Title, Url: item.ItemURL},
+			Status:  status,
+		})
+	}
+}
+
+// Checks the price and status of the favourites not checked for RecheckInterval, each item once for
+// all users that bookmarked it.
+func (s *scheduler) recheckFavourites(ctx context.Context, now time.Time) {
+	favourites, err := db.ReadFavourites(s.favouritesFilePath)
+	if err != nil {
+		log.Printf("error reading the favourites: %v", err)
+		return
+	}
+
+	checked := make(map[int]bool)
+	for _, favourite := range favourites {
+		if len(checked) >= recheckBatch || ctx.Err() != nil {
+			return
+		}
+		if checked[favourite.ItemID] {
+			continue
+		}
+		// Sold and deleted items do not come back
+		if favourite.Status == vintedApi.ItemSold || favourite.Status == vintedApi.ItemDeleted {
+			continue
+		}
+		if now.Sub(favourite.CheckedAt) < s.cfg.RecheckInterval {
+			continue
+		}
+
+		if err := s.limiter.wait(ctx, hostOf(favourite.URL), db.PriorityLow); err != nil {
+			return
+		}
+		checked[favourite.ItemID] = true
+
+		var price currency.Money
+		status := vintedApi.ItemDeleted
+		detail, err := s.fetchItem(ctx, favourite.URL, favourite.ItemID)
+		switch {
+		case errors.Is(err, vintedApi.ErrItemNotFound):
+			// The removed item keeps its last price
+		case err != nil:
+			log.Printf("error checking favourite item %d: %v", favourite.ItemID, err)
+			continue
+		default:
+			status = detail.Status()
+			if price, err = currency.Parse(detail.Price.Amount, detail.Price.CurrencyCode); err != nil {
+				log.Printf("error parsing the price of favourite item %d: %v", favourite.ItemID, err)
+			}
+		}
+
+		if err := db.RecordFavouriteCheck(s.favouritesFilePath, favourite.ItemID, price, status, now); err != nil {
+			log.Printf("error recording the check of favourite item %d: %v", favourite.ItemID, err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestRecheckDueItems(t *testing.T) {
+	var events []Event
+	s := newScheduler(Config{Workers: 1, HostInterval: time.Millisecond, RecheckInterval: time.Minute}, func(e Event) {
+		events = append(events, e)
+	})
+	s.statusFilePath = filepath.Join(t.TempDir(), "item_status.json")
+	s.watchers[1] = &scheduledWatcher{watcher: db.WatcherURL{ID: 1, MarkSold: true}}
+
+	details := map[int]*vintedApi.VintedItemDetail{
+		10: {ID: 10},
+		11: {ID: 11, IsReserved: true},
+	}
+	fetched := 0
+	s.fetchItem = func(ctx context.Context, url string, id int) (*vintedApi.VintedItemDetail, error) {
+		fetched++
+		if detail, ok := details[id]; ok {
+			return detail, nil
+		}
+		return nil, vintedApi.ErrItemNotFound
+	}
+
+	url := "https://www.vinted.sk/api/v2/catalog/items"
+	for _, id := range []int{10, 11, 12} {
+		s.trackItem(db.WatcherURL{ID: 1, URL: url}, vintedApi.VintedItemResp{ID: id, Title: "item"})
+	}
+	// Watcher 2 was removed since
+	s.trackItem(db.WatcherURL{ID: 2, URL: url}, vintedApi.VintedItemResp{ID: 12})
+
+	now := time.Now()
+	s.recheckDueItems(context.Background(), now)
+
+	// The available item is not a change, the reserved and deleted ones are
+	if len(events) != 2 || events[0].Item.ID != 11 || events[0].Status != vintedApi.ItemReserved ||
+		events[1].Item.ID != 12 || events[1].Status != vintedApi.ItemDeleted || events[1].Watcher.ID != 1 {
+		t.Fatalf("events after the first check = %+v", events)
+	}
+
+	// Checked recently, nothing to do
+	s.recheckDueItems(context.Background(), now.Add(time.Second))
+	if fetched != 3 {
+		t.Errorf("fetched %d item details, want 3", fetched)
+	}
+
+	details[10].IsClosed = true
+	events = nil
+	s.recheckDueItems(context.Background(), now.Add(2*time.Minute))
+	// The deleted item is not checked anymore
+	if fetched != 5 {
+		t.Errorf("fetched %d item details, want 5", fetched)
+	}
+	if len(events) != 1 || events[0].Item.ID != 10 || events[0].Status != vintedApi.ItemSold {
+		t.Errorf("events after the second check = %+v", events)
+	}
+
+	statuses, err := db.ReadItemStatuses(s.statusFilePath)
+	if err != nil {
+		t.Fatalf("ReadItemStatuses() error = %v", err)
+	}
+	if got := statuses[0].Transitions; len(got) != 2 || got[1].From != vintedApi.ItemAvailable || got[1].To != vintedApi.ItemSold {
+		t.Errorf("transitions of item 10 = %+v", got)
+	}
+}
+
+func TestRecheckFavourites(t *testing.T) {
+	s := newScheduler(Config{Workers: 1, HostInterval: time.Millisecond, RecheckInterval: time.Minute}, func(Event) {})
+	s.favouritesFilePath = filepath.Join(t.TempDir(), "favourites.json")
+
+	fetched := 0
+	s.fetchItem = func(ctx context.Context, url string, id int) (*vintedApi.VintedItemDetail, error) {
+		fetched++
+		if id == 10 {
+			return &vintedApi.VintedItemDetail{ID: 10, IsReserved: true, Price: vintedApi.VintedPrice{Amount: "25.0", CurrencyCode: "EUR"}}, nil
+		}
+		return nil, vintedApi.ErrItemNotFound
+	}
+
+	url := "https://www.vinted.sk/api/v2/catalog/items"
+	for _, f := range []db.Favourite{
+		{UserID: "u1", ItemID: 10, URL: url},
+		{UserID: "u2", ItemID: 10, URL: url},
+		{UserID: "u1", ItemID: 11, URL: url},
+	} {
+		if _, err := db.AddFavourite(s.favouritesFilePath, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	s.recheckFavourites(context.Background(), now)
+	// Item 10 is checked once for both users
+	if fetched != 2 {
+		t.Errorf("fetched %d item details, want 2", fetched)
+	}
+
+	favourites, err := db.ReadFavourites(s.favouritesFilePath)
+	if err != nil {
+		t.Fatalf("ReadFavourites() error = %v", err)
+	}
+	for _, f := range favourites {
+		switch {
+		case f.ItemID == 10 && (f.Status != vintedApi.ItemReserved || f.Price.String() != "25.00 EUR"):
+			t.Errorf("favourite item 10 = %+v, want reserved for 25.00 EUR", f)
+		case f.ItemID == 11 && f.Status != vintedApi.ItemDeleted:
+			t.Errorf("favourite item 11 = %+v, want deleted", f)
+		}
+	}
+
+	// The deleted item is not checked anymore
+	s.recheckFavourites(context.Background(), now.Add(2*time.Minute))
+	if fetched != 3 {
+		t.Errorf("fetched %d item details, want 3", fetched)
+	}
+}
+
+func TestRecheckPriceDrops(t *testing.T) {
+	var events []Event
+	s := newScheduler(Config{Workers: 1, HostInterval: time.Millisecond, RecheckInterval: time.Minute}, func(e Event) {
+		events = append(events, e)
+	})
+	dir := t.TempDir()
+	s.statusFilePath = filepath.Join(dir, "item_status.json")
+	s.itemsFilePath = filepath.Join(dir, "items.json")
+
+	url := "https://www.vinted.sk/api/v2/catalog/items"
+	tracking := db.WatcherURL{ID: 1, URL: url, TrackedItems: []int{10}}
+	other := db.WatcherURL{ID: 2, URL: url}
+	s.watchers[1] = &scheduledWatcher{watcher: tracking}
+	s.watchers[2] = &scheduledWatcher{watcher: other}
+
+	price := "30.0"
+	s.fetchItem = func(ctx context.Context, url string, id int) (*vintedApi.VintedItemDetail, error) {
+		return &vintedApi.VintedItemDetail{ID: id, Title: "Kabát", Url: "https://www.vinted.sk/items/10", Price: vintedApi.VintedPrice{Amount: price, CurrencyCode: "EUR"}}, nil
+	}
+
+	// Both watchers notified the item at 30 EUR, it is not in their search results anymore
+	now := time.Now()
+	for _, watcher := range []db.WatcherURL{tracking, other} {
+		seen := []db.ItemID{{Id: 10, Prices: []db.PricePoint{{Price: currency.Money{Amount: 3000, Currency: "EUR"}, SeenAt: now}}}}
+		if _, _, err := db.RecordItems(s.itemsFilePath, watcher.ID, seen); err != nil {
+			t.Fatal(err)
+		}
+		s.trackItem(watcher, vintedApi.VintedItemResp{ID: 10, Title: "Kabát"})
+	}
+
+	s.recheckDueItems(context.Background(), now)
+	if len(events) != 0 {
+		t.Fatalf("events without a price change = %+v", events)
+	}
+
+	price = "25.0"
+	s.recheckDueItems(context.Background(), now.Add(2*time.Minute))
+	// Only the watcher tracking the item reports the drop
+	if len(events) != 1 || events[0].Type != EventPriceDropped || events[0].Watcher.ID != 1 ||
+		events[0].Price.String() != "25.00 EUR" || events[0].OldPrice.String() != "30.00 EUR" {
+		t.Fatalf("events after the drop = %+v", events)
+	}
+
+	// The next poll sees the price the check recorded, the drop is not reported again
+	seen := []db.ItemID{{Id: 10, Prices: []db.PricePoint{{Price: currency.Money{Amount: 2500, Currency: "EUR"}, SeenAt: now}}}}
+	if _, changes, err := db.RecordItems(s.itemsFilePath, 1, seen); err != nil || len(changes) != 0 {
+		t.Errorf("RecordItems() after the check = %+v, %v, want no changes", changes, err)
+	}
+}
+
+func TestPollTracksItems(t *testing.T) {
+	s := newScheduler(Config{Workers: 1, HostInterval: time.Millisecond}, func(Event) {})
+	dir := t.TempDir()
+	s.itemsFilePath = filepath.Join(dir, "items.json")
+	s.statsFilePath = filepath.Join(dir, "watcher_stats.json")
+	s.statusFilePath = filepath.Join(dir, "item_status.json")
+	s.marketFilePath = filepath.Join(dir, "market.json")
+	s.fetchItems = func(ctx context.Context, url string) (*vintedApi.VintedItemsResp, error) {
+		if url == "https://www.vinted.sk/api/v2/catalog/items?sold" {
+			return &vintedApi.VintedItemsResp{Items: []vintedApi.VintedItemResp{{ID: 10}, {ID: 11}}}, nil
+		}
+		return &vintedApi.VintedItemsResp{Items: []vintedApi.VintedItemResp{{ID: 20}, {ID: 21}}}, nil
+	}
+
+	// Only the watchers marking the sold items and the tracked items need the checks
+	s.poll(context.Background(), &scheduledWatcher{watcher: db.WatcherURL{ID: 1, URL: "https://www.vinted.sk/api/v2/catalog/items?sold", MarkSold: true}})
+	s.poll(context.Background(), &scheduledWatcher{watcher: db.WatcherURL{ID: 2, URL: "https://www.vinted.sk/api/v2/catalog/items?tracked", TrackedItems: []int{21}}})
+
+	statuses, err := db.ReadItemStatuses(s.statusFilePath)
+	if err != nil {
+		t.Fatalf("ReadItemStatuses() error = %v", err)
+	}
+	var tracked []int
+	for _, status := range statuses {
+		tracked = append(tracked, status.ItemID)
+	}
+	if !slices.Equal(tracked, []int{10, 11, 21}) {
+		t.Errorf("tracked items = %v, want [10 11 21]", tracked)
+	}
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/imagehash"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+const (
+	photosFilePath = "photo_hashes.json"
+	// The title of a repost shares at least this part of the words with the original one.
+	minTitleSimilarity = 0.5
+)
+
+// Returns the lower case words of the title.
+func titleWords(title string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[word] = true
+	}
+
+	return words
+}
+
+// Returns the share of the words the titles have in common, from 0 for no common words to 1 for
+// the same words in any order.
+func titleSimilarity(a, b string) float64 {
+	wordsA, wordsB := titleWords(a), titleWords(b)
+	if len(wordsA) == 0 && len(wordsB) == 0 {
+		return 1
+	}
+
+	common := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(wordsA)+len(wordsB)-common)
+}
+
+// Downloads the photo of the item and returns its hash, ok is false if the item has no photo or
+// the photo could not be downloaded.
+func (s *scheduler) photoHash(ctx context.Context, watcher db.WatcherURL, item vintedApi.VintedItemResp) (imagehash.Hash, bool) {
+	if item.Photo.Url == "" {
+		return 0, false
+	}
+
+	// The CDN has its own limit, the downloads wait like the requests of the watcher
+	if err := s.limiter.wait(ctx, hostOf(item.Photo.Url), watcher.Priority); err != nil {
+		return 0, false
+	}
+
+	photo, err := s.fetchPhoto(ctx, item.Photo.Url)
+	if err != nil {
+		log.Printf("error downloading the photo of item %d: %v", item.ID, err)
+		return 0, false
+	}
+
+	hash, err := imagehash.Decode(bytes.NewReader(photo))
+	if err != nil {
+		log.Printf("error hashing the photo of item %d: %v", item.ID, err)
+		return 0, false
+	}
+
+	return hash, true
+}
+
+// Returns the item of the same seller seen since the given time which the item reposts: its photo
+// is similar within the configured distance and its title shares most of the words. nil if there is none.
+func (s *scheduler) repostOf(item vintedApi.VintedItemResp, hash imagehash.Hash, photos []db.PhotoHash, since time.Time) *db.PhotoHash {
+	if item.User.ID == 0 {
+		return nil
+	}
+
+	// The latest match first
+	for i := len(photos) - 1; i >= 0; i-- {
+		seen := photos[i]
+		if seen.ItemID == item.ID || seen.SellerID != item.User.ID || seen.SeenAt.Before(since) {
+			continue
+		}
+		if imagehash.Distance(seen.Hash, hash) > s.cfg.RepostDistance {
+			continue
+		}
+		if titleSimilarity(seen.Title, item.Title) < minTitleSimilarity {
+			continue
+		}
+
+		return &seen
+	}
+
+	return nil
+}
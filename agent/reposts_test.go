@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestTitleSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Nike jacket, blue", "blue NIKE jacket", 1},
+		{"Nike jacket blue", "Nike jacket red", 0.5},
+		{"Nike jacket", "Adidas shoes", 0},
+		{"", "", 1},
+	}
+	for _, tt := range tests {
+		if got := titleSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("titleSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFetchReposts(t *testing.T) {
+	var items []vintedApi.VintedItemResp
+	s := newScheduler(Config{Workers: 1, HostInterval: time.Millisecond, RepostDistance: 8, RepostWindow: time.Hour}, func(Event) {})
+	s.itemsFilePath = filepath.Join(t.TempDir(), "items.json")
+	s.marketFilePath = filepath.Join(t.TempDir(), "market.json")
+	s.photosFilePath = filepath.Join(t.TempDir(), "photo_hashes.json")
+	s.fetchItems = func(ctx context.Context, url string) (*vintedApi.VintedItemsResp, error) {
+		return &vintedApi.VintedItemsResp{Items: items}, nil
+	}
+	// The photos are the fixtures of the imagehash package
+	s.fetchPhoto = func(ctx context.Context, url string) ([]byte, error) {
+		return os.ReadFile(filepath.Join("..", "imagehash", "testdata", url))
+	}
+	watcher := db.WatcherURL{URL: "https://www.vinted.sk/api/v2/catalog/items", Reposts: db.RepostsHide}
+
+	item := func(id, seller int, title, photo string) vintedApi.VintedItemResp {
+		return vintedApi.VintedItemResp{
+			ID:    id,
+			Title: title,
+			Price: vintedApi.VintedPrice{Amount: "30.0", CurrencyCode: "EUR"},
+			Photo: vintedApi.VintedPhoto{Url: photo},
+			User:  vintedApi.VintedUser{ID: seller},
+		}
+	}
+	fetch := func() map[int]Event {
+		t.Helper()
+		events, _, err := s.fetch(context.Background(), watcher)
+		if err != nil {
+			t.Fatalf("fetch() error = %v", err)
+		}
+		byID := make(map[int]Event)
+		for _, event := range events {
+			byID[event.Item.ID] = event
+		}
+		return byID
+	}
+
+	items = []vintedApi.VintedItemResp{item(1, 7, "Nike jacket blue M", "jacket.png")}
+	if events := fetch(); len(events) != 1 || events[1].RepostOf != 0 {
+		t.Fatalf("first fetch() = %+v, want item 1", events)
+	}
+
+	items = []vintedApi.VintedItemResp{
+		// Reposted with a smaller photo and reordered title
+		item(2, 7, "Blue Nike jacket M", "jacket_repost.jpg"),
+		// The same photo from another seller
+		item(3, 8, "Nike jacket blue M", "jacket_repost.jpg"),
+		// Similar title, but another photo
+		item(4, 7, "Nike jacket blue L", "jacket_other.jpg"),
+		// Similar photo, but another title
+		item(5, 7, "Adidas hoodie", "jacket_repost.jpg"),
+	}
+	events := fetch()
+	if _, ok := events[2]; ok {
+		t.Errorf("fetch() notified the hidden repost %+v", events[2])
+	}
+	for _, id := range []int{3, 4, 5} {
+		if event, ok := events[id]; !ok || event.RepostOf != 0 {
+			t.Errorf("fetch() item %d = %+v, ok %v, want it not a repost", id, event, ok)
+		}
+	}
+
+	watcher.Reposts = db.RepostsFlag
+	items = []vintedApi.VintedItemResp{item(6, 7, "Nike jacket blue M", "jacket.png")}
+	if events := fetch(); events[6].RepostOf != 2 {
+		t.Errorf("fetch() with flagged reposts = %+v, want item 6 as the repost of the latest item 2", events)
+	}
+}
+
+func TestPhotoHashCancelled(t *testing.T) {
+	s := newScheduler(Config{Workers: 1, HostInterval: time.Millisecond}, func(Event) {})
+	s.fetchPhoto = func(ctx context.Context, url string) ([]byte, error) {
+		t.Errorf("photo %s downloaded after the shutdown", url)
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	item := vintedApi.VintedItemResp{ID: 1, Photo: vintedApi.VintedPhoto{Url: "https://images1.vinted.net/t/1.jpg"}}
+	if _, ok := s.photoHash(ctx, db.WatcherURL{}, item); ok {
+		t.Error("photoHash() ok after the ctx was cancelled")
+	}
+}
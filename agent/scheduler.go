@@ -0,0 +1,537 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net/url"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+const (
+	// How often the scheduler looks for the watchers due to a poll.
+	schedulerTick = time.Second
+	// Maximal wait after the repeated failures of a single watcher.
+	maxFailureBackoff = 30 * time.Minute
+)
+
+// State of a single watcher in the scheduler.
+type scheduledWatcher struct {
+	watcher  db.WatcherURL
+	nextPoll time.Time
+	running  bool
+	// Number of the failed polls in a row.
+	failures int
+	stats    db.WatcherStats
+}
+
+// Polls every watcher on its own timer. The failure of one watcher only delays that watcher.
+type scheduler struct {
+	cfg     Config
+	limiter *hostLimiter
+	publish func(Event)
+
+	// Replaceable in tests.
+	loadWatchers  func() ([]db.WatcherURL, error)
+	fetchItems    func(ctx context.Context, url string) (*vintedApi.VintedItemsResp, error)
+	fetchUser     func(ctx context.Context, url string, id int) (*vintedApi.VintedUser, error)
+	fetchItem     func(ctx context.Context, url string, id int) (*vintedApi.VintedItemDetail, error)
+	fetchPhoto    func(ctx context.Context, url string) ([]byte, error)
+	itemsFilePath string
+	statsFilePath string
+	// Notified items whose status is re-checked.
+	statusFilePath string
+	// Prices the deal scores are computed from.
+	marketFilePath string
+	// Photo hashes of the notified items the reposts are recognized by.
+	photosFilePath string
+	// Favourites of the users whose price and status are re-checked.
+	favouritesFilePath string
+
+	mu       sync.Mutex
+	watchers map[int]*scheduledWatcher
+
+	sellers sellerCache
+	rates   *currency.Table
+}
+
+func newScheduler(cfg Config, publish func(Event)) *scheduler {
+	return &scheduler{
+		cfg:     cfg,
+		limiter: newHostLimiter(cfg.HostInterval),
+		publish: publish,
+		loadWatchers: func() ([]db.WatcherURL, error) {
+			return db.ReadWatchers(watchersFilePath)
+		},
+		fetchItems:         vintedApi.GetVintedItems,
+		fetchUser:          vintedApi.GetVintedUser,
+		fetchItem:          vintedApi.GetVintedItem,
+		fetchPhoto:         vintedApi.GetVintedPhoto,
+		itemsFilePath:      itemsFilePath,
+		statsFilePath:      statsFilePath,
+		statusFilePath:     statusFilePath,
+		marketFilePath:     marketFilePath,
+		photosFilePath:     photosFilePath,
+		favouritesFilePath: favouritesFilePath,
+		watchers:           make(map[int]*scheduledWatcher),
+		sellers:            sellerCache{profiles: make(map[int]sellerProfile)},
+		rates:              currency.NewTable(currency.Default),
+	}
+}
+
+// Dispatches the due watchers to the workers until the ctx is cancelled, then waits for the workers
+// to finish the watchers in progress.
+func (s *scheduler) run(ctx context.Context) {
+	jobs := make(chan *scheduledWatcher)
+
+	var wg sync.WaitGroup
+	for range s.cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sw := range jobs {
+				s.poll(ctx, sw)
+			}
+		}()
+	}
+
+	tick := time.NewTicker(schedulerTick)
+	defer tick.Stop()
+	reload := time.NewTicker(s.cfg.ReloadInterval)
+	defer reload.Stop()
+
+	s.reload()
+
+loop:
+	for {
+		s.dispatch(ctx, jobs)
+
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-reload.C:
+			s.reload()
+		case <-tick.C:
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+}
+
+// Synchronizes the scheduled watchers with the watchers file. New watchers are polled right away.
+func (s *scheduler) reload() {
+	watchers, err := s.loadWatchers()
+	if err != nil {
+		log.Printf("error while getting urls to watch: %v", err)
+		return
+	}
+
+	// The adaptive intervals survive the restarts
+	stats, err := db.ReadWatcherStats(s.statsFilePath)
+	if err != nil {
+		log.Printf("error reading watcher stats: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := make(map[int]bool, len(watchers))
+	for _, watcher := range watchers {
+		current[watcher.ID] = true
+
+		if sw, ok := s.watchers[watcher.ID]; ok {
+			sw.watcher = watcher
+			continue
+		}
+
+		s.watchers[watcher.ID] = &scheduledWatcher{watcher: watcher, nextPoll: time.Now(), stats: stats[watcher.ID]}
+		log.Printf("watcher %d scheduled", watcher.ID)
+	}
+
+	for id := range s.watchers {
+		if !current[id] {
+			delete(s.watchers, id)
+			log.Printf("watcher %d unscheduled", id)
+		}
+	}
+}
+
+// Hands the due watchers to the idle workers, the rest waits for the next tick.
+func (s *scheduler) dispatch(ctx context.Context, jobs chan<- *scheduledWatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var due []*scheduledWatcher
+	for _, sw := range s.watchers {
+		if !sw.running && !sw.nextPoll.After(now) {
+			due = append(due, sw)
+		}
+	}
+
+	// The highest priority first, then the longest waiting
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].watcher.Priority != due[j].watcher.Priority {
+			return due[i].watcher.Priority > due[j].watcher.Priority
+		}
+		return due[i].nextPoll.Before(due[j].nextPoll)
+	})
+
+	for _, sw := range due {
+		select {
+		case jobs <- sw:
+			sw.running = true
+		case <-ctx.Done():
+			return
+		default:
+			return
+		}
+	}
+}
+
+// Fetches the items of the watcher and publishes the new ones and the price drops, then schedules the next poll.
+func (s *scheduler) poll(ctx context.Context, sw *scheduledWatcher) {
+	s.mu.Lock()
+	watcher := sw.watcher
+	s.mu.Unlock()
+
+	events, result, err := s.fetch(ctx, watcher)
+
+	s.mu.Lock()
+	sw.running = false
+	if err != nil {
+		sw.failures++
+		sw.nextPoll = time.Now().Add(failureBackoff(sw.failures))
+	} else {
+		sw.failures = 0
+		sw.stats = updateStats(sw.stats, watcher, s.cfg, result.newItems, result.pageSize, time.Now())
+		sw.nextPoll = time.Now().Add(pollInterval(watcher, time.Duration(sw.stats.IntervalSeconds)*time.Second))
+	}
+	stats := sw.stats
+	s.mu.Unlock()
+
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("error while getting items of watcher %d: %v", watcher.ID, err)
+			s.publish(Event{Type: EventWatcherError, Watcher: watcher, Err: err})
+		}
+		return
+	}
+
+	if err := db.SaveWatcherStats(s.statsFilePath, stats); err != nil {
+		log.Printf("error saving stats of watcher %d: %v", watcher.ID, err)
+	}
+
+	// The items found while snoozed are seen, but not notified
+	if watcher.SnoozedUntil.After(time.Now()) {
+		return
+	}
+
+	for _, event := range events {
+		event.Watcher = watcher
+		// The favourites are checked on their own
+		if watcher.MarkSold || slices.Contains(watcher.TrackedItems, event.Item.ID) {
+			s.trackItem(watcher, event.Item)
+		}
+		s.publish(event)
+	}
+}
+
+// Counts of a single poll.
+type pollResult struct {
+	// Items not seen before, regardless of the filters.
+	newItems int
+	pageSize int
+}
+
+// Returns the events about the new items of the watcher matching its filters and seller countries, and
+// about the price drops of the seen ones if the watcher wants them or tracks the item. All the items are marked as seen
+// with their current price. The reposts are flagged or left out, as the watcher wants.
+func (s *scheduler) fetch(ctx context.Context, watcher db.WatcherURL) ([]Event, pollResult, error) {
+	filter, err := newItemFilter(watcher.Filters)
+	if err != nil {
+		return nil, pollResult{}, err
+	}
+
+	// To prevent API overload
+	if err := s.limiter.wait(ctx, hostOf(watcher.URL), watcher.Priority); err != nil {
+		return nil, pollResult{}, err
+	}
+
+	items, err := s.fetchItems(ctx, watcher.URL)
+	if err != nil {
+		return nil, pollResult{}, err
+	}
+
+	now := time.Now()
+	domain := currency.ForHost(hostOf(watcher.URL))
+	seen := make([]db.ItemID, 0, len(items.Items))
+	for _, item := range items.Items {
+		seenItem := db.ItemID{Id: item.ID}
+		if price, err := currency.Parse(item.Price.Amount, priceCurrency(item.Price, item, domain)); err == nil {
+			seenItem.Prices = []db.PricePoint{{Price: price, SeenAt: now}}
+		}
+		seen = append(seen, seenItem)
+	}
+
+	newIDs, changes, err := db.RecordItems(s.itemsFilePath, watcher.ID, seen)
+	if err != nil {
+		return nil, pollResult{}, err
+	}
+
+	isNew := make(map[int]bool, len(newIDs))
+	for _, id := range newIDs {
+		isNew[id.Id] = true
+	}
+
+	// The scores compare the items with the prices seen before this poll
+	markets, err := db.ReadMarketSamples(s.marketFilePath)
+	if err != nil {
+		log.Printf("error reading the market prices: %v", err)
+	}
+
+	var newItems []vintedApi.VintedItemResp
+	for _, item := range items.Items {
+		if isNew[item.ID] {
+			newItems = append(newItems, item)
+		}
+	}
+	defer s.recordMarketSamples(watcher, newItems, now)
+
+	dropped := make(map[int]db.PriceChange)
+	for _, change := range changes {
+		if !watcher.PriceDrops && !slices.Contains(watcher.TrackedItems, change.ItemID) {
+			continue
+		}
+		if change.New.Price.Amount < change.Old.Price.Amount {
+			dropped[change.ItemID] = change
+		}
+	}
+
+	var photos, hashed []db.PhotoHash
+	if watcher.Reposts != db.RepostsOff {
+		photos, err = db.ReadPhotoHashes(s.photosFilePath)
+		if err != nil {
+			log.Printf("error reading the photo hashes: %v", err)
+		}
+	}
+
+	var events []Event
+	for _, item := range items.Items {
+		drop, isDrop := dropped[item.ID]
+		// The item was already added to the db and its price did not go down, skip
+		if !isNew[item.ID] && !isDrop {
+			continue
+		}
+
+		prices := s.itemPrices(watcher, item)
+		deal := s.dealOf(watcher, item, prices, markets)
+		rating := func(seller vintedApi.VintedUser) (float64, bool) {
+			return s.sellerRating(ctx, watcher, seller)
+		}
+		// Filtered out by the rules of the watcher, skip
+		if filter.reject(item, prices, deal, rating) != "" {
+			continue
+		}
+
+		// The item is sold by other seller's nationality than the user wants, skip
+		// But keep the record of it so it won't have to be processed later again
+		if !s.sellerCountryAllowed(ctx, watcher, item) {
+			continue
+		}
+
+		event := Event{Type: EventNewItem, Item: item, Price: prices.price, TotalPrice: prices.total, Deal: deal}
+		if stars, ok := s.knownSellerRating(item.User); ok {
+			event.SellerRating = stars
+		}
+		// Only the new items are checked, a price drop of a repost is still a price drop
+		if !isDrop && watcher.Reposts != db.RepostsOff {
+			if hash, ok := s.photoHash(ctx, watcher, item); ok {
+				if original := s.repostOf(item, hash, photos, now.Add(-s.cfg.RepostWindow)); original != nil {
+					event.RepostOf = original.ItemID
+				}
+				// The hidden reposts are kept too, so the next repost is recognized as well
+				hashed = append(hashed, db.PhotoHash{ItemID: item.ID, SellerID: item.User.ID, Title: item.Title, Hash: hash, SeenAt: now})
+			}
+			if event.RepostOf != 0 && watcher.Reposts == db.RepostsHide {
+				continue
+			}
+		}
+		if isDrop {
+			event.Type = EventPriceDropped
+			event.OldPrice = drop.Old.Price
+			if old, ok := s.rates.Convert(drop.Old.Price, prices.price.Currency); ok {
+				event.OldPrice = old
+			}
+		}
+		events = append(events, event)
+	}
+
+	if len(hashed) > 0 {
+		if err := db.AddPhotoHashes(s.photosFilePath, hashed, now.Add(-s.cfg.RepostWindow)); err != nil {
+			log.Printf("error saving the photo hashes of watcher %d: %v", watcher.ID, err)
+		}
+	}
+
+	return events, pollResult{newItems: len(newIDs), pageSize: len(items.Items)}, nil
+}
+
+func (s *scheduler) nextPoll(id int) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sw, ok := s.watchers[id]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return sw.nextPoll, true
+}
+
+func (s *scheduler) stats(id int) (db.WatcherStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sw, ok := s.watchers[id]
+	if !ok || sw.stats.Polls == 0 {
+		return db.WatcherStats{}, false
+	}
+
+	return sw.stats, true
+}
+
+// Returns the wait after the given number of failed polls in a row, it doubles up to maxFailureBackoff.
+func failureBackoff(failures int) time.Duration {
+	delay := time.Duration(1<<min(failures, 16)) * 30 * time.Second
+	if delay > maxFailureBackoff {
+		delay = maxFailureBackoff
+	}
+
+	return delay
+}
+
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	return parsed.Host
+}
+
+// Spaces the requests to the same host at least interval apart, plus a random jitter of up to interval.
+// When several requests wait for the same host, the one with the highest priority gets the next slot.
+type hostLimiter struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostQueue
+	seq   int
+}
+
+type hostQueue struct {
+	// Earliest time of the next request.
+	next    time.Time
+	waiters []*hostWaiter
+	// A timer granting the next slot is running.
+	timer bool
+}
+
+type hostWaiter struct {
+	priority int
+	// Keeps the order of waiters with the same priority.
+	seq   int
+	ready chan struct{}
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{
+		interval: interval,
+		hosts:    make(map[string]*hostQueue),
+	}
+}
+
+// Waits for a free slot of the host. Returns the ctx error if cancelled meanwhile.
+func (l *hostLimiter) wait(ctx context.Context, host string, priority int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	q, ok := l.hosts[host]
+	if !ok {
+		q = &hostQueue{}
+		l.hosts[host] = q
+	}
+	l.seq++
+	w := &hostWaiter{priority: priority, seq: l.seq, ready: make(chan struct{})}
+	q.waiters = append(q.waiters, w)
+	l.grant(host, q)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		for i, waiter := range q.waiters {
+			if waiter == w {
+				q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+
+		// The slot was granted meanwhile, it is used anyway.
+		return nil
+	}
+}
+
+// Lets the best waiter through if the slot is free, otherwise plans the grant for the time the slot frees up.
+// Must be called with l.mu held.
+func (l *hostLimiter) grant(host string, q *hostQueue) {
+	if q.timer || len(q.waiters) == 0 {
+		return
+	}
+
+	now := time.Now()
+	if now.Before(q.next) {
+		q.timer = true
+		time.AfterFunc(q.next.Sub(now), func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			q.timer = false
+			l.grant(host, q)
+		})
+		return
+	}
+
+	best := 0
+	for i, w := range q.waiters {
+		b := q.waiters[best]
+		if w.priority > b.priority || (w.priority == b.priority && w.seq < b.seq) {
+			best = i
+		}
+	}
+	w := q.waiters[best]
+	q.waiters = append(q.waiters[:best], q.waiters[best+1:]...)
+	close(w.ready)
+
+	gap := l.interval
+	if l.interval > 0 {
+		gap += time.Duration(rand.Int63n(int64(l.interval)))
+	}
+	q.next = now.Add(gap)
+
+	l.grant(host, q)
+}
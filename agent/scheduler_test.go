@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestSchedulerIsolatesFailuresAndReloads(t *testing.T) {
+	var mu sync.Mutex
+	watchers := []db.WatcherURL{
+		{ID: 1, URL: "https://www.vinted.sk/api/v2/catalog/items?failing"},
+		{ID: 2, URL: "https://www.vinted.sk/api/v2/catalog/items?second"},
+	}
+	items := map[string]int{
+		"https://www.vinted.sk/api/v2/catalog/items?second": 20,
+		"https://www.vinted.sk/api/v2/catalog/items?third":  30,
+	}
+
+	var bus eventBus
+	events := bus.subscribe(10)
+	s := newScheduler(Config{Workers: 2, HostInterval: time.Millisecond, ReloadInterval: 10 * time.Millisecond}, bus.publish)
+	s.itemsFilePath = filepath.Join(t.TempDir(), "items.json")
+	s.statsFilePath = filepath.Join(t.TempDir(), "watcher_stats.json")
+	s.statusFilePath = filepath.Join(t.TempDir(), "item_status.json")
+	s.marketFilePath = filepath.Join(t.TempDir(), "market.json")
+	s.loadWatchers = func() ([]db.WatcherURL, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]db.WatcherURL(nil), watchers...), nil
+	}
+	s.fetchItems = func(ctx context.Context, url string) (*vintedApi.VintedItemsResp, error) {
+		id, ok := items[url]
+		if !ok {
+			return nil, errors.New("status code: 403")
+		}
+		return &vintedApi.VintedItemsResp{Items: []vintedApi.VintedItemResp{{ID: id}}}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.run(ctx)
+		close(done)
+	}()
+
+	// The watchers are polled concurrently, so the events may come in any order.
+	var pending []Event
+	receive := func(wantType EventType, wantWatcher int) {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for {
+			for i, got := range pending {
+				if got.Type == wantType && got.WatcherID == wantWatcher {
+					pending = append(pending[:i], pending[i+1:]...)
+					return
+				}
+			}
+
+			select {
+			case got := <-events:
+				pending = append(pending, got)
+			case <-deadline:
+				t.Fatalf("no %s event of watcher %d, got %+v", wantType, wantWatcher, pending)
+			}
+		}
+	}
+
+	receive(EventWatcherError, 1)
+	receive(EventNewItem, 2)
+
+	mu.Lock()
+	watchers = append(watchers, db.WatcherURL{ID: 3, URL: "https://www.vinted.sk/api/v2/catalog/items?third"})
+	mu.Unlock()
+
+	receive(EventNewItem, 3)
+
+	cancel()
+	<-done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if failing := s.watchers[1]; failing == nil || failing.failures != 1 {
+		t.Errorf("failing watcher state = %+v, want 1 failure", failing)
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	l := newHostLimiter(20 * time.Millisecond)
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 3 {
+		if err := l.wait(ctx, "www.vinted.sk", 0); err != nil {
+			t.Fatalf("wait() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 requests to the same host took %v, want at least 40ms", elapsed)
+	}
+
+	start = time.Now()
+	if err := l.wait(ctx, "www.vinted.cz", 0); err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("request to another host waited %v", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.wait(cancelled, "www.vinted.sk", 0); err == nil {
+		t.Errorf("wait() with cancelled context = nil, want error")
+	}
+}
+
+func TestHostLimiterPriority(t *testing.T) {
+	l := newHostLimiter(30 * time.Millisecond)
+	ctx := context.Background()
+
+	// Takes the free slot, the others have to queue
+	if err := l.wait(ctx, "www.vinted.sk", 0); err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for _, priority := range []int{-1, 0, 1} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.wait(ctx, "www.vinted.sk", priority); err != nil {
+				t.Errorf("wait() error = %v", err)
+			}
+			mu.Lock()
+			order = append(order, priority)
+			mu.Unlock()
+		}()
+		// Let the waiter queue up before the next one
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if want := []int{1, 0, -1}; !slices.Equal(order, want) {
+		t.Errorf("granted in order %v, want %v", order, want)
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		watcher  db.WatcherURL
+		adaptive time.Duration
+		min, max time.Duration
+	}{
+		{
+			name:    "default",
+			watcher: db.WatcherURL{},
+			min:     defaultInterval - defaultJitter,
+			max:     defaultInterval + defaultJitter,
+		},
+		{
+			name:    "own interval without jitter",
+			watcher: db.WatcherURL{IntervalSeconds: 60},
+			min:     60 * time.Second,
+			max:     60 * time.Second,
+		},
+		{
+			name:    "own interval with jitter",
+			watcher: db.WatcherURL{IntervalSeconds: 60, JitterSeconds: 10},
+			min:     50 * time.Second,
+			max:     70 * time.Second,
+		},
+		{
+			name:    "default interval with jitter",
+			watcher: db.WatcherURL{JitterSeconds: 10},
+			min:     defaultInterval - 10*time.Second,
+			max:     defaultInterval + 10*time.Second,
+		},
+		{
+			name:     "adaptive",
+			watcher:  db.WatcherURL{IntervalSeconds: 600, Adaptive: true},
+			adaptive: 60 * time.Second,
+			min:      50 * time.Second,
+			max:      70 * time.Second,
+		},
+		{
+			name:    "below minimum",
+			watcher: db.WatcherURL{IntervalSeconds: 5},
+			min:     MinInterval,
+			max:     MinInterval,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				if got := pollInterval(tt.watcher, tt.adaptive); got < tt.min || got > tt.max {
+					t.Fatalf("pollInterval() = %v, want between %v and %v", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
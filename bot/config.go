@@ -0,0 +1,93 @@
+package discordBot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/slack"
+	"github.com/smatand/vinted_go/telegram"
+)
+
+// Permissions the bot needs in every channel it posts the items to.
+const requiredChannelPermissions = discordgo.PermissionViewChannel |
+	discordgo.PermissionSendMessages |
+	discordgo.PermissionEmbedLinks
+
+// Configuration of the Discord bot.
+type Config struct {
+	Token string
+	// Guilds the slash commands are registered in.
+	GuildIDs []string
+	// Registers the slash commands globally as well, it takes up to an hour until they show up.
+	GlobalCommands bool
+	// Channels the items of watchers without own channel are posted to.
+	DefaultChannelIDs []string
+	// Members with this role may manage watchers of other users in the guild.
+	ManageRoleID string
+	// Time to deliver the pending items on shutdown, the rest is stored for the next start.
+	ShutdownTimeout time.Duration
+	// Configuration of the agent watching the items.
+	Agent agent.Config
+	// Access token of the protected ntfy topics, optional.
+	NtfyToken string
+	// The email sink is available only with the SMTP server configured.
+	SMTP SMTPConfig
+	// The Telegram front-end runs alongside Discord if the token is set.
+	Telegram telegram.Config
+	// The Slack app runs alongside Discord if the bot token is set.
+	Slack slack.Config
+}
+
+// Server the items are emailed through.
+type SMTPConfig struct {
+	// host:port of the server, the email sink is disabled if empty.
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// Splits the comma separated list of IDs, e.g. from the environment variable, and drops the empty ones.
+func SplitIDs(ids string) []string {
+	var result []string
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		if id != "" {
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
+
+// Parses the comma separated list of numeric IDs, e.g. the Telegram user IDs.
+func SplitIntIDs(ids string) ([]int64, error) {
+	var result []int64
+	for _, id := range SplitIDs(ids) {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q", id)
+		}
+		result = append(result, n)
+	}
+
+	return result, nil
+}
+
+// Returns an error if the bot is not allowed to post embeds into the channel.
+func checkChannelPermissions(s *discordgo.Session, channelID string) error {
+	perms, err := s.UserChannelPermissions(s.State.User.ID, channelID)
+	if err != nil {
+		return fmt.Errorf("cannot read permissions in channel %s: %v", channelID, err)
+	}
+
+	if perms&requiredChannelPermissions != requiredChannelPermissions {
+		return fmt.Errorf("missing permission to send embeds to channel %s", channelID)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package discordBot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/db"
+)
+
+var noCountries = 0
+
+// Returns the multi-select of the seller countries of the watcher, the selected ones are preselected.
+func countriesMenu(watcherID int, selected []string) discordgo.ActionsRow {
+	var options []discordgo.SelectMenuOption
+	for _, country := range agent.Countries {
+		options = append(options, discordgo.SelectMenuOption{
+			Label:   country.Name,
+			Value:   country.Code,
+			Default: slices.Contains(selected, country.Code),
+		})
+	}
+
+	return discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+		discordgo.SelectMenu{
+			MenuType:    discordgo.StringSelectMenu,
+			CustomID:    "countries:" + strconv.Itoa(watcherID),
+			Placeholder: "Seller countries (all if none selected)",
+			MinValues:   &noCountries,
+			MaxValues:   len(options),
+			Options:     options,
+		},
+	}}
+}
+
+// Sets the seller countries of the watcher, the legacy currencies are dropped.
+func setCountries(watcher *db.WatcherURL, countries []string) {
+	watcher.Countries = countries
+	watcher.SellerCurrency = nil
+}
+
+// Saves the countries selected in the menu of the /watch response.
+func handleCountriesSelect(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+	_, arg, _ := strings.Cut(data.CustomID, ":")
+	id, _ := strconv.Atoi(arg)
+
+	watcher, err := db.GetWatcher("", id)
+	if err != nil || !canManage(i, watcher) {
+		respond(s, i, fmt.Sprintf("there is no watcher %d you could manage", id), true)
+		return
+	}
+
+	var countries []string
+	for _, code := range data.Values {
+		if agent.ValidCountry(code) {
+			countries = append(countries, code)
+		}
+	}
+	setCountries(&watcher, countries)
+
+	if err := db.UpdateWatcher("", watcher); err != nil {
+		log.Printf("error updating watcher %d: %v", watcher.ID, err)
+		respond(s, i, "the watcher could not be saved, try again later", true)
+		return
+	}
+
+	log.Printf("countries of watcher %d set to %v by %s", watcher.ID, countries, interactionUserID(i))
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    fmt.Sprintf("watcher %d posts the items of %s", watcher.ID, agent.DescribeSellers(watcher)),
+			Components: []discordgo.MessageComponent{countriesMenu(watcher.ID, countries)},
+		},
+	})
+	if err != nil {
+		log.Printf("error responding to interaction: %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package discordBot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+)
+
+var (
+	minDigestSize = 0.0
+
+	deliveryCommand = &discordgo.ApplicationCommand{
+		Name:        "delivery",
+		Description: "Set the quiet hours and digests of a watcher or a channel, without settings shows the current ones.",
+		Type:        discordgo.ChatApplicationCommand,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "id",
+				Description: "ID of the watcher, see /list (the channel's settings apply to the watchers without own)",
+				Type:        discordgo.ApplicationCommandOptionInteger,
+			},
+			{
+				Name:         "channel",
+				Description:  "Channel the settings are for, this channel if neither id nor channel is given",
+				Type:         discordgo.ApplicationCommandOptionChannel,
+				ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+			},
+			{
+				Name:        "quiet_from",
+				Description: "Start of the quiet hours, e.g. 22:00 (- clears)",
+				Type:        discordgo.ApplicationCommandOptionString,
+			},
+			{
+				Name:        "quiet_to",
+				Description: "End of the quiet hours, e.g. 07:00 (- clears)",
+				Type:        discordgo.ApplicationCommandOptionString,
+			},
+			{
+				Name:        "timezone",
+				Description: "Time zone of the hours, e.g. Europe/Bratislava (- is UTC)",
+				Type:        discordgo.ApplicationCommandOptionString,
+			},
+			{
+				Name:        "digest",
+				Description: "Deliver the items together instead of one by one",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "off", Value: clearValue},
+					{Name: "hourly", Value: db.DigestHourly},
+					{Name: "daily", Value: db.DigestDaily},
+				},
+			},
+			{
+				Name:        "digest_at",
+				Description: "Time of the daily digest, e.g. 18:00 (- is 08:00)",
+				Type:        discordgo.ApplicationCommandOptionString,
+			},
+			{
+				Name:        "digest_size",
+				Description: fmt.Sprintf("Number of the items shown in a digest (0 is %d)", notify.DefaultDigestSize),
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				MinValue:    &minDigestSize,
+				MaxValue:    notify.MaxDigestSize,
+			},
+			{
+				Name:        "digest_order",
+				Description: "Items shown in a digest",
+				Type:        discordgo.ApplicationCommandOptionString,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "newest", Value: clearValue},
+					{Name: "best deals", Value: db.DigestBestDeals},
+				},
+			},
+			{
+				Name:        "clear",
+				Description: "Remove all settings before applying the given ones",
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+			},
+		},
+	}
+)
+
+func handleDelivery(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+
+	settings := 0
+	hasID := false
+	channelID := i.ChannelID
+	for _, opt := range options {
+		switch opt.Name {
+		case "id":
+			hasID = true
+		case "channel":
+			channelID = opt.Value.(string)
+		default:
+			settings++
+		}
+	}
+
+	if hasID {
+		handleWatcherDelivery(s, i, settings > 0)
+		return
+	}
+
+	// The channel settings apply to the watchers of everyone posting there
+	if i.GuildID == "" || !isManager(i) {
+		respond(s, i, "only the managers of the server can set the delivery of a channel, use the id of your watcher", true)
+		return
+	}
+
+	deliveries, err := db.ReadChannelDeliveries("")
+	if err != nil {
+		log.Printf("error reading the channel deliveries: %v", err)
+		respond(s, i, "the settings could not be loaded, try again later", true)
+		return
+	}
+
+	if settings == 0 {
+		respond(s, i, fmt.Sprintf("<#%s>: %s", channelID, describeDelivery(deliveries[channelID])), true)
+		return
+	}
+
+	delivery, ok := applyDeliveryOptions(s, i, deliveries[channelID], options)
+	if !ok {
+		return
+	}
+
+	if err := db.SetChannelDelivery("", channelID, delivery); err != nil {
+		log.Printf("error saving the delivery of channel %s: %v", channelID, err)
+		respond(s, i, "the settings could not be saved, try again later", true)
+		return
+	}
+
+	log.Printf("delivery of channel %s changed by %s", channelID, interactionUserID(i))
+	respond(s, i, fmt.Sprintf("<#%s>: %s", channelID, describeDelivery(delivery)), true)
+}
+
+func handleWatcherDelivery(s *discordgo.Session, i *discordgo.InteractionCreate, change bool) {
+	watcher, ok := loadManagedWatcher(s, i)
+	if !ok {
+		return
+	}
+
+	if !change {
+		respond(s, i, fmt.Sprintf("watcher %d: %s", watcher.ID, describeDelivery(watcher.Delivery)), true)
+		return
+	}
+
+	delivery, ok := applyDeliveryOptions(s, i, watcher.Delivery, i.ApplicationCommandData().Options)
+	if !ok {
+		return
+	}
+
+	watcher.Delivery = delivery
+	if err := db.UpdateWatcher("", watcher); err != nil {
+		log.Printf("error updating watcher %d: %v", watcher.ID, err)
+		respond(s, i, "the watcher could not be saved, try again later", true)
+		return
+	}
+
+	log.Printf("delivery of watcher %d changed by %s", watcher.ID, interactionUserID(i))
+	respond(s, i, fmt.Sprintf("watcher %d: %s", watcher.ID, describeDelivery(watcher.Delivery)), true)
+}
+
+// Returns the delivery with the given options applied, ok is false if the result is invalid,
+// the user was told why.
+func applyDeliveryOptions(s *discordgo.Session, i *discordgo.InteractionCreate, delivery db.Delivery, options []*discordgo.ApplicationCommandInteractionDataOption) (db.Delivery, bool) {
+	for _, opt := range options {
+		if opt.Name == "clear" && opt.BoolValue() {
+			delivery = db.Delivery{}
+		}
+	}
+
+	for _, opt := range options {
+		switch opt.Name {
+		case "quiet_from":
+			delivery.QuietFrom = clearable(opt.StringValue())
+		case "quiet_to":
+			delivery.QuietTo = clearable(opt.StringValue())
+		case "timezone":
+			delivery.Timezone = clearable(opt.StringValue())
+		case "digest":
+			delivery.Digest = clearable(opt.StringValue())
+		case "digest_at":
+			delivery.DigestAt = clearable(opt.StringValue())
+		case "digest_size":
+			delivery.DigestSize = int(opt.IntValue())
+		case "digest_order":
+			delivery.DigestOrder = clearable(opt.StringValue())
+		}
+	}
+
+	if err := notify.ValidateDelivery(delivery); err != nil {
+		respond(s, i, err.Error(), true)
+		return db.Delivery{}, false
+	}
+
+	return delivery, true
+}
+
+// Describes the delivery in a sentence, e.g. "quiet 22:00-07:00 Europe/Bratislava, daily digest at 08:00 of the 10 newest items".
+func describeDelivery(d db.Delivery) string {
+	if d == (db.Delivery{}) {
+		return "items delivered right away"
+	}
+
+	var parts []string
+	if d.QuietFrom != "" {
+		parts = append(parts, fmt.Sprintf("quiet %s-%s", d.QuietFrom, d.QuietTo))
+	}
+
+	size := d.DigestSize
+	if size == 0 {
+		size = notify.DefaultDigestSize
+	}
+	order := "newest"
+	if d.DigestOrder == db.DigestBestDeals {
+		order = "best deals"
+	}
+
+	switch d.Digest {
+	case db.DigestHourly:
+		parts = append(parts, fmt.Sprintf("hourly digest of the %d %s", size, order))
+	case db.DigestDaily:
+		at := d.DigestAt
+		if at == "" {
+			at = "08:00"
+		}
+		parts = append(parts, fmt.Sprintf("daily digest at %s of the %d %s", at, size, order))
+	default:
+		parts = append(parts, fmt.Sprintf("items delivered right away, after the quiet hours as a digest of the %d %s", size, order))
+	}
+
+	timezone := d.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	return strings.Join(parts, ", ") + " (" + timezone + ")"
+}
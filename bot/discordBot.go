@@ -1,24 +1,85 @@
 package discordBot
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/smatand/vinted_go/agent"
 	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+	"github.com/smatand/vinted_go/slack"
+	"github.com/smatand/vinted_go/telegram"
 	"github.com/smatand/vinted_go/vinted"
 	vintedApi "github.com/smatand/vinted_go/vintedApi"
 )
 
+// Time the sender gets after the shutdown deadline to finish the message in progress.
+const shutdownGrace = 2 * time.Second
+
 var (
+	minIntervalSeconds = agent.MinInterval.Seconds()
+	minJitterSeconds   = 0.0
+
+	// Scheduling options shared by /watch and /edit.
+	intervalOption = &discordgo.ApplicationCommandOption{
+		Name:        "interval",
+		Description: "Seconds between two checks of the url, 120-240 by default",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		MinValue:    &minIntervalSeconds,
+		Required:    false,
+	}
+	jitterOption = &discordgo.ApplicationCommandOption{
+		Name:        "jitter",
+		Description: "Random deviation of the interval in seconds",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		MinValue:    &minJitterSeconds,
+		Required:    false,
+	}
+	priorityOption = &discordgo.ApplicationCommandOption{
+		Name:        "priority",
+		Description: "Watchers with higher priority are checked first when Vinted requests are scarce",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Required:    false,
+		Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{Name: "low", Value: db.PriorityLow},
+			{Name: "normal", Value: db.PriorityNormal},
+			{Name: "high", Value: db.PriorityHigh},
+		},
+	}
+
+	adaptiveOption = &discordgo.ApplicationCommandOption{
+		Name:        "adaptive",
+		Description: "Check more often when many new items appear and less often when nothing changes",
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+		Required:    false,
+	}
+	minIntervalOption = &discordgo.ApplicationCommandOption{
+		Name:        "min_interval",
+		Description: "Shortest adaptive interval in seconds",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		MinValue:    &minIntervalSeconds,
+		Required:    false,
+	}
+	maxIntervalOption = &discordgo.ApplicationCommandOption{
+		Name:        "max_interval",
+		Description: "Longest adaptive interval in seconds",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		MinValue:    &minIntervalSeconds,
+		Required:    false,
+	}
+
 	commands = []*discordgo.ApplicationCommand{
 		{
 			Name:        "watch",
-			Description: "Insert Vinted's URL to watch items. You may choose which currencies to include.",
+			Description: "Insert Vinted's URL to watch items. You may choose the seller countries afterwards.",
 			Type:        discordgo.ChatApplicationCommand,
 			Options: []*discordgo.ApplicationCommandOption{
 				{
@@ -29,30 +90,219 @@ var (
 					Autocomplete: false,
 				},
 				{
-					Name:        "currency_eur",
-					Description: "Include items in EUR",
+					Name:        "dm",
+					Description: "Send the new items to your direct messages instead of this channel",
 					Type:        discordgo.ApplicationCommandOptionBoolean,
 					Required:    false,
 				},
+				intervalOption,
+				jitterOption,
+				priorityOption,
+				adaptiveOption,
+				minIntervalOption,
+				maxIntervalOption,
+			},
+		},
+		{
+			Name:        "list",
+			Description: "List the watchers you are allowed to manage.",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        "edit",
+			Description: "Edit a watcher. Only the given options are changed.",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "id",
+					Description: "ID of the watcher, see /list",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    true,
+				},
+				{
+					Name:        "url",
+					Description: "New url of vinted page",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+				{
+					Name:        "countries",
+					Description: "Comma separated seller countries, e.g. SK, CZ (- allows all)",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
 				{
-					Name:        "currency_czk",
-					Description: "Include items in CZK",
+					Name:        "currency",
+					Description: "Currency the prices are shown and filtered in",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+					Choices:     currencyChoices(),
+				},
+				{
+					Name:        "price_drops",
+					Description: "Notify when the price of a seen item goes down",
 					Type:        discordgo.ApplicationCommandOptionBoolean,
 					Required:    false,
 				},
 				{
-					Name:        "currency_pln",
-					Description: "Include items in PLN",
+					Name:        "deal_basis",
+					Description: "Prices the deal score compares the items with",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "All items of this search", Value: "-"},
+						{Name: "Items of the same brand, category and size", Value: db.DealBasisBucket},
+					},
+				},
+				{
+					Name:        "reposts",
+					Description: "Reposts of the items notified in the last week",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Notify as new items", Value: "-"},
+						{Name: "Notify marked as reposts", Value: db.RepostsFlag},
+						{Name: "Do not notify", Value: db.RepostsHide},
+					},
+				},
+				{
+					Name:        "color",
+					Description: "Colour of the item embeds, e.g. #FF8800 (- picks one by the ID)",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+				{
+					Name:        "mark_sold",
+					Description: "Mark the posted items when they are sold, reserved or removed",
 					Type:        discordgo.ApplicationCommandOptionBoolean,
 					Required:    false,
 				},
+				{
+					Name:        "dm",
+					Description: "Send the new items to the owner's direct messages",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Required:    false,
+				},
+				intervalOption,
+				jitterOption,
+				priorityOption,
+				adaptiveOption,
+				minIntervalOption,
+				maxIntervalOption,
+			},
+		},
+		{
+			Name:        "setchannel",
+			Description: "Choose the channel a watcher posts the new items to.",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "id",
+					Description: "ID of the watcher, see /list",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    true,
+				},
+				{
+					Name:         "channel",
+					Description:  "Channel to post the new items to",
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+					Required:     true,
+				},
+			},
+		},
+		filterCommand,
+		deliveryCommand,
+		favouritesCommand,
+		{
+			Name:        "notify",
+			Description: "Deliver the new items of a watcher to another service as well.",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "id",
+					Description: "ID of the watcher, see /list",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    true,
+				},
+				{
+					Name:        "action",
+					Description: "Add or remove the sink",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "add", Value: "add"},
+						{Name: "remove", Value: "remove"},
+					},
+				},
+				{
+					Name:        "type",
+					Description: "Service to deliver the items to",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "webhook", Value: notify.SinkWebhook},
+						{Name: "ntfy", Value: notify.SinkNtfy},
+						{Name: "gotify", Value: notify.SinkGotify},
+						{Name: "email", Value: notify.SinkEmail},
+						{Name: "stdout", Value: notify.SinkStdout},
+					},
+				},
+				{
+					Name:        "target",
+					Description: "Webhook or topic url, gotify url with the token, or email address",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "remove",
+			Description: "Remove a watcher.",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "id",
+					Description: "ID of the watcher, see /list",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    true,
+				},
 			},
 		},
 	}
 
 	commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
-		"watch": handleWatcher,
+		"watch":      handleWatcher,
+		"list":       handleList,
+		"edit":       handleEdit,
+		"setchannel": handleSetChannel,
+		"filter":     handleFilter,
+		"delivery":   handleDelivery,
+		"favourites": handleFavourites,
+		"notify":     handleNotify,
+		"remove":     handleRemove,
 	}
+
+	// Handlers of the message components by the custom ID prefix.
+	componentHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
+		"countries":   handleCountriesSelect,
+		"hideseller":  handleHideSeller,
+		"snooze":      handleSnooze,
+		"track":       handleTrackPrice,
+		"details":     handleDetails,
+		"favourite":   handleFavourite,
+		"favourites":  handleFavouritesPage,
+		"unfavourite": handleUnfavourite,
+	}
+
+	// Members with this role may list, edit and remove watchers of other users in the guild.
+	manageRoleID string
+
+	// The running agent, it knows when the watchers are polled next.
+	watchAgent *agent.Agent
+
+	// Reports whether the sink is configured, e.g. email needs the SMTP server.
+	sinkSupported = func(sink string) bool { return false }
 )
 
 func handleWatcher(s *discordgo.Session, i *discordgo.InteractionCreate) {
@@ -60,106 +310,144 @@ func handleWatcher(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		data := i.ApplicationCommandData()
 
 		var url string
-		var selectedCurrencies []string
+		var dm bool
 		for _, opt := range data.Options {
 			switch opt.Name {
 			case "url":
 				url = opt.StringValue()
-			case "currency_eur":
-				if opt.BoolValue() {
-					selectedCurrencies = append(selectedCurrencies, "EUR")
-				}
-			case "currency_czk":
-				if opt.BoolValue() {
-					selectedCurrencies = append(selectedCurrencies, "CZK")
-				}
-			case "currency_pln":
-				if opt.BoolValue() {
-					selectedCurrencies = append(selectedCurrencies, "PLN")
-				}
+			case "dm":
+				dm = opt.BoolValue()
 			}
 		}
 
-		if len(selectedCurrencies) == 0 {
-			selectedCurrencies = []string{"EUR", "CZK", "PLN"}
+		var schedule db.WatcherURL
+		applyScheduleOptions(&schedule, data.Options)
+
+		var parsedParams vinted.Vinted
+		parsedParams.ParseParams(url)
+		apiUrl := vintedApi.ConstructVintedAPIRequest(parsedParams)
+
+		id, err := addWatcherToDb(db.WatcherURL{
+			URL:             apiUrl,
+			OwnerID:         interactionUserID(i),
+			GuildID:         i.GuildID,
+			ChannelID:       i.ChannelID,
+			DM:              dm,
+			IntervalSeconds: schedule.IntervalSeconds,
+			JitterSeconds:   schedule.JitterSeconds,
+			Priority:        schedule.Priority,
+
+			Adaptive:           schedule.Adaptive,
+			MinIntervalSeconds: schedule.MinIntervalSeconds,
+			MaxIntervalSeconds: schedule.MaxIntervalSeconds,
+		})
+		if err != nil {
+			respond(s, i, "the watcher could not be saved, try again later", true)
+			return
 		}
 
-		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Content: fmt.Sprintf(
-					"you entered %s and currencies %v to watch", url, selectedCurrencies,
+					"you entered %s to watch, the watcher has ID %d. Items of sellers from all countries are posted, "+
+						"choose the countries below to limit them", url, id,
 				),
-				Flags: discordgo.MessageFlagsSuppressEmbeds,
+				Flags:      discordgo.MessageFlagsSuppressEmbeds,
+				Components: []discordgo.MessageComponent{countriesMenu(id, nil)},
 			},
 		})
 		if err != nil {
 			log.Printf("error responding to interaction: %v", err)
 		}
-
-		var parsedParams vinted.Vinted
-		parsedParams.ParseParams(url)
-		apiUrl := vintedApi.ConstructVintedAPIRequest(parsedParams)
-
-		addWatcherToDb(apiUrl, selectedCurrencies)
 	}
 }
 
-func addWatcherToDb(url string, currencies []string) {
-	dbWatcherURL := db.WatcherURL{
-		URL:            url,
-		SellerCurrency: currencies,
+// Sets the interval, jitter, priority and adaptive polling of the watcher from the given options.
+func applyScheduleOptions(watcher *db.WatcherURL, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	for _, opt := range options {
+		switch opt.Name {
+		case "interval":
+			watcher.IntervalSeconds = int(opt.IntValue())
+		case "jitter":
+			watcher.JitterSeconds = int(opt.IntValue())
+		case "priority":
+			watcher.Priority = int(opt.IntValue())
+		case "adaptive":
+			watcher.Adaptive = opt.BoolValue()
+		case "min_interval":
+			watcher.MinIntervalSeconds = int(opt.IntValue())
+		case "max_interval":
+			watcher.MaxIntervalSeconds = int(opt.IntValue())
+		}
 	}
-	err := db.AppendWatcher("", dbWatcherURL)
+}
+
+func addWatcherToDb(dbWatcherURL db.WatcherURL) (int, error) {
+	id, err := db.AppendWatcher("", dbWatcherURL)
 	if err != nil {
 		log.Printf("error when adding watcher to db has occurred: %v", err)
 	} else {
-		log.Printf("added URL %s with currencies %v to db", url, currencies)
+		log.Printf("added URL %s to db", dbWatcherURL.URL)
 	}
-}
 
-func handleNewItems(newItemsChan <-chan []vintedApi.VintedItemResp, s *discordgo.Session, guildId string) {
-	for newItems := range newItemsChan {
-		if len(newItems) > 0 {
-
-			for item := range newItems {
-				embed := NewEmbed().
-					SetTitle(newItems[item].Title).
-					SetDescription(newItems[item].BrandTitle).
-					AddField("Price", newItems[item].Price.Amount).
-					AddField("URL", newItems[item].Url).
-					SetImage(newItems[item].Photo.Url).
-					MessageEmbed
-
-				_, err := s.ChannelMessageSendEmbed(guildId, embed)
-				if err != nil {
-					log.Printf("error sending message: %v", err)
-				}
-
-				log.Printf("new item posted to DC: %s", newItems[item].Title)
-			}
-		}
-	}
+	return id, err
 }
 
-func Run(botToken string, GuildID string) error {
-	if botToken != "" && !strings.HasPrefix(botToken, "Bot ") {
+// Creates the discordgo session, the "Bot " prefix is added to the token if missing.
+func newSession(botToken string) (*discordgo.Session, error) {
+	if botToken == "" {
+		return nil, fmt.Errorf("missing bot token")
+	}
+	if !strings.HasPrefix(botToken, "Bot ") {
 		botToken = "Bot " + botToken
-	} else {
-		log.Fatalf("invalid bot token: %s", botToken)
 	}
 
-	bot, err := discordgo.New(botToken)
+	return discordgo.New(botToken)
+}
+
+func Run(cfg Config) error {
+	manageRoleID = cfg.ManageRoleID
+
+	bot, err := newSession(cfg.Token)
 	if err != nil {
 		return err
 	}
 
+	// The handlers use the dispatcher and the agent, they are set before the first interaction
+	dispatcher := newDispatcher(bot, cfg)
+
+	// Shares the agent, the watchers and the outbox with Discord
+	var tg *telegram.Bot
+	if cfg.Telegram.Token != "" {
+		tg = telegram.New(cfg.Telegram)
+		dispatcher.Register(tg)
+	}
+	var app *slack.App
+	if cfg.Slack.BotToken != "" {
+		app = slack.New(cfg.Slack)
+		dispatcher.Register(app)
+	}
+	sinkSupported = dispatcher.Supports
+
+	watchAgent = agent.New(cfg.Agent)
+	events := watchAgent.Subscribe(48)
+
 	bot.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
 		log.Println("Bot is up!")
 	})
 	bot.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		if h, ok := commandHandlers[i.ApplicationCommandData().Name]; ok {
-			h(s, i)
+		switch i.Type {
+		case discordgo.InteractionApplicationCommand:
+			if h, ok := commandHandlers[i.ApplicationCommandData().Name]; ok {
+				h(s, i)
+			}
+		case discordgo.InteractionMessageComponent:
+			// The custom IDs are "<handler>:<argument>"
+			name, _, _ := strings.Cut(i.MessageComponentData().CustomID, ":")
+			if h, ok := componentHandlers[name]; ok {
+				h(s, i)
+			}
 		}
 	})
 
@@ -168,26 +456,123 @@ func Run(botToken string, GuildID string) error {
 	}
 	defer bot.Close()
 
-	createdCommands, err := bot.ApplicationCommandBulkOverwrite(bot.State.User.ID, "", commands)
+	for _, channelID := range cfg.DefaultChannelIDs {
+		if err := checkChannelPermissions(bot, channelID); err != nil {
+			return fmt.Errorf("invalid default channel: %v", err)
+		}
+	}
 
-	if err != nil {
-		log.Fatalf("cannot register commands: %v", err)
+	if len(commandScopes(cfg)) == 0 {
+		log.Println("no guild configured for the commands, set GUILD_ID or GLOBAL_COMMANDS")
 	}
 
-	newItemsChan := make(chan []vintedApi.VintedItemResp, 48)
-	go handleNewItems(newItemsChan, bot, GuildID)
-	go agent.Run(newItemsChan)
+	if err := syncCommands(bot, bot.State.User.ID, cfg); err != nil {
+		return fmt.Errorf("cannot register commands: %v", err)
+	}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
+	// docker stop sends SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	for _, cmd := range createdCommands {
-		err := bot.ApplicationCommandDelete(bot.State.User.ID, "", cmd.ID)
-		if err != nil {
-			log.Printf("cannot delete %q command: %v", cmd.Name, err)
-		}
+	// The outbox is delivered until the shutdown deadline, the rest is sent after the next start.
+	deliverCtx, cancelDeliver := context.WithCancel(context.Background())
+	defer cancelDeliver()
+
+	// The goroutines writing to the files, they are waited for before the files are flushed
+	var writers sync.WaitGroup
+	if tg != nil {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			tg.Run(ctx)
+		}()
+	}
+	if app != nil {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			if err := app.Run(ctx); err != nil {
+				log.Printf("error running the slack app: %v", err)
+			}
+		}()
 	}
 
+	marks := startMarkWorkers(bot, &writers)
+	draining := make(chan struct{})
+	receiverDone := make(chan struct{})
+	senderDone := make(chan struct{})
+	go func() {
+		handleEvents(events, dispatcher, cfg.DefaultChannelIDs, marks)
+		close(marks)
+		close(receiverDone)
+	}()
+	go func() {
+		dispatcher.Run(deliverCtx, draining)
+		close(senderDone)
+	}()
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		watchAgent.Run(ctx)
+	}()
+
+	// The commands stay registered, use UnregisterCommands to remove them.
+	<-ctx.Done()
+	stop()
+	log.Printf("shutting down, waiting up to %v for the pending items", cfg.ShutdownTimeout)
+
+	drainOutbox(cfg.ShutdownTimeout, shutdownGrace, receiverDone, senderDone, draining, cancelDeliver)
+	if !waitWriters(&writers, shutdownGrace) {
+		log.Println("shutdown deadline exceeded while writing the files, some changes may be lost")
+	}
+
+	db.Flush()
+	log.Println("bye")
+
 	return nil
 }
+
+// Waits for the writers for at most the timeout, returns false if they are still running.
+func waitWriters(writers *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		writers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Waits until the items of the agent are in the outbox and the outbox is delivered, for at most the
+// timeout. Then the sender is cancelled and gets the grace to finish the message in progress, so it
+// is not posted twice after the restart.
+func drainOutbox(timeout, grace time.Duration, receiverDone, senderDone <-chan struct{}, draining chan struct{}, cancelDeliver context.CancelFunc) {
+	deadline, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// The agent finishes the watchers in progress and closes the events channel, their items go to the outbox.
+	select {
+	case <-receiverDone:
+	case <-deadline.Done():
+		log.Println("shutdown deadline exceeded while the agent was running, some items may be lost")
+	}
+	close(draining)
+
+	select {
+	case <-senderDone:
+		return
+	case <-deadline.Done():
+	}
+
+	cancelDeliver()
+	select {
+	case <-senderDone:
+	case <-time.After(grace):
+	}
+	log.Println("shutdown deadline exceeded, the undelivered items are sent after the next start")
+}
@@ -0,0 +1,84 @@
+package discordBot
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDrainOutboxDeadline(t *testing.T) {
+	tests := []struct {
+		name         string
+		receiverDone bool
+	}{
+		{"agent stopped", true},
+		// The deadline passes while the agent's items are still enqueued
+		{"agent running", false},
+	}
+	for _, tt := range tests {
+		receiverDone := make(chan struct{})
+		if tt.receiverDone {
+			close(receiverDone)
+		}
+		// The sender never finishes
+		senderDone := make(chan struct{})
+		draining := make(chan struct{})
+		cancelled := false
+
+		done := make(chan struct{})
+		go func() {
+			drainOutbox(20*time.Millisecond, 10*time.Millisecond, receiverDone, senderDone, draining, func() { cancelled = true })
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: drainOutbox() did not return after the deadline", tt.name)
+		}
+		if !cancelled {
+			t.Errorf("%s: the delivery was not cancelled", tt.name)
+		}
+		select {
+		case <-draining:
+		default:
+			t.Errorf("%s: draining was not closed", tt.name)
+		}
+	}
+}
+
+func TestDrainOutboxDelivered(t *testing.T) {
+	receiverDone := make(chan struct{})
+	senderDone := make(chan struct{})
+	draining := make(chan struct{})
+	close(receiverDone)
+	close(senderDone)
+
+	cancelled := false
+	drainOutbox(time.Second, time.Second, receiverDone, senderDone, draining, func() { cancelled = true })
+	if cancelled {
+		t.Error("the delivered outbox was cancelled")
+	}
+}
+
+func TestWaitWriters(t *testing.T) {
+	var writers sync.WaitGroup
+	if !waitWriters(&writers, time.Millisecond) {
+		t.Error("waitWriters() = false without writers")
+	}
+
+	release := make(chan struct{})
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		<-release
+	}()
+	if waitWriters(&writers, 10*time.Millisecond) {
+		t.Error("waitWriters() = true while a writer runs")
+	}
+
+	close(release)
+	if !waitWriters(&writers, time.Second) {
+		t.Error("waitWriters() = false after the writer finished")
+	}
+}
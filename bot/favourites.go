@@ -0,0 +1,313 @@
+package discordBot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// Favourites shown on one page of /favourites.
+const favouritesPageSize = 10
+
+var (
+	minFavouritesPage = 1.0
+
+	favouritesCommand = &discordgo.ApplicationCommand{
+		Name:        "favourites",
+		Description: "Show the items you saved with the Favourite button, with their current price.",
+		Type:        discordgo.ChatApplicationCommand,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "page",
+				Description: fmt.Sprintf("Page of the list, %d items per page", favouritesPageSize),
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				MinValue:    &minFavouritesPage,
+			},
+			{
+				Name:        "remove",
+				Description: "ID of the item to remove from the favourites",
+				Type:        discordgo.ApplicationCommandOptionInteger,
+			},
+		},
+	}
+)
+
+// Saves the item of the notification to the favourites of the user.
+func handleFavourite(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	args := componentArgs(i)
+	if len(args) != 2 {
+		return
+	}
+
+	// Anyone seeing the item may save it
+	watcher, err := db.GetWatcher("", args[0])
+	if err != nil || watchAgent == nil {
+		respond(s, i, "the item cannot be saved now, try again later", true)
+		return
+	}
+
+	// The current price is fetched the same way as the details
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.Printf("error responding to interaction: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), detailsTimeout)
+	defer cancel()
+
+	params := &discordgo.WebhookParams{Flags: discordgo.MessageFlagsEphemeral}
+	params.Content = saveFavourite(ctx, interactionUserID(i), watcher, args[1])
+
+	if _, err := s.FollowupMessageCreate(i.Interaction, true, params); err != nil {
+		log.Printf("error confirming the favourite: %v", err)
+	}
+}
+
+// Fetches the item and adds it to the favourites of the user, returns the message for the user.
+func saveFavourite(ctx context.Context, userID string, watcher db.WatcherURL, itemID int) string {
+	detail, err := watchAgent.ItemDetail(ctx, watcher, itemID)
+	if errors.Is(err, vintedApi.ErrItemNotFound) {
+		return "the item was removed"
+	}
+	if err != nil {
+		log.Printf("error fetching item %d: %v", itemID, err)
+		return "the item could not be fetched, try again later"
+	}
+
+	price, err := currency.Parse(detail.Price.Amount, detail.Price.CurrencyCode)
+	if err != nil {
+		log.Printf("error parsing the price of item %d: %v", itemID, err)
+	}
+
+	now := time.Now()
+	added, err := db.AddFavourite("", db.Favourite{
+		UserID:     userID,
+		ItemID:     itemID,
+		URL:        watcher.URL,
+		Title:      detail.Title,
+		ItemURL:    detail.Url,
+		AddedPrice: price,
+		Price:      price,
+		Status:     detail.Status(),
+		AddedAt:    now,
+		CheckedAt:  now,
+	})
+	switch {
+	case errors.Is(err, db.ErrFavouritesFull):
+		return err.Error() + ", remove some with /favourites"
+	case err != nil:
+		log.Printf("error saving favourite item %d: %v", itemID, err)
+		return "the item could not be saved, try again later"
+	case !added:
+		return fmt.Sprintf("%s is already in your favourites", detail.Title)
+	}
+
+	log.Printf("item %d added to the favourites of %s", itemID, userID)
+	return fmt.Sprintf("%s was added to your favourites, see /favourites", detail.Title)
+}
+
+func handleFavourites(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := interactionUserID(i)
+
+	page := 1
+	note := ""
+	for _, opt := range i.ApplicationCommandData().Options {
+		switch opt.Name {
+		case "page":
+			page = int(opt.IntValue())
+		case "remove":
+			itemID := int(opt.IntValue())
+			removed, err := db.RemoveFavourite("", userID, itemID)
+			switch {
+			case err != nil:
+				log.Printf("error removing favourite item %d: %v", itemID, err)
+				respond(s, i, "the favourites could not be saved, try again later", true)
+				return
+			case removed:
+				note = fmt.Sprintf("item %d was removed from your favourites", itemID)
+			default:
+				note = fmt.Sprintf("item %d is not in your favourites", itemID)
+			}
+		}
+	}
+
+	data, ok := favouritesResponse(userID, page, note)
+	if !ok {
+		respond(s, i, "the favourites could not be loaded, try again later", true)
+		return
+	}
+	data.Flags = discordgo.MessageFlagsEphemeral
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("error responding to interaction: %v", err)
+	}
+}
+
+// Shows another page of the favourites, the custom ID is "favourites:<page>".
+func handleFavouritesPage(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	args := componentArgs(i)
+	if len(args) != 1 {
+		return
+	}
+
+	updateFavourites(s, i, args[0], "")
+}
+
+// Removes the item selected in the menu of the favourites, the custom ID is "unfavourite:<page>".
+func handleUnfavourite(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	args := componentArgs(i)
+	values := i.MessageComponentData().Values
+	if len(args) != 1 || len(values) != 1 {
+		return
+	}
+
+	userID := interactionUserID(i)
+	itemID, _ := strconv.Atoi(values[0])
+	if _, err := db.RemoveFavourite("", userID, itemID); err != nil {
+		log.Printf("error removing favourite item %d: %v", itemID, err)
+		respond(s, i, "the favourites could not be saved, try again later", true)
+		return
+	}
+
+	updateFavourites(s, i, args[0], fmt.Sprintf("item %d was removed from your favourites", itemID))
+}
+
+// Replaces the message of the component with the page of the favourites.
+func updateFavourites(s *discordgo.Session, i *discordgo.InteractionCreate, page int, note string) {
+	data, ok := favouritesResponse(interactionUserID(i), page, note)
+	if !ok {
+		respond(s, i, "the favourites could not be loaded, try again later", true)
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("error responding to interaction: %v", err)
+	}
+}
+
+// Returns the response with the page of the favourites of the user, ok is false if they could not be read.
+func favouritesResponse(userID string, page int, note string) (*discordgo.InteractionResponseData, bool) {
+	favourites, err := db.UserFavourites("", userID)
+	if err != nil {
+		log.Printf("error reading the favourites: %v", err)
+		return nil, false
+	}
+
+	return favouritesPage(favourites, page, note), true
+}
+
+// Returns the page of the favourites with the menu removing them and the buttons to the other pages.
+// The pages out of range show the closest one.
+func favouritesPage(favourites []db.Favourite, page int, note string) *discordgo.InteractionResponseData {
+	if len(favourites) == 0 {
+		content := "you have no favourites, save the items with their Favourite button"
+		if note != "" {
+			content = note + ", " + content
+		}
+		// The message may be an update, the old list must go
+		return &discordgo.InteractionResponseData{Content: content, Embeds: []*discordgo.MessageEmbed{}, Components: []discordgo.MessageComponent{}}
+	}
+
+	pages := (len(favourites) + favouritesPageSize - 1) / favouritesPageSize
+	page = min(max(page, 1), pages)
+	shown := favourites[(page-1)*favouritesPageSize : min(page*favouritesPageSize, len(favourites))]
+
+	embed := NewEmbed().
+		SetTitle("Favourites").
+		SetFooter(fmt.Sprintf("Page %d of %d · %d items", page, pages, len(favourites)))
+	var options []discordgo.SelectMenuOption
+	for _, f := range shown {
+		embed.AddField(truncateLabel(f.Title), describeFavourite(f))
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       truncateLabel(f.Title),
+			Value:       strconv.Itoa(f.ItemID),
+			Description: fmt.Sprintf("Item %d", f.ItemID),
+		})
+	}
+
+	return &discordgo.InteractionResponseData{
+		Content: note,
+		Embeds:  []*discordgo.MessageEmbed{embed.Truncate().MessageEmbed},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					MenuType:    discordgo.StringSelectMenu,
+					CustomID:    "unfavourite:" + strconv.Itoa(page),
+					Placeholder: "Remove from the favourites",
+					Options:     options,
+				},
+			}},
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Previous",
+					Style:    discordgo.SecondaryButton,
+					CustomID: "favourites:" + strconv.Itoa(page-1),
+					Disabled: page == 1,
+				},
+				discordgo.Button{
+					Label:    "Next",
+					Style:    discordgo.SecondaryButton,
+					CustomID: "favourites:" + strconv.Itoa(page+1),
+					Disabled: page == pages,
+				},
+			}},
+		},
+	}
+}
+
+// Describes the favourite in a line, e.g. "€25.00 (was €30.00) · Reserved · checked 5 minutes ago" with the link.
+func describeFavourite(f db.Favourite) string {
+	parts := []string{"price unknown"}
+	if !f.Price.IsZero() {
+		parts[0] = f.Price.Display()
+		if !f.AddedPrice.IsZero() && f.AddedPrice != f.Price {
+			parts[0] += fmt.Sprintf(" (was %s)", f.AddedPrice.Display())
+		}
+	}
+
+	status := "Available"
+	if label, ok := statusLabels[f.Status]; ok {
+		status = label
+	}
+	parts = append(parts, status)
+
+	if !f.CheckedAt.IsZero() {
+		parts = append(parts, fmt.Sprintf("checked <t:%d:R>", f.CheckedAt.Unix()))
+	}
+
+	return strings.Join(parts, " · ") + fmt.Sprintf("\n[Item %d](%s)", f.ItemID, f.ItemURL)
+}
+
+// Discord refuses the labels of the menu options longer than 100 characters.
+func truncateLabel(label string) string {
+	const maxLabelLength = 100
+	if label == "" {
+		return "Untitled item"
+	}
+	if runes := []rune(label); len(runes) > maxLabelLength {
+		return string(runes[:maxLabelLength-3]) + "..."
+	}
+
+	return label
+}
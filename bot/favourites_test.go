@@ -0,0 +1,54 @@
+package discordBot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestFavouritesPage(t *testing.T) {
+	var favourites []db.Favourite
+	for id := 1; id <= 23; id++ {
+		favourites = append(favourites, db.Favourite{ItemID: id, Title: "Jacket"})
+	}
+
+	// Out of range pages show the last one
+	data := favouritesPage(favourites, 9, "")
+	if len(data.Embeds) != 1 || len(data.Embeds[0].Fields) != 3 || data.Embeds[0].Footer.Text != "Page 3 of 3 · 23 items" {
+		t.Fatalf("last page = %+v", data.Embeds)
+	}
+
+	menu := data.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	if menu.CustomID != "unfavourite:3" || len(menu.Options) != 3 || menu.Options[0].Value != "21" {
+		t.Errorf("remove menu = %+v, want items 21 to 23", menu)
+	}
+
+	buttons := data.Components[1].(discordgo.ActionsRow).Components
+	previous, next := buttons[0].(discordgo.Button), buttons[1].(discordgo.Button)
+	if previous.CustomID != "favourites:2" || previous.Disabled || !next.Disabled {
+		t.Errorf("page buttons = %+v, %+v, want only the previous one enabled", previous, next)
+	}
+
+	if data := favouritesPage(nil, 1, ""); len(data.Embeds) != 0 || len(data.Components) != 0 {
+		t.Errorf("page of no favourites = %+v, want only the text", data)
+	}
+}
+
+func TestDescribeFavourite(t *testing.T) {
+	f := db.Favourite{
+		ItemID:     1,
+		ItemURL:    "https://www.vinted.sk/items/1-jacket",
+		AddedPrice: currency.Money{Amount: 3000, Currency: "EUR"},
+		Price:      currency.Money{Amount: 2500, Currency: "EUR"},
+		Status:     vintedApi.ItemReserved,
+	}
+
+	got := describeFavourite(f)
+	if !strings.HasPrefix(got, "€25.00 (was €30.00) · Reserved\n") || !strings.Contains(got, f.ItemURL) {
+		t.Errorf("describeFavourite() = %q", got)
+	}
+}
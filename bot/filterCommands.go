@@ -0,0 +1,252 @@
+package discordBot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/expr"
+)
+
+// Value of the text options clearing the rule.
+const clearValue = "-"
+
+var (
+	minFilterValue = 0.0
+	maxRatingStars = 5.0
+	maxDealScore   = 100.0
+
+	filterCommand = &discordgo.ApplicationCommand{
+		Name:        "filter",
+		Description: "Set the rules the new items of a watcher must pass, without rules shows the current ones.",
+		Type:        discordgo.ChatApplicationCommand,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Name:        "id",
+				Description: "ID of the watcher, see /list",
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Required:    true,
+			},
+			{
+				Name:        "include",
+				Description: "Comma separated keywords, the title or brand must contain one of them (- clears)",
+				Type:        discordgo.ApplicationCommandOptionString,
+			},
+			{
+				Name:        "exclude",
+				Description: "Comma separated keywords, the title or brand must contain none of them (- clears)",
+				Type:        discordgo.ApplicationCommandOptionString,
+			},
+			{
+				Name:        "include_regex",
+				Description: "Regular expression the title or brand must match (- clears)",
+				Type:        discordgo.ApplicationCommandOptionString,
+			},
+			{
+				Name:        "exclude_regex",
+				Description: "Regular expression the title or brand must not match (- clears)",
+				Type:        discordgo.ApplicationCommandOptionString,
+			},
+			{
+				Name:        "max_total_price",
+				Description: "Maximal price including the buyer protection fee in the watcher's currency (0 clears)",
+				Type:        discordgo.ApplicationCommandOptionNumber,
+				MinValue:    &minFilterValue,
+			},
+			{
+				Name:        "min_rating",
+				Description: "Minimal seller rating in stars (0 clears)",
+				Type:        discordgo.ApplicationCommandOptionNumber,
+				MinValue:    &minFilterValue,
+				MaxValue:    maxRatingStars,
+			},
+			{
+				Name:        "min_deal_score",
+				Description: "Minimal percent below the typical price (0 clears)",
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				MinValue:    &minFilterValue,
+				MaxValue:    maxDealScore,
+			},
+			{
+				Name:        "conditions",
+				Description: "Comma separated: new_with_tags, new_without_tags, very_good, good, satisfactory (- clears)",
+				Type:        discordgo.ApplicationCommandOptionString,
+			},
+			{
+				Name:        "exclude_promoted",
+				Description: "Skip the promoted items",
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+			},
+			{
+				Name:        "block_sellers",
+				Description: "Comma separated seller IDs or logins to skip (- clears)",
+				Type:        discordgo.ApplicationCommandOptionString,
+			},
+			{
+				Name:        "expression",
+				Description: "Condition like: title contains \"gore-tex\" and price < 40 (- clears)",
+				Type:        discordgo.ApplicationCommandOptionString,
+				MaxLength:   expr.MaxLength,
+			},
+			{
+				Name:        "clear",
+				Description: "Remove all rules before applying the given ones",
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+			},
+		},
+	}
+)
+
+func handleFilter(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	watcher, ok := loadManagedWatcher(s, i)
+	if !ok {
+		return
+	}
+
+	options := i.ApplicationCommandData().Options
+	if len(options) == 1 {
+		respond(s, i, fmt.Sprintf("watcher %d: %s", watcher.ID, describeFilters(watcher.Filters)), true)
+		return
+	}
+
+	filters := applyFilterOptions(watcher.Filters, options)
+	if err := agent.ValidateFilters(filters); err != nil {
+		respond(s, i, truncateMessage(describeFilterError(filters, err)), true)
+		return
+	}
+
+	watcher.Filters = filters
+	if err := db.UpdateWatcher("", watcher); err != nil {
+		log.Printf("error updating watcher %d: %v", watcher.ID, err)
+		respond(s, i, "the watcher could not be saved, try again later", true)
+		return
+	}
+
+	log.Printf("filters of watcher %d changed by %s", watcher.ID, interactionUserID(i))
+	respond(s, i, truncateMessage(fmt.Sprintf("watcher %d: %s", watcher.ID, describeFilters(watcher.Filters))), true)
+}
+
+// Returns the filters with the given options applied.
+func applyFilterOptions(filters db.Filters, options []*discordgo.ApplicationCommandInteractionDataOption) db.Filters {
+	for _, opt := range options {
+		if opt.Name == "clear" && opt.BoolValue() {
+			filters = db.Filters{}
+		}
+	}
+
+	for _, opt := range options {
+		switch opt.Name {
+		case "include":
+			filters.IncludeKeywords = splitList(opt.StringValue())
+		case "exclude":
+			filters.ExcludeKeywords = splitList(opt.StringValue())
+		case "include_regex":
+			filters.IncludeRegex = clearable(opt.StringValue())
+		case "exclude_regex":
+			filters.ExcludeRegex = clearable(opt.StringValue())
+		case "max_total_price":
+			filters.MaxTotalPrice = opt.FloatValue()
+		case "min_rating":
+			filters.MinSellerRating = opt.FloatValue()
+		case "min_deal_score":
+			filters.MinDealScore = int(opt.IntValue())
+		case "conditions":
+			filters.Conditions = splitList(strings.ToLower(opt.StringValue()))
+		case "exclude_promoted":
+			filters.ExcludePromoted = opt.BoolValue()
+		case "block_sellers":
+			filters.BlockedSellers = splitList(opt.StringValue())
+		case "expression":
+			filters.Expression = clearable(opt.StringValue())
+		}
+	}
+
+	return filters
+}
+
+// Splits the comma separated option value, clearValue gives an empty list.
+func splitList(value string) []string {
+	var result []string
+	for _, v := range strings.Split(clearable(value), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func clearable(value string) string {
+	value = strings.TrimSpace(value)
+	if value == clearValue {
+		return ""
+	}
+
+	return value
+}
+
+func describeFilters(f db.Filters) string {
+	var rules []string
+	if len(f.IncludeKeywords) > 0 {
+		rules = append(rules, "includes one of "+strings.Join(f.IncludeKeywords, ", "))
+	}
+	if len(f.ExcludeKeywords) > 0 {
+		rules = append(rules, "excludes "+strings.Join(f.ExcludeKeywords, ", "))
+	}
+	if f.IncludeRegex != "" {
+		rules = append(rules, "matches `"+f.IncludeRegex+"`")
+	}
+	if f.ExcludeRegex != "" {
+		rules = append(rules, "does not match `"+f.ExcludeRegex+"`")
+	}
+	if f.MaxTotalPrice > 0 {
+		rules = append(rules, "total price up to "+strconv.FormatFloat(f.MaxTotalPrice, 'f', -1, 64))
+	}
+	if f.MinSellerRating > 0 {
+		rules = append(rules, "seller rating at least "+strconv.FormatFloat(f.MinSellerRating, 'f', -1, 64)+"★")
+	}
+	if f.MinDealScore > 0 {
+		rules = append(rules, fmt.Sprintf("at least %d%% below typical price", f.MinDealScore))
+	}
+	if len(f.Conditions) > 0 {
+		rules = append(rules, "condition "+strings.Join(f.Conditions, ", "))
+	}
+	if f.ExcludePromoted {
+		rules = append(rules, "no promoted items")
+	}
+	if len(f.BlockedSellers) > 0 {
+		rules = append(rules, "blocked sellers "+strings.Join(f.BlockedSellers, ", "))
+	}
+
+	if f.Expression != "" {
+		rules = append(rules, "`"+f.Expression+"`")
+	}
+
+	if len(rules) == 0 {
+		return "no rules, every item of the chosen sellers is posted"
+	}
+
+	return strings.Join(rules, "; ")
+}
+
+// Explains why the rules were not saved, the errors in the expression are pointed at.
+func describeFilterError(filters db.Filters, err error) string {
+	var exprErr *expr.Error
+	if !errors.As(err, &exprErr) {
+		return fmt.Sprintf("the rules were not saved: %v", err)
+	}
+
+	// The expression is shown in a code block, the backticks would end it
+	source := strings.ReplaceAll(filters.Expression, "`", "'")
+	caret := strings.Repeat(" ", exprErr.Column()-1) + "^"
+
+	return fmt.Sprintf("the rules were not saved, the expression is invalid at column %d: %s\n```\n%s\n%s\n```\n"+
+		"Fields: %s", exprErr.Column(), exprErr.Msg, source, caret, strings.Join(slices.Sorted(maps.Keys(agent.ItemFields)), ", "))
+}
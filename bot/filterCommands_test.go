@@ -0,0 +1,76 @@
+package discordBot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/db"
+)
+
+func TestApplyFilterOptions(t *testing.T) {
+	option := func(name string, optType discordgo.ApplicationCommandOptionType, value any) *discordgo.ApplicationCommandInteractionDataOption {
+		return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: optType, Value: value}
+	}
+	current := db.Filters{IncludeKeywords: []string{"nike"}, ExcludeRegex: "kids", MaxTotalPrice: 30}
+
+	tests := []struct {
+		name    string
+		options []*discordgo.ApplicationCommandInteractionDataOption
+		want    db.Filters
+	}{
+		{
+			name: "set",
+			options: []*discordgo.ApplicationCommandInteractionDataOption{
+				option("exclude", discordgo.ApplicationCommandOptionString, "fake, replica ,"),
+				option("conditions", discordgo.ApplicationCommandOptionString, "Very_Good,good"),
+				option("min_rating", discordgo.ApplicationCommandOptionNumber, 4.5),
+			},
+			want: db.Filters{
+				IncludeKeywords: []string{"nike"},
+				ExcludeKeywords: []string{"fake", "replica"},
+				ExcludeRegex:    "kids",
+				MaxTotalPrice:   30,
+				MinSellerRating: 4.5,
+				Conditions:      []string{"very_good", "good"},
+			},
+		},
+		{
+			name: "clear single rules",
+			options: []*discordgo.ApplicationCommandInteractionDataOption{
+				option("include", discordgo.ApplicationCommandOptionString, "-"),
+				option("exclude_regex", discordgo.ApplicationCommandOptionString, "-"),
+			},
+			want: db.Filters{MaxTotalPrice: 30},
+		},
+		{
+			name: "clear all",
+			options: []*discordgo.ApplicationCommandInteractionDataOption{
+				option("exclude_promoted", discordgo.ApplicationCommandOptionBoolean, true),
+				option("clear", discordgo.ApplicationCommandOptionBoolean, true),
+			},
+			want: db.Filters{ExcludePromoted: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyFilterOptions(current, tt.options); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyFilterOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeFilterError(t *testing.T) {
+	filters := db.Filters{Expression: "price < `40`"}
+	err := agent.ValidateFilters(db.Filters{Expression: `price < "40"`})
+
+	want := "the rules were not saved, the expression is invalid at column 7: " +
+		"< needs numbers on both sides, got number and string\n```\nprice < '40'\n      ^\n```\nFields: "
+	if got := describeFilterError(filters, err); !strings.HasPrefix(got, want) {
+		t.Errorf("describeFilterError() = %q, want prefix %q", got, want)
+	}
+}
@@ -0,0 +1,296 @@
+package discordBot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+const (
+	snoozeDuration = time.Hour
+	// Only the latest tracked items of a watcher are kept.
+	maxTrackedItems = 50
+	// Time for fetching the item details.
+	detailsTimeout = 30 * time.Second
+)
+
+// Returns the buttons under the message with the single item of the entry.
+func itemButtons(entry db.OutboxEntry) discordgo.ActionsRow {
+	watcher := strconv.Itoa(entry.WatcherID)
+	item := strconv.Itoa(entry.Item.ID)
+
+	return discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+		discordgo.Button{
+			Label:    "Hide seller",
+			Style:    discordgo.SecondaryButton,
+			CustomID: "hideseller:" + watcher + ":" + strconv.Itoa(entry.Item.User.ID),
+			Disabled: entry.Item.User.ID == 0,
+		},
+		discordgo.Button{
+			Label:    "Snooze watcher 1h",
+			Style:    discordgo.SecondaryButton,
+			CustomID: "snooze:" + watcher,
+		},
+		discordgo.Button{
+			Label:    "Track price",
+			Style:    discordgo.SecondaryButton,
+			CustomID: "track:" + watcher + ":" + item,
+		},
+		discordgo.Button{
+			Label:    "Favourite",
+			Style:    discordgo.SecondaryButton,
+			CustomID: "favourite:" + watcher + ":" + item,
+		},
+		discordgo.Button{
+			Label:    "Details",
+			Style:    discordgo.PrimaryButton,
+			CustomID: "details:" + watcher + ":" + item,
+		},
+	}}
+}
+
+// Returns the menus under the message with several items, one per action of the buttons with an
+// option per item, so the 10 embeds of a message fit in the 5 rows Discord allows. The custom ID
+// of a menu is the name of the handler, the arguments are the value of the chosen option.
+func itemMenus(entries []db.OutboxEntry) []discordgo.MessageComponent {
+	actions := []struct {
+		name        string
+		placeholder string
+		// Returns the value of the option for the entry, "" if the action does not apply.
+		value func(entry db.OutboxEntry) string
+	}{
+		{"hideseller", "Hide seller", func(entry db.OutboxEntry) string {
+			if entry.Item.User.ID == 0 {
+				return ""
+			}
+			return fmt.Sprintf("%d:%d", entry.WatcherID, entry.Item.User.ID)
+		}},
+		{"snooze", "Snooze watcher 1h", func(entry db.OutboxEntry) string {
+			return strconv.Itoa(entry.WatcherID)
+		}},
+		{"track", "Track price", itemValue},
+		{"favourite", "Favourite", itemValue},
+		{"details", "Details", itemValue},
+	}
+
+	var rows []discordgo.MessageComponent
+	for _, action := range actions {
+		var options []discordgo.SelectMenuOption
+		// Discord refuses the same value twice, e.g. the items of the same watcher for snoozing
+		seen := make(map[string]bool)
+		for n, entry := range entries {
+			value := action.value(entry)
+			if value == "" || seen[value] {
+				continue
+			}
+			seen[value] = true
+			options = append(options, discordgo.SelectMenuOption{
+				Label: truncateLabel(fmt.Sprintf("%d · %s", n+1, entry.Item.Title)),
+				Value: value,
+			})
+		}
+		if len(options) == 0 {
+			continue
+		}
+
+		rows = append(rows, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:    discordgo.StringSelectMenu,
+				CustomID:    action.name,
+				Placeholder: action.placeholder,
+				Options:     options,
+			},
+		}})
+	}
+
+	return rows
+}
+
+func itemValue(entry db.OutboxEntry) string {
+	return fmt.Sprintf("%d:%d", entry.WatcherID, entry.Item.ID)
+}
+
+// Returns the numbers after the prefix of the custom ID, e.g. "track:3:123" -> [3 123]. The menus of
+// itemMenus carry them in the chosen option, e.g. "track" with "3:123".
+func componentArgs(i *discordgo.InteractionCreate) []int {
+	data := i.MessageComponentData()
+	_, rest, found := strings.Cut(data.CustomID, ":")
+	if !found && len(data.Values) == 1 {
+		rest = data.Values[0]
+	}
+
+	var args []int
+	for _, arg := range strings.Split(rest, ":") {
+		n, _ := strconv.Atoi(arg)
+		args = append(args, n)
+	}
+
+	return args
+}
+
+// Loads the watcher of the button, responds and returns false if the user may not manage it.
+func loadButtonWatcher(s *discordgo.Session, i *discordgo.InteractionCreate, id int) (db.WatcherURL, bool) {
+	watcher, err := db.GetWatcher("", id)
+	if err != nil || !canManage(i, watcher) {
+		respond(s, i, fmt.Sprintf("there is no watcher %d you could manage", id), true)
+		return db.WatcherURL{}, false
+	}
+
+	return watcher, true
+}
+
+// Saves the watcher changed by a button and confirms it to the user.
+func saveButtonWatcher(s *discordgo.Session, i *discordgo.InteractionCreate, watcher db.WatcherURL, confirmation string) {
+	if err := db.UpdateWatcher("", watcher); err != nil {
+		log.Printf("error updating watcher %d: %v", watcher.ID, err)
+		respond(s, i, "the watcher could not be saved, try again later", true)
+		return
+	}
+
+	log.Printf("watcher %d: %s by %s", watcher.ID, confirmation, interactionUserID(i))
+	respond(s, i, confirmation, true)
+}
+
+// Adds the seller of the item to the blocked sellers of the watcher.
+func handleHideSeller(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	args := componentArgs(i)
+	if len(args) != 2 {
+		return
+	}
+
+	watcher, ok := loadButtonWatcher(s, i, args[0])
+	if !ok {
+		return
+	}
+
+	seller := strconv.Itoa(args[1])
+	if !slices.Contains(watcher.Filters.BlockedSellers, seller) {
+		watcher.Filters.BlockedSellers = append(watcher.Filters.BlockedSellers, seller)
+	}
+
+	saveButtonWatcher(s, i, watcher, fmt.Sprintf("the items of seller %s are hidden from watcher %d", seller, watcher.ID))
+}
+
+// Stops the notifications of the watcher for an hour.
+func handleSnooze(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	args := componentArgs(i)
+	if len(args) != 1 {
+		return
+	}
+
+	watcher, ok := loadButtonWatcher(s, i, args[0])
+	if !ok {
+		return
+	}
+
+	watcher.SnoozedUntil = time.Now().Add(snoozeDuration)
+	saveButtonWatcher(s, i, watcher, fmt.Sprintf("watcher %d is snoozed until <t:%d:t>", watcher.ID, watcher.SnoozedUntil.Unix()))
+}
+
+// Reports the price drops of the item by the watcher, even if the watcher does not report them otherwise.
+func handleTrackPrice(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	args := componentArgs(i)
+	if len(args) != 2 {
+		return
+	}
+
+	watcher, ok := loadButtonWatcher(s, i, args[0])
+	if !ok {
+		return
+	}
+
+	if !slices.Contains(watcher.TrackedItems, args[1]) {
+		watcher.TrackedItems = append(watcher.TrackedItems, args[1])
+		if len(watcher.TrackedItems) > maxTrackedItems {
+			watcher.TrackedItems = watcher.TrackedItems[len(watcher.TrackedItems)-maxTrackedItems:]
+		}
+	}
+	// The item may leave the search results, its price is checked on its own then
+	if watchAgent != nil {
+		watchAgent.TrackItem(watcher, args[1])
+	}
+
+	saveButtonWatcher(s, i, watcher, fmt.Sprintf("watcher %d reports the price drops of item %d", watcher.ID, args[1]))
+}
+
+// Fetches the current detail of the item and shows it only to the user.
+func handleDetails(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	args := componentArgs(i)
+	if len(args) != 2 {
+		return
+	}
+
+	// Anyone seeing the item may look at it
+	watcher, err := db.GetWatcher("", args[0])
+	if err != nil || watchAgent == nil {
+		respond(s, i, "the item details are not available", true)
+		return
+	}
+
+	// The detail may wait for the requests of the agent to the same host
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.Printf("error responding to interaction: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), detailsTimeout)
+	defer cancel()
+
+	params := &discordgo.WebhookParams{Flags: discordgo.MessageFlagsEphemeral}
+	detail, err := watchAgent.ItemDetail(ctx, watcher, args[1])
+	switch {
+	case errors.Is(err, vintedApi.ErrItemNotFound):
+		params.Content = "the item was removed"
+	case err != nil:
+		log.Printf("error fetching item %d: %v", args[1], err)
+		params.Content = "the item details could not be fetched, try again later"
+	default:
+		params.Embeds = []*discordgo.MessageEmbed{detailsEmbed(detail)}
+	}
+
+	if _, err := s.FollowupMessageCreate(i.Interaction, true, params); err != nil {
+		log.Printf("error sending the item details: %v", err)
+	}
+}
+
+// Returns the embed with the current detail of the item.
+func detailsEmbed(detail *vintedApi.VintedItemDetail) *discordgo.MessageEmbed {
+	status := "Available"
+	if label, ok := statusLabels[detail.Status()]; ok {
+		status = label
+	}
+
+	embed := NewEmbed().
+		SetTitle(detail.Title).
+		SetURL(detail.Url).
+		SetDescription(detail.Description).
+		AddField("Status", status).
+		AddField("Price", strings.TrimSpace(detail.Price.Amount+" "+detail.Price.CurrencyCode))
+	if detail.Condition != "" {
+		embed.AddField("Condition", detail.Condition)
+	}
+	if detail.SizeTitle != "" {
+		embed.AddField("Size", detail.SizeTitle)
+	}
+	embed.AddField("Views", strconv.Itoa(detail.ViewCount)).
+		AddField("Favourites", strconv.Itoa(detail.FavouriteCount)).
+		InlineAllFields()
+	if _, ok := statusLabels[detail.Status()]; ok {
+		embed.SetColor(unavailableColor)
+	}
+
+	return embed.Truncate().MessageEmbed
+}
@@ -0,0 +1,122 @@
+package discordBot
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestItemButtons(t *testing.T) {
+	entry := db.OutboxEntry{WatcherID: 3, Item: vintedApi.VintedItemResp{ID: 123, User: vintedApi.VintedUser{ID: 7}}}
+
+	row := itemButtons(entry)
+
+	want := []string{"hideseller:3:7", "snooze:3", "track:3:123", "favourite:3:123", "details:3:123"}
+	for n, component := range row.Components {
+		button := component.(discordgo.Button)
+		if n >= len(want) || button.CustomID != want[n] {
+			t.Errorf("button %d custom ID = %q, want one of %v", n, button.CustomID, want)
+		}
+	}
+	if len(row.Components) != len(want) {
+		t.Errorf("row has %d buttons, want %d", len(row.Components), len(want))
+	}
+}
+
+func TestComponentArgs(t *testing.T) {
+	i := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type: discordgo.InteractionMessageComponent,
+		Data: discordgo.MessageComponentInteractionData{CustomID: "track:3:123"},
+	}}
+
+	if got := componentArgs(i); !slices.Equal(got, []int{3, 123}) {
+		t.Errorf("componentArgs() = %v, want [3 123]", got)
+	}
+
+	// The arguments of a menu are in the chosen option
+	i.Data = discordgo.MessageComponentInteractionData{CustomID: "track", Values: []string{"3:123"}}
+	if got := componentArgs(i); !slices.Equal(got, []int{3, 123}) {
+		t.Errorf("componentArgs() of a menu = %v, want [3 123]", got)
+	}
+}
+
+func TestItemMenus(t *testing.T) {
+	var entries []db.OutboxEntry
+	for id := 1; id <= 10; id++ {
+		entries = append(entries, db.OutboxEntry{WatcherID: 3, Item: vintedApi.VintedItemResp{ID: id, Title: "Jacket", User: vintedApi.VintedUser{ID: 7}}})
+	}
+
+	rows := itemMenus(entries)
+
+	// The items share the watcher and the seller, their menus have one option
+	want := map[string]int{"hideseller": 1, "snooze": 1, "track": 10, "favourite": 10, "details": 10}
+	if len(rows) != len(want) {
+		t.Fatalf("itemMenus() has %d rows, want %d", len(rows), len(want))
+	}
+	for _, row := range rows {
+		menu := row.(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+		if len(menu.Options) != want[menu.CustomID] {
+			t.Errorf("menu %q has %d options, want %d", menu.CustomID, len(menu.Options), want[menu.CustomID])
+		}
+	}
+	menu := rows[2].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	if option := menu.Options[9]; option.Value != "3:10" || option.Label[:2] != "10" {
+		t.Errorf("last option of %q = %+v, want item 10", menu.CustomID, option)
+	}
+}
+
+func TestTrackPriceDropDelivered(t *testing.T) {
+	// The handlers use the default files in the working directory
+	t.Chdir(t.TempDir())
+	id, err := db.AppendWatcher("", db.WatcherURL{URL: "https://www.vinted.sk/catalog?search_text=jacket", OwnerID: "u1", ChannelID: "c1", Platform: db.PlatformDiscord})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := discordgo.New("Bot token")
+	s.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusNoContent, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})}
+
+	handleTrackPrice(s, &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type: discordgo.InteractionMessageComponent,
+		User: &discordgo.User{ID: "u1"},
+		Data: discordgo.MessageComponentInteractionData{CustomID: "track:" + strconv.Itoa(id) + ":10"},
+	}})
+
+	watcher, err := db.GetWatcher("", id)
+	if err != nil || !slices.Contains(watcher.TrackedItems, 10) {
+		t.Fatalf("watcher after the Track price button = %+v, %v", watcher, err)
+	}
+
+	// The drop the status check found for the tracked item
+	events := make(chan agent.Event, 1)
+	events <- agent.Event{
+		Type:     agent.EventPriceDropped,
+		Watcher:  watcher,
+		Item:     vintedApi.VintedItemResp{ID: 10, Title: "Kabát"},
+		Price:    currency.Money{Amount: 2500, Currency: "EUR"},
+		OldPrice: currency.Money{Amount: 3000, Currency: "EUR"},
+	}
+	close(events)
+	handleEvents(events, notify.NewDispatcher(""), nil, nil)
+
+	due, err := db.DueOutboxEntries("", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].Kind != db.OutboxPriceDrop || due[0].Item.ID != 10 || due[0].ChannelID != "c1" || due[0].OldPrice.Amount != 3000 {
+		t.Errorf("outbox = %+v, want the price drop of item 10 for channel c1", due)
+	}
+}
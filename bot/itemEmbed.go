@@ -0,0 +1,110 @@
+package discordBot
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+)
+
+// Colours of the watchers without own colour, picked by the watcher ID.
+var watcherColors = []int{0x09B1BA, 0xE67E22, 0x9B59B6, 0x2ECC71, 0xE91E63, 0x3498DB, 0xF1C40F, 0x1ABC9C}
+
+// Returns the embed of the item of the entry: the title links to the item, the seller is the author
+// and the footer names the watcher.
+func itemEmbed(entry db.OutboxEntry) *discordgo.MessageEmbed {
+	item := entry.Item
+	embed := NewEmbed().
+		SetTitle(notify.Headline(entry)).
+		SetURL(item.Url).
+		SetDescription(item.BrandTitle).
+		SetColor(entry.Color).
+		AddField("Price", notify.SymbolPriceText(entry))
+	if !entry.TotalPrice.IsZero() && entry.TotalPrice != entry.Price {
+		embed.AddField("Total incl. fees", entry.TotalPrice.Display())
+	}
+	if item.SizeTitle != "" {
+		embed.AddField("Size", item.SizeTitle)
+	}
+	if item.Status != "" {
+		embed.AddField("Condition", item.Status)
+	}
+	embed.InlineAllFields()
+	if deal := notify.DealText(entry); deal != "" {
+		embed.AddField("Deal", deal)
+	}
+
+	if item.User.Login != "" {
+		author := item.User.Login
+		if entry.SellerRating > 0 {
+			author += fmt.Sprintf(" · %.1f★", entry.SellerRating)
+		}
+		embed.SetAuthor(author, "", memberURL(item.Url, item.User.ID))
+	}
+	if entry.WatcherName != "" {
+		embed.SetFooter(entry.WatcherName)
+	}
+
+	listedAt := item.ListedAt()
+	if listedAt.IsZero() {
+		listedAt = entry.CreatedAt
+	}
+	if !listedAt.IsZero() {
+		embed.Timestamp = listedAt.Format(time.RFC3339)
+	}
+
+	embed.SetImage(item.Photo.Url)
+
+	// Long titles or descriptions must not fail the whole message
+	return embed.Truncate().MessageEmbed
+}
+
+// Returns the profile of the seller on the site of the item, "" if it is not known.
+func memberURL(itemURL string, sellerID int) string {
+	parsed, err := url.Parse(itemURL)
+	if err != nil || parsed.Host == "" || sellerID == 0 {
+		return ""
+	}
+
+	return parsed.Scheme + "://" + parsed.Host + "/member/" + strconv.Itoa(sellerID)
+}
+
+// Returns the colour of the embeds of the watcher, its own or one picked by its ID.
+func watcherColor(watcher db.WatcherURL) int {
+	if color, err := parseColor(watcher.Color); err == nil && watcher.Color != "" {
+		return color
+	}
+
+	return watcherColors[watcher.ID%len(watcherColors)]
+}
+
+// Parses the colour like "#FF8800" or "ff8800".
+func parseColor(s string) (int, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	color, err := strconv.ParseUint(hex, 16, 24)
+	if err != nil || len(hex) != 6 {
+		return 0, fmt.Errorf("invalid colour %q, use e.g. #FF8800", s)
+	}
+
+	return int(color), nil
+}
+
+// Names the watcher in the footers, e.g. "Watcher 3 · gore-tex jacket".
+func watcherName(watcher db.WatcherURL) string {
+	name := fmt.Sprintf("Watcher %d", watcher.ID)
+
+	parsed, err := url.Parse(watcher.URL)
+	if err != nil {
+		return name
+	}
+	if search := parsed.Query().Get("search_text"); search != "" {
+		name += " · " + search
+	}
+
+	return name
+}
@@ -0,0 +1,73 @@
+package discordBot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestItemEmbed(t *testing.T) {
+	item := vintedApi.VintedItemResp{
+		ID:         1,
+		Title:      strings.Repeat("Gore-Tex Jacket ", 30),
+		BrandTitle: "Arc'teryx",
+		Url:        "https://www.vinted.sk/items/1-jacket",
+		Price:      vintedApi.VintedPrice{Amount: "30.0", CurrencyCode: "EUR"},
+		SizeTitle:  "M",
+		Status:     "Very good",
+		User:       vintedApi.VintedUser{ID: 7, Login: "anna"},
+	}
+	item.Photo.HighResolution.Timestamp = 1760000000
+	entry := db.OutboxEntry{
+		Item:         item,
+		Price:        currency.Money{Amount: 3000, Currency: "EUR"},
+		TotalPrice:   currency.Money{Amount: 3220, Currency: "EUR"},
+		SellerRating: 4.84,
+		WatcherName:  "Watcher 3 · gore-tex",
+		Color:        0xE67E22,
+	}
+
+	embed := itemEmbed(entry)
+
+	if len(embed.Title) > EmbedLimitTitle || embed.URL != item.Url || embed.Color != 0xE67E22 {
+		t.Errorf("embed title %d characters, url %q, color %x", len(embed.Title), embed.URL, embed.Color)
+	}
+	if embed.Author == nil || embed.Author.Name != "anna · 4.8★" || embed.Author.URL != "https://www.vinted.sk/member/7" {
+		t.Errorf("embed author = %+v, want the seller with the rating", embed.Author)
+	}
+	if embed.Footer == nil || embed.Footer.Text != "Watcher 3 · gore-tex" {
+		t.Errorf("embed footer = %+v, want the watcher", embed.Footer)
+	}
+	if embed.Timestamp != time.Unix(1760000000, 0).Format(time.RFC3339) {
+		t.Errorf("embed timestamp = %q, want the listing time", embed.Timestamp)
+	}
+
+	want := map[string]string{"Price": "€30.00", "Total incl. fees": "€32.20", "Size": "M", "Condition": "Very good"}
+	for _, field := range embed.Fields {
+		if value, ok := want[field.Name]; !ok || value != field.Value || !field.Inline {
+			t.Errorf("embed field %+v, want one of %v inline", field, want)
+		}
+	}
+	if len(embed.Fields) != len(want) {
+		t.Errorf("embed has %d fields, want %d", len(embed.Fields), len(want))
+	}
+}
+
+func TestWatcherColor(t *testing.T) {
+	if got := watcherColor(db.WatcherURL{ID: 1, Color: "#ff8800"}); got != 0xFF8800 {
+		t.Errorf("watcherColor() of own colour = %x", got)
+	}
+	if got := watcherColor(db.WatcherURL{ID: 9}); got != watcherColors[1] {
+		t.Errorf("watcherColor() by the ID = %x, want %x", got, watcherColors[1])
+	}
+
+	for _, invalid := range []string{"orange", "#ff88", "#ff88000"} {
+		if _, err := parseColor(invalid); err == nil {
+			t.Errorf("parseColor(%q) = nil error", invalid)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package discordBot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+)
+
+const (
+	// Wait after a 429 response without the Retry-After header.
+	defaultRetryAfter = 5 * time.Second
+	// Limits of a single message.
+	maxMessageEmbeds     = 10
+	maxMessageEmbedChars = 6000
+)
+
+// Posts the outbox entries of the Discord sink as embeds.
+type discordNotifier struct {
+	s *discordgo.Session
+	// Item statuses the messages are recorded in, "" is the default file.
+	statusFilePath string
+}
+
+func (n *discordNotifier) Name() string {
+	return notify.SinkDiscord
+}
+
+func (n *discordNotifier) Notify(ctx context.Context, entry db.OutboxEntry) error {
+	return n.NotifyBatch(ctx, []db.OutboxEntry{entry})[0]
+}
+
+// Posts the entries of one channel or DM as item embeds with their buttons, or with the menus of
+// the items in the messages with several, up to 10 items and 6000 characters per message.
+// A rate limit stops the batch, the entries not posted yet wait for the time Discord asks for.
+func (n *discordNotifier) NotifyBatch(ctx context.Context, entries []db.OutboxEntry) []error {
+	errs := make([]error, len(entries))
+	if len(entries) == 0 {
+		return errs
+	}
+
+	channelID, err := n.channelID(entries[0])
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	embeds := make([]*discordgo.MessageEmbed, len(entries))
+	for i, entry := range entries {
+		embeds[i] = itemEmbed(entry)
+	}
+
+	first := 0
+	for _, size := range batchSizes(embeds, maxMessageEmbeds) {
+		batch := entries[first : first+size]
+
+		rows := []discordgo.MessageComponent{itemButtons(batch[0])}
+		if size > 1 {
+			rows = itemMenus(batch)
+		}
+
+		// Rate limits are retried through the outbox, so the sender does not block on a single channel.
+		msg, err := n.s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Embeds: embeds[first : first+size], Components: rows},
+			discordgo.WithRetryOnRatelimit(false), discordgo.WithContext(ctx))
+		if err != nil {
+			err = discordError(err)
+			var retryAfter *notify.RetryAfterError
+			if errors.As(err, &retryAfter) {
+				for i := first; i < len(entries); i++ {
+					errs[i] = err
+				}
+				return errs
+			}
+
+			for i := range batch {
+				errs[first+i] = err
+			}
+			first += size
+			continue
+		}
+
+		// The messages are marked when the items are sold, if their status is checked
+		for i, entry := range batch {
+			message := db.ItemMessage{WatcherID: entry.WatcherID, ChannelID: msg.ChannelID, MessageID: msg.ID, Embed: i}
+			err := db.AddItemMessage(n.statusFilePath, entry.Item.ID, message)
+			if err != nil && !errors.Is(err, db.ErrItemNotTracked) {
+				log.Printf("error storing the message of item %d: %v", entry.Item.ID, err)
+			}
+		}
+		first += size
+	}
+
+	return errs
+}
+
+// Returns the channel the entry is posted to, the DM channel of its user if set.
+func (n *discordNotifier) channelID(entry db.OutboxEntry) (string, error) {
+	if entry.UserID == "" {
+		return entry.ChannelID, nil
+	}
+
+	channel, err := n.s.UserChannelCreate(entry.UserID)
+	if err != nil {
+		return "", discordError(fmt.Errorf("error creating DM channel: %w", err))
+	}
+
+	return channel.ID, nil
+}
+
+// Returns the sizes of the messages the embeds are split into, in order. A message holds at most
+// maxEmbeds embeds (up to maxMessageEmbeds) with at most maxMessageEmbedChars characters together.
+func batchSizes(embeds []*discordgo.MessageEmbed, maxEmbeds int) []int {
+	maxEmbeds = min(maxEmbeds, maxMessageEmbeds)
+
+	var sizes []int
+	count, chars := 0, 0
+	for _, embed := range embeds {
+		length := embedLength(embed)
+		if count > 0 && (count == maxEmbeds || chars+length > maxMessageEmbedChars) {
+			sizes = append(sizes, count)
+			count, chars = 0, 0
+		}
+		count++
+		chars += length
+	}
+	if count > 0 {
+		sizes = append(sizes, count)
+	}
+
+	return sizes
+}
+
+// Returns the number of characters of the embed counted towards the limit of the message.
+func embedLength(embed *discordgo.MessageEmbed) int {
+	length := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	for _, field := range embed.Fields {
+		length += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	if embed.Footer != nil {
+		length += utf8.RuneCountInString(embed.Footer.Text)
+	}
+	if embed.Author != nil {
+		length += utf8.RuneCountInString(embed.Author.Name)
+	}
+
+	return length
+}
+
+// Posts the items held for the quiet hours or the digest as a single embed listing the top items.
+func (n *discordNotifier) NotifyDigest(ctx context.Context, entries []db.OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	channelID, err := n.channelID(entries[0])
+	if err != nil {
+		return err
+	}
+
+	_, err = n.s.ChannelMessageSendEmbed(channelID, digestEmbed(entries), discordgo.WithRetryOnRatelimit(false), discordgo.WithContext(ctx))
+	return discordError(err)
+}
+
+// Returns the digest embed of the entries, one line per shown item.
+func digestEmbed(entries []db.OutboxEntry) *discordgo.MessageEmbed {
+	shown := notify.DigestItems(entries)
+
+	var lines []string
+	for _, entry := range shown {
+		line := fmt.Sprintf("[%s](%s) · %s", notify.Headline(entry), entry.Item.Url, notify.PriceText(entry))
+		if deal := notify.DealText(entry); deal != "" {
+			line += " · " + deal
+		}
+		lines = append(lines, line)
+	}
+
+	title := fmt.Sprintf("%d new items", len(entries))
+	if len(entries) == 1 {
+		title = "1 new item"
+	}
+	embed := NewEmbed().
+		SetTitle(title).
+		SetDescription(strings.Join(lines, "\n")).
+		SetThumbnail(shown[0].Item.Photo.Url).
+		SetColor(shown[0].Color)
+	if more := len(entries) - len(shown); more > 0 {
+		embed.SetFooter(fmt.Sprintf("and %d more", more))
+	}
+
+	return embed.MessageEmbed
+}
+
+// Converts the discordgo rate limit errors to notify.RetryAfterError.
+func discordError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if retryAfter, ok := rateLimitDelay(err); ok {
+		return &notify.RetryAfterError{Delay: retryAfter, Err: err}
+	}
+
+	return err
+}
+
+// Returns the Retry-After of the rate limited request, ok is false if err is not a rate limit.
+func rateLimitDelay(err error) (retryAfter time.Duration, ok bool) {
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) && rateLimitErr.RateLimit != nil && rateLimitErr.TooManyRequests != nil {
+		return rateLimitErr.RetryAfter, true
+	}
+
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusTooManyRequests {
+		retryAfter, err := strconv.ParseFloat(restErr.Response.Header.Get("Retry-After"), 64)
+		if err != nil {
+			return defaultRetryAfter, true
+		}
+
+		return time.Duration(retryAfter * float64(time.Second)), true
+	}
+
+	return 0, false
+}
+
+// Creates the outbox dispatcher with the Discord notifier and the sinks available in the configuration.
+func newDispatcher(s *discordgo.Session, cfg Config) *notify.Dispatcher {
+	dispatcher := notify.NewDispatcher("")
+	dispatcher.Register(&discordNotifier{s: s})
+	dispatcher.Register(&notify.WebhookNotifier{})
+	dispatcher.Register(&notify.NtfyNotifier{Token: cfg.NtfyToken})
+	dispatcher.Register(&notify.GotifyNotifier{})
+	dispatcher.Register(&notify.WriterNotifier{})
+
+	if cfg.SMTP.Addr != "" {
+		var auth smtp.Auth
+		if cfg.SMTP.Username != "" {
+			host, _, _ := net.SplitHostPort(cfg.SMTP.Addr)
+			auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, host)
+		}
+		dispatcher.Register(&notify.SMTPNotifier{Addr: cfg.SMTP.Addr, Auth: auth, From: cfg.SMTP.From})
+	}
+
+	return dispatcher
+}
+
+// Stores the new items of the watcher in the outbox, one entry per Discord channel and per additional sink.
+// The entries are held for a digest by the delivery schedule of the watcher or of their channel.
+func enqueueItems(dispatcher *notify.Dispatcher, watcher db.WatcherURL, item db.OutboxEntry, defaultChannelIDs []string) error {
+	targets, err := watcherTargets(watcher, defaultChannelIDs)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	targets = append(targets, notify.SinkEntries(watcher)...)
+
+	if len(targets) == 0 {
+		return fmt.Errorf("watcher %d has nowhere to deliver the items", watcher.ID)
+	}
+
+	var channels map[string]db.Delivery
+	if watcher.Delivery == (db.Delivery{}) {
+		channels, err = db.ReadChannelDeliveries("")
+		if err != nil {
+			log.Printf("error reading the channel deliveries: %v", err)
+		}
+	}
+
+	now := time.Now()
+	for i := range targets {
+		delivery := watcher.Delivery
+		if delivery == (db.Delivery{}) && targets[i].ChannelID != "" {
+			delivery = channels[targets[i].ChannelID]
+		}
+		notify.Hold(&targets[i], delivery, now)
+
+		targets[i].Kind = item.Kind
+		targets[i].OldPrice = item.OldPrice
+		targets[i].Deal = item.Deal
+		targets[i].RepostOf = item.RepostOf
+		targets[i].SellerRating = item.SellerRating
+		targets[i].WatcherName = watcherName(watcher)
+		targets[i].Color = watcherColor(watcher)
+		targets[i].Item = item.Item
+		targets[i].Price = item.Price
+		targets[i].TotalPrice = item.TotalPrice
+	}
+
+	return dispatcher.Enqueue(targets)
+}
+
+// Returns the Discord outbox entries (without item) the items of the watcher should be posted to.
+// That is the owner's DMs if requested, the channel chosen for the watcher or the default channels
+// for watchers created before the channel was recorded.
+func watcherTargets(watcher db.WatcherURL, defaultChannelIDs []string) ([]db.OutboxEntry, error) {
+	if watcher.Platform != db.PlatformDiscord {
+		return nil, nil
+	}
+
+	if watcher.DM && watcher.OwnerID != "" {
+		return []db.OutboxEntry{{WatcherID: watcher.ID, Sink: notify.SinkDiscord, UserID: watcher.OwnerID}}, nil
+	}
+
+	if watcher.ChannelID != "" {
+		return []db.OutboxEntry{{WatcherID: watcher.ID, Sink: notify.SinkDiscord, ChannelID: watcher.ChannelID}}, nil
+	}
+
+	if len(defaultChannelIDs) == 0 {
+		return nil, fmt.Errorf("watcher %d has no channel and no default channel is configured", watcher.ID)
+	}
+
+	var targets []db.OutboxEntry
+	for _, channelID := range defaultChannelIDs {
+		targets = append(targets, db.OutboxEntry{WatcherID: watcher.ID, Sink: notify.SinkDiscord, ChannelID: channelID})
+	}
+
+	return targets, nil
+}
+
+// Handles the events of the agent until the channel is closed. The new items and price drops are stored
+// in the outbox, the status changes of the items to mark in their messages are sent to the marks.
+func handleEvents(events <-chan agent.Event, dispatcher *notify.Dispatcher, defaultChannelIDs []string, marks chan<- agent.Event) {
+	for event := range events {
+		switch event.Type {
+		case agent.EventNewItem:
+			if err := enqueueItems(dispatcher, event.Watcher, db.OutboxEntry{Item: event.Item, Price: event.Price, TotalPrice: event.TotalPrice, Deal: event.Deal, RepostOf: event.RepostOf, SellerRating: event.SellerRating}, defaultChannelIDs); err != nil {
+				log.Printf("error storing item %d of watcher %d: %v", event.Item.ID, event.WatcherID, err)
+			}
+		case agent.EventPriceDropped:
+			entry := db.OutboxEntry{
+				Kind:       db.OutboxPriceDrop,
+				Item:       event.Item,
+				Price:      event.Price,
+				TotalPrice: event.TotalPrice,
+				OldPrice:   event.OldPrice,
+
+				SellerRating: event.SellerRating,
+			}
+			if err := enqueueItems(dispatcher, event.Watcher, entry, defaultChannelIDs); err != nil {
+				log.Printf("error storing price drop of item %d of watcher %d: %v", event.Item.ID, event.WatcherID, err)
+			}
+		case agent.EventItemStatusChanged:
+			if event.Watcher.MarkSold {
+				// The edits may wait for the rate limits, the agent must not
+				select {
+				case marks <- event:
+				default:
+					log.Printf("too many status changes to mark, item %d is not marked %s", event.Item.ID, event.Status)
+				}
+			}
+		case agent.EventWatcherError:
+			log.Printf("watcher %d failed at %v: %v", event.WatcherID, event.Time.Format(time.RFC3339), event.Err)
+		case agent.EventBreakerOpened:
+			log.Printf("requests to Vinted are failing, paused since %v", event.Time.Format(time.RFC3339))
+		}
+	}
+}
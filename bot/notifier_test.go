@@ -0,0 +1,208 @@
+package discordBot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestDiscordError(t *testing.T) {
+	tooManyRequests := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Status:     "429 Too Many Requests",
+		Header:     http.Header{"Retry-After": []string{"1.5"}},
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		wantDelay time.Duration
+	}{
+		{
+			name: "other error",
+			err:  errors.New("connection reset"),
+		},
+		{
+			name: "rate limit error",
+			err: &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{
+				TooManyRequests: &discordgo.TooManyRequests{RetryAfter: 3 * time.Second},
+			}},
+			wantDelay: 3 * time.Second,
+		},
+		{
+			name:      "429 response",
+			err:       &discordgo.RESTError{Response: tooManyRequests},
+			wantDelay: 1500 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := discordError(tt.err)
+
+			var retryAfter *notify.RetryAfterError
+			if !errors.As(got, &retryAfter) {
+				if tt.wantDelay != 0 {
+					t.Fatalf("discordError() = %v, want RetryAfterError", got)
+				}
+				return
+			}
+			if retryAfter.Delay != tt.wantDelay {
+				t.Errorf("discordError() delay = %v, want %v", retryAfter.Delay, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestWatcherTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		watcher db.WatcherURL
+		want    []db.OutboxEntry
+	}{
+		{
+			name:    "dm",
+			watcher: db.WatcherURL{ID: 1, OwnerID: "u1", ChannelID: "c1", DM: true},
+			want:    []db.OutboxEntry{{WatcherID: 1, Sink: notify.SinkDiscord, UserID: "u1"}},
+		},
+		{
+			name:    "own channel",
+			watcher: db.WatcherURL{ID: 2, ChannelID: "c1"},
+			want:    []db.OutboxEntry{{WatcherID: 2, Sink: notify.SinkDiscord, ChannelID: "c1"}},
+		},
+		{
+			name:    "default channels",
+			watcher: db.WatcherURL{ID: 3},
+			want: []db.OutboxEntry{
+				{WatcherID: 3, Sink: notify.SinkDiscord, ChannelID: "d1"},
+				{WatcherID: 3, Sink: notify.SinkDiscord, ChannelID: "d2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := watcherTargets(tt.watcher, []string{"d1", "d2"})
+			if err != nil {
+				t.Fatalf("watcherTargets() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("watcherTargets() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].WatcherID != tt.want[i].WatcherID || got[i].Sink != tt.want[i].Sink ||
+					got[i].ChannelID != tt.want[i].ChannelID || got[i].UserID != tt.want[i].UserID {
+					t.Errorf("watcherTargets()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestBatchSizes(t *testing.T) {
+	embed := func(chars int) *discordgo.MessageEmbed {
+		return &discordgo.MessageEmbed{Title: strings.Repeat("a", chars)}
+	}
+
+	var embeds []*discordgo.MessageEmbed
+	for range 23 {
+		embeds = append(embeds, embed(10))
+	}
+	if got := batchSizes(embeds, maxMessageEmbeds); !slices.Equal(got, []int{10, 10, 3}) {
+		t.Errorf("batchSizes() of 23 small embeds = %v, want [10 10 3]", got)
+	}
+
+	embeds = []*discordgo.MessageEmbed{embed(2500), embed(2500), embed(2500), embed(100)}
+	if got := batchSizes(embeds, maxMessageEmbeds); !slices.Equal(got, []int{2, 2}) {
+		t.Errorf("batchSizes() of large embeds = %v, want [2 2]", got)
+	}
+}
+
+func TestNotifyBatchRateLimit(t *testing.T) {
+	statusPath := filepath.Join(t.TempDir(), "item_status.json")
+	n := &discordNotifier{statusFilePath: statusPath}
+	if errs := n.NotifyBatch(context.Background(), nil); len(errs) != 0 {
+		t.Errorf("NotifyBatch() of no entries = %v, want no errors", errs)
+	}
+
+	var entries []db.OutboxEntry
+	for id := 1; id <= 23; id++ {
+		if err := db.TrackItem(statusPath, db.ItemStatus{ItemID: id, WatcherIDs: []int{1}, NotifiedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, db.OutboxEntry{WatcherID: 1, ChannelID: "c1", Item: vintedApi.VintedItemResp{ID: id, Title: "Jacket"}})
+	}
+
+	// Two messages are posted, then Discord asks to wait
+	var embedCounts []int
+	s, _ := discordgo.New("Bot token")
+	s.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if len(embedCounts) == 2 {
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"message": "You are being rate limited.", "retry_after": 2.5, "global": false}`)),
+			}, nil
+		}
+
+		var msg struct {
+			Embeds     []discordgo.MessageEmbed
+			Components []json.RawMessage
+		}
+		if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
+			t.Errorf("decoding the message: %v", err)
+		}
+		embedCounts = append(embedCounts, len(msg.Embeds))
+		if len(msg.Components) == 0 || len(msg.Components) > 5 {
+			t.Errorf("message with %d embeds has %d rows of menus", len(msg.Embeds), len(msg.Components))
+		}
+
+		body := fmt.Sprintf(`{"id": "m%d", "channel_id": "c1"}`, len(embedCounts))
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})}
+
+	n.s = s
+	errs := n.NotifyBatch(context.Background(), entries)
+
+	if !slices.Equal(embedCounts, []int{10, 10}) {
+		t.Errorf("posted messages with %v embeds, want [10 10]", embedCounts)
+	}
+	for i, err := range errs {
+		var retryAfter *notify.RetryAfterError
+		switch {
+		case i < 20 && err != nil:
+			t.Errorf("entry %d error = %v, want delivered", i, err)
+		case i >= 20 && (!errors.As(err, &retryAfter) || retryAfter.Delay != 2500*time.Millisecond):
+			t.Errorf("entry %d error = %v, want retry after 2.5s", i, err)
+		}
+	}
+
+	statuses, err := db.ReadItemStatuses(statusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.ItemID == 12 && (len(status.Messages) != 1 || status.Messages[0].MessageID != "m2" || status.Messages[0].Embed != 1) {
+			t.Errorf("messages of item 12 = %+v, want the second embed of m2", status.Messages)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package discordBot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Result of comparing the registered commands with the wanted ones.
+type commandsDiff struct {
+	create []*discordgo.ApplicationCommand
+	// The wanted command with the ID of the registered one.
+	update []*discordgo.ApplicationCommand
+	remove []*discordgo.ApplicationCommand
+}
+
+// Compares the commands registered in Discord with the wanted commands by name.
+// Unchanged commands are left out, so they are not recreated on every start.
+func diffCommands(registered, wanted []*discordgo.ApplicationCommand) commandsDiff {
+	var diff commandsDiff
+
+	byName := make(map[string]*discordgo.ApplicationCommand, len(registered))
+	for _, cmd := range registered {
+		byName[cmd.Name] = cmd
+	}
+
+	for _, cmd := range wanted {
+		existing, ok := byName[cmd.Name]
+		if !ok {
+			diff.create = append(diff.create, cmd)
+			continue
+		}
+		delete(byName, cmd.Name)
+
+		if !commandEqual(existing, cmd) {
+			updated := *cmd
+			updated.ID = existing.ID
+			diff.update = append(diff.update, &updated)
+		}
+	}
+
+	for _, cmd := range registered {
+		if _, stale := byName[cmd.Name]; stale {
+			diff.remove = append(diff.remove, cmd)
+		}
+	}
+
+	return diff
+}
+
+// Compares only the fields set by this bot, Discord fills the rest (ID, version, ...).
+func commandEqual(a, b *discordgo.ApplicationCommand) bool {
+	typeA, typeB := a.Type, b.Type
+	if typeA == 0 {
+		typeA = discordgo.ChatApplicationCommand
+	}
+	if typeB == 0 {
+		typeB = discordgo.ChatApplicationCommand
+	}
+
+	return typeA == typeB &&
+		a.Name == b.Name &&
+		a.Description == b.Description &&
+		optionsEqual(a.Options, b.Options)
+}
+
+// Compares the values of the optional fields, nil equals only nil.
+func ptrEqual[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+func optionsEqual(a, b []*discordgo.ApplicationCommandOption) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Type != b[i].Type ||
+			a[i].Name != b[i].Name ||
+			a[i].Description != b[i].Description ||
+			a[i].Required != b[i].Required ||
+			a[i].Autocomplete != b[i].Autocomplete ||
+			!slices.Equal(a[i].ChannelTypes, b[i].ChannelTypes) ||
+			!ptrEqual(a[i].MinValue, b[i].MinValue) ||
+			a[i].MaxValue != b[i].MaxValue ||
+			!ptrEqual(a[i].MinLength, b[i].MinLength) ||
+			a[i].MaxLength != b[i].MaxLength ||
+			!choicesEqual(a[i].Choices, b[i].Choices) ||
+			!optionsEqual(a[i].Options, b[i].Options) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func choicesEqual(a, b []*discordgo.ApplicationCommandOptionChoice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		// Values are decoded from JSON as float64 or string, compare their text form.
+		if a[i].Name != b[i].Name || fmt.Sprint(a[i].Value) != fmt.Sprint(b[i].Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the guilds the commands are managed in, "" stands for the global commands.
+func commandScopes(cfg Config) []string {
+	scopes := slices.Clone(cfg.GuildIDs)
+	if cfg.GlobalCommands {
+		scopes = append(scopes, "")
+	}
+
+	return scopes
+}
+
+// Brings the registered commands of every configured scope in line with commands.
+// Only the differences are sent to Discord.
+func syncCommands(s *discordgo.Session, appID string, cfg Config) error {
+	for _, guildID := range commandScopes(cfg) {
+		registered, err := s.ApplicationCommands(appID, guildID)
+		if err != nil {
+			return fmt.Errorf("cannot list commands of guild %q: %v", guildID, err)
+		}
+
+		diff := diffCommands(registered, commands)
+
+		for _, cmd := range diff.create {
+			if _, err := s.ApplicationCommandCreate(appID, guildID, cmd); err != nil {
+				return fmt.Errorf("cannot create %q command: %v", cmd.Name, err)
+			}
+			log.Printf("command %q created in guild %q", cmd.Name, guildID)
+		}
+
+		for _, cmd := range diff.update {
+			if _, err := s.ApplicationCommandEdit(appID, guildID, cmd.ID, cmd); err != nil {
+				return fmt.Errorf("cannot edit %q command: %v", cmd.Name, err)
+			}
+			log.Printf("command %q updated in guild %q", cmd.Name, guildID)
+		}
+
+		for _, cmd := range diff.remove {
+			if err := s.ApplicationCommandDelete(appID, guildID, cmd.ID); err != nil {
+				return fmt.Errorf("cannot delete %q command: %v", cmd.Name, err)
+			}
+			log.Printf("stale command %q deleted from guild %q", cmd.Name, guildID)
+		}
+	}
+
+	return nil
+}
+
+// Deletes every command of the bot in the configured guilds and the global ones.
+// Meant for maintenance, the ordinary restarts keep the commands registered.
+func UnregisterCommands(cfg Config) error {
+	s, err := newSession(cfg.Token)
+	if err != nil {
+		return err
+	}
+
+	app, err := s.User("@me")
+	if err != nil {
+		return fmt.Errorf("cannot get the bot user: %v", err)
+	}
+
+	cfg.GlobalCommands = true
+	for _, guildID := range commandScopes(cfg) {
+		registered, err := s.ApplicationCommands(app.ID, guildID)
+		if err != nil {
+			return fmt.Errorf("cannot list commands of guild %q: %v", guildID, err)
+		}
+
+		for _, cmd := range registered {
+			if err := s.ApplicationCommandDelete(app.ID, guildID, cmd.ID); err != nil {
+				return fmt.Errorf("cannot delete %q command: %v", cmd.Name, err)
+			}
+			log.Printf("command %q deleted from guild %q", cmd.Name, guildID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package discordBot
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestDiffCommands(t *testing.T) {
+	urlOption := &discordgo.ApplicationCommandOption{
+		Name:        "url",
+		Description: "url",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Required:    true,
+	}
+	watch := &discordgo.ApplicationCommand{
+		Name:        "watch",
+		Description: "watch",
+		Type:        discordgo.ChatApplicationCommand,
+		Options:     []*discordgo.ApplicationCommandOption{urlOption},
+	}
+	registeredWatch := &discordgo.ApplicationCommand{
+		ID:            "1",
+		ApplicationID: "app",
+		Version:       "5",
+		Name:          "watch",
+		Description:   "watch",
+		Type:          discordgo.ChatApplicationCommand,
+		Options:       []*discordgo.ApplicationCommandOption{urlOption},
+	}
+	list := &discordgo.ApplicationCommand{Name: "list", Description: "list"}
+
+	tests := []struct {
+		name       string
+		registered []*discordgo.ApplicationCommand
+		wanted     []*discordgo.ApplicationCommand
+		wantCreate []string
+		wantUpdate []string
+		wantRemove []string
+	}{
+		{
+			name:       "nothing registered",
+			registered: nil,
+			wanted:     []*discordgo.ApplicationCommand{watch, list},
+			wantCreate: []string{"watch", "list"},
+		},
+		{
+			name:       "unchanged",
+			registered: []*discordgo.ApplicationCommand{registeredWatch},
+			wanted:     []*discordgo.ApplicationCommand{watch},
+		},
+		{
+			name:       "changed description",
+			registered: []*discordgo.ApplicationCommand{registeredWatch},
+			wanted: []*discordgo.ApplicationCommand{{
+				Name:        "watch",
+				Description: "new description",
+				Options:     []*discordgo.ApplicationCommandOption{urlOption},
+			}},
+			wantUpdate: []string{"watch"},
+		},
+		{
+			name:       "changed option",
+			registered: []*discordgo.ApplicationCommand{registeredWatch},
+			wanted: []*discordgo.ApplicationCommand{{
+				Name:        "watch",
+				Description: "watch",
+			}},
+			wantUpdate: []string{"watch"},
+		},
+		{
+			name:       "changed option limit",
+			registered: []*discordgo.ApplicationCommand{registeredWatch},
+			wanted: []*discordgo.ApplicationCommand{{
+				Name:        "watch",
+				Description: "watch",
+				Type:        discordgo.ChatApplicationCommand,
+				Options: []*discordgo.ApplicationCommandOption{{
+					Name:        "url",
+					Description: "url",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					MaxLength:   100,
+				}},
+			}},
+			wantUpdate: []string{"watch"},
+		},
+		{
+			name:       "stale command",
+			registered: []*discordgo.ApplicationCommand{registeredWatch, {ID: "2", Name: "old"}},
+			wanted:     []*discordgo.ApplicationCommand{watch},
+			wantRemove: []string{"old"},
+		},
+	}
+
+	names := func(cmds []*discordgo.ApplicationCommand) []string {
+		var result []string
+		for _, cmd := range cmds {
+			result = append(result, cmd.Name)
+		}
+		return result
+
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffCommands(tt.registered, tt.wanted)
+			if !slices.Equal(names(got.create), tt.wantCreate) {
+				t.Errorf("diffCommands() create = %v, want %v", names(got.create), tt.wantCreate)
+			}
+			if !slices.Equal(names(got.update), tt.wantUpdate) {
+				t.Errorf("diffCommands() update = %v, want %v", names(got.update), tt.wantUpdate)
+			}
+			if !slices.Equal(names(got.remove), tt.wantRemove) {
+				t.Errorf("diffCommands() remove = %v, want %v", names(got.remove), tt.wantRemove)
+			}
+		})
+	}
+}
+
+func TestDiffCommandsUpdateKeepsID(t *testing.T) {
+	registered := []*discordgo.ApplicationCommand{{ID: "42", Name: "list", Description: "old"}}
+	wanted := []*discordgo.ApplicationCommand{{Name: "list", Description: "new"}}
+
+	got := diffCommands(registered, wanted)
+	if len(got.update) != 1 || got.update[0].ID != "42" {
+		t.Fatalf("diffCommands() update = %v, want the command with ID 42", got.update)
+	}
+	if wanted[0].ID != "" {
+		t.Errorf("diffCommands() modified the wanted command")
+	}
+}
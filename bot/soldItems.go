@@ -0,0 +1,106 @@
+package discordBot
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// Grey of the embeds of the items that are not available.
+const unavailableColor = 0x99AAB5
+
+const (
+	// Messages edited at once, the edits share the rate limits of Discord.
+	markWorkers = 2
+	// Status changes waiting for the workers, the ones coming on a full queue are not shown.
+	markQueueSize = 100
+)
+
+// Labels prefixed to the embed titles of the items that are not available.
+var statusLabels = map[string]string{
+	vintedApi.ItemReserved: "Reserved",
+	vintedApi.ItemSold:     "Sold",
+	vintedApi.ItemDeleted:  "Removed",
+}
+
+// Starts the workers marking the messages of the status changes sent to the returned queue, they
+// stop when it is closed and drained.
+func startMarkWorkers(s *discordgo.Session, writers *sync.WaitGroup) chan<- agent.Event {
+	queue := make(chan agent.Event, markQueueSize)
+	for range markWorkers {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for event := range queue {
+				markItemMessages(s, event)
+			}
+		}()
+	}
+
+	return queue
+}
+
+// Edits the messages the watcher posted the item in to show its new status.
+func markItemMessages(s *discordgo.Session, event agent.Event) {
+	statuses, err := db.ReadItemStatuses("")
+	if err != nil {
+		log.Printf("error reading the item statuses: %v", err)
+		return
+	}
+
+	for _, item := range statuses {
+		if item.ItemID != event.Item.ID {
+			continue
+		}
+
+		for _, message := range item.Messages {
+			if message.WatcherID != event.WatcherID {
+				continue
+			}
+
+			if err := markMessage(s, message, event.Status, watcherColor(event.Watcher)); err != nil {
+				log.Printf("error marking the message of item %d as %s: %v", item.ItemID, event.Status, err)
+			}
+		}
+	}
+}
+
+func markMessage(s *discordgo.Session, message db.ItemMessage, status string, color int) error {
+	msg, err := s.ChannelMessage(message.ChannelID, message.MessageID)
+	if err != nil {
+		return err
+	}
+	if message.Embed >= len(msg.Embeds) {
+		return nil
+	}
+
+	// The other items of the message keep their embeds
+	markEmbed(msg.Embeds[message.Embed], status, color)
+	_, err = s.ChannelMessageEditEmbeds(message.ChannelID, message.MessageID, msg.Embeds)
+
+	return err
+}
+
+// Prefixes the title of the item embed with the status and greys it out, the available items get
+// back the colour of the watcher.
+func markEmbed(embed *discordgo.MessageEmbed, status string, color int) {
+	for _, label := range statusLabels {
+		embed.Title = strings.TrimPrefix(embed.Title, "["+label+"] ")
+	}
+
+	label, ok := statusLabels[status]
+	if !ok {
+		embed.Color = color
+		return
+	}
+
+	embed.Title = "[" + label + "] " + embed.Title
+	embed.Color = unavailableColor
+	// Keeps the title within the limit
+	(&Embed{embed}).TruncateTitle()
+}
@@ -0,0 +1,50 @@
+package discordBot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestMarkEmbed(t *testing.T) {
+	embed := &discordgo.MessageEmbed{Title: "Gore-Tex Jacket"}
+
+	markEmbed(embed, vintedApi.ItemReserved, 0x09B1BA)
+	if embed.Title != "[Reserved] Gore-Tex Jacket" || embed.Color != unavailableColor {
+		t.Errorf("reserved embed = %q, color %x", embed.Title, embed.Color)
+	}
+
+	markEmbed(embed, vintedApi.ItemSold, 0x09B1BA)
+	if embed.Title != "[Sold] Gore-Tex Jacket" {
+		t.Errorf("sold embed title = %q, want the previous label replaced", embed.Title)
+	}
+
+	markEmbed(embed, vintedApi.ItemAvailable, 0x09B1BA)
+	if embed.Title != "Gore-Tex Jacket" || embed.Color != 0x09B1BA {
+		t.Errorf("available embed = %q, color %x, want it restored", embed.Title, embed.Color)
+	}
+}
+
+func TestHandleEventsMarks(t *testing.T) {
+	events := make(chan agent.Event, 3)
+	for _, event := range []agent.Event{
+		{Type: agent.EventItemStatusChanged, Watcher: db.WatcherURL{ID: 1, MarkSold: true}, Item: vintedApi.VintedItemResp{ID: 10}},
+		// The watcher does not mark its messages
+		{Type: agent.EventItemStatusChanged, Watcher: db.WatcherURL{ID: 2}, Item: vintedApi.VintedItemResp{ID: 11}},
+		// The queue is full, the agent does not wait
+		{Type: agent.EventItemStatusChanged, Watcher: db.WatcherURL{ID: 1, MarkSold: true}, Item: vintedApi.VintedItemResp{ID: 12}},
+	} {
+		events <- event
+	}
+	close(events)
+
+	marks := make(chan agent.Event, 1)
+	handleEvents(events, nil, nil, marks)
+
+	if len(marks) != 1 || (<-marks).Item.ID != 10 {
+		t.Errorf("marks did not get only the status change of item 10")
+	}
+}
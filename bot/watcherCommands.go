@@ -0,0 +1,390 @@
+package discordBot
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+	"github.com/smatand/vinted_go/vinted"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// Sends a plain text response to the interaction. Ephemeral responses are visible only to the caller.
+func respond(s *discordgo.Session, i *discordgo.InteractionCreate, content string, ephemeral bool) {
+	flags := discordgo.MessageFlagsSuppressEmbeds
+	if ephemeral {
+		flags |= discordgo.MessageFlagsEphemeral
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   flags,
+		},
+	})
+	if err != nil {
+		log.Printf("error responding to interaction: %v", err)
+	}
+}
+
+// Returns the ID of the user who invoked the interaction. Member is set in guilds, User in DMs.
+func interactionUserID(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+
+	return ""
+}
+
+// Reports whether the invoking member may manage watchers of other users in the guild,
+// i.e. has the manage role, Manage Server or Administrator permission.
+func isManager(i *discordgo.InteractionCreate) bool {
+	if i.Member == nil {
+		return false
+	}
+
+	if i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0 {
+		return true
+	}
+
+	return manageRoleID != "" && slices.Contains(i.Member.Roles, manageRoleID)
+}
+
+// Reports whether the invoking user may list, edit or remove the watcher.
+func canManage(i *discordgo.InteractionCreate, watcher db.WatcherURL) bool {
+	if watcher.OwnerID != "" && watcher.OwnerID == interactionUserID(i) {
+		return true
+	}
+
+	// The watchers of the other front-ends are managed there
+	return isManager(i) && watcher.Platform == db.PlatformDiscord && (watcher.GuildID == "" || watcher.GuildID == i.GuildID)
+}
+
+// Returns the value of the integer option "id".
+func watcherIDOption(options []*discordgo.ApplicationCommandInteractionDataOption) int {
+	for _, opt := range options {
+		if opt.Name == "id" {
+			return int(opt.IntValue())
+		}
+	}
+
+	return 0
+}
+
+// Loads the watcher given by the "id" option and checks the caller may manage it.
+// Responds to the interaction and returns false if not.
+func loadManagedWatcher(s *discordgo.Session, i *discordgo.InteractionCreate) (db.WatcherURL, bool) {
+	id := watcherIDOption(i.ApplicationCommandData().Options)
+
+	watcher, err := db.GetWatcher("", id)
+	if err != nil || !canManage(i, watcher) {
+		respond(s, i, fmt.Sprintf("there is no watcher %d you could manage", id), true)
+		return db.WatcherURL{}, false
+	}
+
+	return watcher, true
+}
+
+func describeWatcher(watcher db.WatcherURL) string {
+	destination := "default channel"
+	if watcher.DM {
+		destination = "DM"
+	} else if watcher.ChannelID != "" {
+		destination = "<#" + watcher.ChannelID + ">"
+	}
+
+	interval := "default interval"
+	if watcher.IntervalSeconds > 0 {
+		interval = fmt.Sprintf("every %ds ±%ds", watcher.IntervalSeconds, watcher.JitterSeconds)
+	} else if watcher.JitterSeconds > 0 {
+		interval = fmt.Sprintf("default interval ±%ds", watcher.JitterSeconds)
+	}
+
+	for _, sink := range watcher.Sinks {
+		destination += ", " + sink.Type
+	}
+
+	description := fmt.Sprintf("`%d` %s → %s, %s, prices in %s, %s, %s priority",
+		watcher.ID, watcher.URL, destination, agent.DescribeSellers(watcher), agent.DisplayCurrency(watcher),
+		interval, priorityName(watcher.Priority))
+
+	if watcher.PriceDrops {
+		description += ", price drops"
+	}
+	if watcher.MarkSold {
+		description += ", marks sold items"
+	}
+	if watcher.DealBasis == db.DealBasisBucket {
+		description += ", deals by brand, category and size"
+	}
+	switch watcher.Reposts {
+	case db.RepostsFlag:
+		description += ", marks reposts"
+	case db.RepostsHide:
+		description += ", hides reposts"
+	}
+	if watcher.Delivery != (db.Delivery{}) {
+		description += ", " + describeDelivery(watcher.Delivery)
+	}
+	if len(watcher.TrackedItems) > 0 {
+		description += fmt.Sprintf(", tracks the price of %d items", len(watcher.TrackedItems))
+	}
+	if watcher.SnoozedUntil.After(time.Now()) {
+		description += fmt.Sprintf(", snoozed until <t:%d:t>", watcher.SnoozedUntil.Unix())
+	}
+
+	if !reflect.ValueOf(watcher.Filters).IsZero() {
+		description += ", " + describeFilters(watcher.Filters)
+	}
+
+	if watchAgent != nil {
+		if stats, ok := watchAgent.Stats(watcher.ID); ok {
+			if watcher.Adaptive && stats.IntervalSeconds > 0 {
+				description += fmt.Sprintf(", adaptive interval now %ds", stats.IntervalSeconds)
+			}
+			description += fmt.Sprintf(", %.1f new items per check", stats.AvgNewItems)
+		}
+		if next, ok := watchAgent.NextPoll(watcher.ID); ok {
+			description += fmt.Sprintf(", next check <t:%d:R>", next.Unix())
+		}
+	}
+
+	return description
+}
+
+func priorityName(priority int) string {
+	switch {
+	case priority > db.PriorityNormal:
+		return "high"
+	case priority < db.PriorityNormal:
+		return "low"
+	default:
+		return "normal"
+	}
+}
+
+func handleList(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	watchers, err := db.ReadWatchers("")
+	if err != nil {
+		log.Printf("error reading watchers: %v", err)
+		respond(s, i, "the watchers could not be loaded, try again later", true)
+		return
+	}
+
+	var lines []string
+	for _, watcher := range watchers {
+		if canManage(i, watcher) {
+			lines = append(lines, describeWatcher(watcher))
+		}
+	}
+
+	if len(lines) == 0 {
+		respond(s, i, "you have no watchers", true)
+		return
+	}
+
+	respond(s, i, truncateMessage(strings.Join(lines, "\n")), true)
+}
+
+func handleEdit(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	watcher, ok := loadManagedWatcher(s, i)
+	if !ok {
+		return
+	}
+
+	options := i.ApplicationCommandData().Options
+	for _, opt := range options {
+		switch opt.Name {
+		case "url":
+			var parsedParams vinted.Vinted
+			parsedParams.ParseParams(opt.StringValue())
+			watcher.URL = vintedApi.ConstructVintedAPIRequest(parsedParams)
+		case "dm":
+			watcher.DM = opt.BoolValue()
+		case "currency":
+			watcher.Currency = clearable(opt.StringValue())
+		case "price_drops":
+			watcher.PriceDrops = opt.BoolValue()
+		case "mark_sold":
+			watcher.MarkSold = opt.BoolValue()
+		case "deal_basis":
+			watcher.DealBasis = clearable(opt.StringValue())
+		case "reposts":
+			watcher.Reposts = clearable(opt.StringValue())
+		}
+	}
+
+	applyScheduleOptions(&watcher, options)
+
+	for _, opt := range options {
+		if opt.Name != "color" {
+			continue
+		}
+
+		watcher.Color = clearable(opt.StringValue())
+		if _, err := parseColor(watcher.Color); err != nil && watcher.Color != "" {
+			respond(s, i, err.Error(), true)
+			return
+		}
+	}
+
+	for _, opt := range options {
+		if opt.Name != "countries" {
+			continue
+		}
+
+		countries, unknown := agent.ParseCountries(clearable(opt.StringValue()))
+		if unknown != "" {
+			respond(s, i, fmt.Sprintf("unknown country %s, use the two letter codes like SK, CZ or PL", unknown), true)
+			return
+		}
+		setCountries(&watcher, countries)
+	}
+
+	if err := db.UpdateWatcher("", watcher); err != nil {
+		log.Printf("error updating watcher %d: %v", watcher.ID, err)
+		respond(s, i, "the watcher could not be saved, try again later", true)
+		return
+	}
+
+	log.Printf("watcher %d edited by %s", watcher.ID, interactionUserID(i))
+	respond(s, i, "updated "+describeWatcher(watcher), true)
+}
+
+func handleSetChannel(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	watcher, ok := loadManagedWatcher(s, i)
+	if !ok {
+		return
+	}
+
+	var channelID string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "channel" {
+			channelID = opt.Value.(string)
+		}
+	}
+
+	if err := checkChannelPermissions(s, channelID); err != nil {
+		log.Printf("cannot set channel of watcher %d: %v", watcher.ID, err)
+		respond(s, i, fmt.Sprintf("I cannot post to <#%s>, check my permissions there", channelID), true)
+		return
+	}
+
+	watcher.ChannelID = channelID
+	watcher.DM = false
+	if err := db.UpdateWatcher("", watcher); err != nil {
+		log.Printf("error updating watcher %d: %v", watcher.ID, err)
+		respond(s, i, "the watcher could not be saved, try again later", true)
+		return
+	}
+
+	log.Printf("watcher %d now posts to channel %s", watcher.ID, channelID)
+	respond(s, i, "updated "+describeWatcher(watcher), true)
+}
+
+func handleNotify(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	watcher, ok := loadManagedWatcher(s, i)
+	if !ok {
+		return
+	}
+
+	var action string
+	var sink db.Sink
+	for _, opt := range i.ApplicationCommandData().Options {
+		switch opt.Name {
+		case "action":
+			action = opt.StringValue()
+		case "type":
+			sink.Type = opt.StringValue()
+		case "target":
+			sink.Target = strings.TrimSpace(opt.StringValue())
+		}
+	}
+
+	if action == "remove" {
+		before := len(watcher.Sinks)
+		watcher.Sinks = slices.DeleteFunc(watcher.Sinks, func(existing db.Sink) bool {
+			return existing.Type == sink.Type && (sink.Target == "" || existing.Target == sink.Target)
+		})
+		if len(watcher.Sinks) == before {
+			respond(s, i, fmt.Sprintf("watcher %d does not deliver to %s", watcher.ID, sink.Type), true)
+			return
+		}
+	} else {
+		if !sinkSupported(sink.Type) {
+			respond(s, i, fmt.Sprintf("%s is not configured on this bot", sink.Type), true)
+			return
+		}
+		// They send from the account of the operator or write to its log
+		if (sink.Type == notify.SinkEmail || sink.Type == notify.SinkStdout) && !isManager(i) {
+			respond(s, i, fmt.Sprintf("only the server managers may deliver to %s", sink.Type), true)
+			return
+		}
+		if err := notify.ValidateSink(sink); err != nil {
+			respond(s, i, err.Error(), true)
+			return
+		}
+		if slices.Contains(watcher.Sinks, sink) {
+			respond(s, i, fmt.Sprintf("watcher %d already delivers there", watcher.ID), true)
+			return
+		}
+		watcher.Sinks = append(watcher.Sinks, sink)
+	}
+
+	if err := db.UpdateWatcher("", watcher); err != nil {
+		log.Printf("error updating watcher %d: %v", watcher.ID, err)
+		respond(s, i, "the watcher could not be saved, try again later", true)
+		return
+	}
+
+	log.Printf("watcher %d sinks changed by %s: %s %s", watcher.ID, interactionUserID(i), action, sink.Type)
+	respond(s, i, "updated "+describeWatcher(watcher), true)
+}
+
+func handleRemove(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	watcher, ok := loadManagedWatcher(s, i)
+	if !ok {
+		return
+	}
+
+	if err := db.RemoveWatcher("", watcher.ID); err != nil {
+		log.Printf("error removing watcher %d: %v", watcher.ID, err)
+		respond(s, i, "the watcher could not be removed, try again later", true)
+		return
+	}
+
+	log.Printf("watcher %d removed by %s", watcher.ID, interactionUserID(i))
+	respond(s, i, fmt.Sprintf("removed watcher %d", watcher.ID), true)
+}
+
+// Discord refuses messages longer than 2000 characters.
+func truncateMessage(content string) string {
+	const maxMessageLength = 2000
+	if len(content) <= maxMessageLength {
+		return content
+	}
+
+	return content[:maxMessageLength-3] + "..."
+}
+
+// Returns the choices of the currency option, "-" switches back to the currency of the Vinted domain.
+func currencyChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{{Name: "Currency of the Vinted domain", Value: "-"}}
+	for _, code := range currency.Supported {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: code, Value: code})
+	}
+
+	return choices
+}
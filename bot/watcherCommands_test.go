@@ -0,0 +1,47 @@
+package discordBot
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/smatand/vinted_go/db"
+)
+
+func TestHandleList(t *testing.T) {
+	// The commands use the default files in the working directory
+	t.Chdir(t.TempDir())
+	for _, watcher := range []db.WatcherURL{
+		{URL: "https://www.vinted.sk/catalog?search_text=jacket", OwnerID: "u1", Platform: db.PlatformDiscord},
+		{URL: "https://www.vinted.sk/catalog?search_text=shoes", OwnerID: "u2", Platform: db.PlatformDiscord},
+	} {
+		if _, err := db.AppendWatcher("", watcher); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var content string
+	s, _ := discordgo.New("Bot token")
+	s.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var response discordgo.InteractionResponse
+		if err := json.NewDecoder(req.Body).Decode(&response); err != nil {
+			t.Errorf("decoding the response: %v", err)
+		} else {
+			content = response.Data.Content
+		}
+		return &http.Response{StatusCode: http.StatusNoContent, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})}
+
+	handleList(s, &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type: discordgo.InteractionApplicationCommand,
+		User: &discordgo.User{ID: "u1"},
+		Data: discordgo.ApplicationCommandInteractionData{Name: "list"},
+	}})
+
+	if !strings.Contains(content, "search_text=jacket") || strings.Contains(content, "search_text=shoes") {
+		t.Errorf("/list = %q, want only the watcher of u1", content)
+	}
+}
@@ -0,0 +1,171 @@
+// Package currency parses the Vinted prices into decimal amounts and converts them between
+// the currencies of the Vinted markets.
+package currency
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Currencies of the Vinted markets, the first is the default display currency.
+var Supported = []string{"EUR", "CZK", "PLN", "HUF", "RON", "SEK", "DKK", "GBP"}
+
+// Symbols of the supported currencies, the prefixed ones are written before the amount.
+var symbols = map[string]struct {
+	symbol string
+	prefix bool
+}{
+	"EUR": {"€", true},
+	"GBP": {"£", true},
+	"CZK": {"Kč", false},
+	"PLN": {"zł", false},
+	"HUF": {"Ft", false},
+	"RON": {"lei", false},
+	"SEK": {"kr", false},
+	"DKK": {"kr.", false},
+}
+
+// The currency of the Vinted domains outside the eurozone, keyed by the top level domain.
+var domainCurrencies = map[string]string{
+	"cz": "CZK",
+	"pl": "PLN",
+	"hu": "HUF",
+	"ro": "RON",
+	"se": "SEK",
+	"dk": "DKK",
+	"uk": "GBP",
+}
+
+// Returns the currency the prices are shown in on the Vinted host, e.g. "CZK" for www.vinted.cz.
+func ForHost(host string) string {
+	tld := host[strings.LastIndex(host, ".")+1:]
+	if currency, ok := domainCurrencies[tld]; ok {
+		return currency
+	}
+
+	return "EUR"
+}
+
+// Decimal amount in hundredths, e.g. 12.50 is 1250. The Vinted prices have at most two decimal places.
+type Amount int64
+
+// Parses the decimal amount like "12.5", "1 200,00" or "7". The third and further decimal places are rounded.
+func ParseAmount(s string) (Amount, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	s = strings.Replace(s, ",", ".", 1)
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	negative := strings.HasPrefix(whole, "-")
+	whole = strings.TrimPrefix(whole, "-")
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	var units int64
+	if whole != "" {
+		var err error
+		if units, err = strconv.ParseInt(whole, 10, 64); err != nil || units < 0 {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	var hundredths int64
+	for i, r := range fraction {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		digit := int64(r - '0')
+		switch {
+		case i == 0:
+			hundredths += 10 * digit
+		case i == 1:
+			hundredths += digit
+		case i == 2 && digit >= 5:
+			hundredths++
+		}
+	}
+
+	amount := Amount(units*100 + hundredths)
+	if negative {
+		amount = -amount
+	}
+
+	return amount, nil
+}
+
+// Returns the amount as a float, e.g. for the filter expressions.
+func (a Amount) Float64() float64 {
+	return float64(a) / 100
+}
+
+// Formats the amount with two decimal places, e.g. "12.50".
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign = "-"
+		a = -a
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, a/100, a%100)
+}
+
+// The amounts are stored as the decimal strings, e.g. "12.50".
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalText(text []byte) error {
+	amount, err := ParseAmount(string(text))
+	if err != nil {
+		return err
+	}
+	*a = amount
+
+	return nil
+}
+
+// Amount in a currency.
+type Money struct {
+	Amount   Amount `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Parses the amount in the currency, e.g. the price of an item.
+func Parse(amount, currency string) (Money, error) {
+	a, err := ParseAmount(amount)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: a, Currency: strings.ToUpper(currency)}, nil
+}
+
+// Reports whether the money is not set, e.g. for an unknown price.
+func (m Money) IsZero() bool {
+	return m == Money{}
+}
+
+// Formats the money like "12.50 EUR".
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Amount.String()
+	}
+
+	return m.Amount.String() + " " + m.Currency
+}
+
+// Formats the money with the currency symbol like "€12.50" or "250.00 Kč", the other currencies like String.
+func (m Money) Display() string {
+	s, ok := symbols[m.Currency]
+	switch {
+	case !ok:
+		return m.String()
+	case !s.prefix:
+		return m.Amount.String() + " " + s.symbol
+	case m.Amount < 0:
+		return "-" + s.symbol + (-m.Amount).String()
+	default:
+		return s.symbol + m.Amount.String()
+	}
+}
@@ -0,0 +1,129 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Amount
+		wantErr bool
+	}{
+		{s: "12.5", want: 1250},
+		{s: "12.50", want: 1250},
+		{s: "7", want: 700},
+		{s: "1 200,99", want: 120099},
+		{s: ".5", want: 50},
+		{s: "-3.1", want: -310},
+		{s: "9.995", want: 1000},
+		{s: "", wantErr: true},
+		{s: "12.5x", wantErr: true},
+		{s: "free", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAmount(%q) = %v, %v, want %v, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	m := Money{Amount: 1250, Currency: "EUR"}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if string(data) != `{"amount":"12.50","currency":"EUR"}` {
+		t.Errorf("Marshal() = %s", data)
+	}
+
+	var got Money
+	if err := json.Unmarshal(data, &got); err != nil || got != m {
+		t.Errorf("Unmarshal() = %+v, %v, want %+v", got, err, m)
+	}
+}
+
+func TestMoneyDisplay(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{Money{Amount: 1250, Currency: "EUR"}, "€12.50"},
+		{Money{Amount: -500, Currency: "GBP"}, "-£5.00"},
+		{Money{Amount: 25000, Currency: "CZK"}, "250.00 Kč"},
+		{Money{Amount: 100, Currency: "USD"}, "1.00 USD"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Display(); got != tt.want {
+			t.Errorf("%v.Display() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rates := Rates{Base: "EUR", Rates: map[string]float64{"CZK": 25, "PLN": 4}}
+
+	tests := []struct {
+		from   Money
+		to     string
+		want   string
+		wantOK bool
+	}{
+		{from: Money{Amount: 1000, Currency: "EUR"}, to: "CZK", want: "250.00 CZK", wantOK: true},
+		{from: Money{Amount: 25000, Currency: "CZK"}, to: "eur", want: "10.00 EUR", wantOK: true},
+		{from: Money{Amount: 10000, Currency: "PLN"}, to: "CZK", want: "625.00 CZK", wantOK: true},
+		{from: Money{Amount: 100, Currency: "HUF"}, to: "HUF", want: "1.00 HUF", wantOK: true},
+		{from: Money{Amount: 100, Currency: "HUF"}, to: "EUR"},
+	}
+
+	for _, tt := range tests {
+		got, ok := rates.Convert(tt.from, tt.to)
+		if ok != tt.wantOK || (ok && got.String() != tt.want) {
+			t.Errorf("Convert(%v, %s) = %v, %v, want %s, %v", tt.from, tt.to, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestForHost(t *testing.T) {
+	for host, want := range map[string]string{"www.vinted.sk": "EUR", "www.vinted.cz": "CZK", "www.vinted.co.uk": "GBP", "": "EUR"} {
+		if got := ForHost(host); got != want {
+			t.Errorf("ForHost(%q) = %s, want %s", host, got, want)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			w.Write([]byte(`{"amount":1.0,"base":"EUR","date":"2026-10-16","rates":{"CZK":24.31,"PLN":4.26}}`))
+		case "/invalid":
+			w.Write([]byte(`{"base":"EUR","rates":{"CZK":0}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	rates, err := Fetch(context.Background(), srv.URL+"/latest")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if rates.Base != "EUR" || rates.Date != "2026-10-16" || rates.Rates["CZK"] != 24.31 {
+		t.Errorf("Fetch() = %+v", rates)
+	}
+
+	for _, path := range []string{"/invalid", "/missing"} {
+		if _, err := Fetch(context.Background(), srv.URL+path); err == nil {
+			t.Errorf("Fetch(%s) error = nil, want error", path)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exchange rates relative to the base currency, the format of the frankfurter.app API.
+type Rates struct {
+	Base string `json:"base"`
+	// Day the rates were published, informational.
+	Date string `json:"date,omitempty"`
+	// Units of the currency per one unit of the base currency.
+	Rates map[string]float64 `json:"rates"`
+}
+
+// Approximate rates used until the rates file is loaded or refreshed.
+var Default = Rates{
+	Base: "EUR",
+	Rates: map[string]float64{
+		"CZK": 24.5,
+		"PLN": 4.25,
+		"HUF": 390,
+		"RON": 5.0,
+		"SEK": 11.0,
+		"DKK": 7.46,
+		"GBP": 0.86,
+	},
+}
+
+// Returns an error if the rates cannot be used for the conversion.
+func (r Rates) Validate() error {
+	if r.Base == "" {
+		return fmt.Errorf("missing base currency")
+	}
+	if len(r.Rates) == 0 {
+		return fmt.Errorf("no rates")
+	}
+	for currency, rate := range r.Rates {
+		if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return fmt.Errorf("invalid rate %v of %s", rate, currency)
+		}
+	}
+
+	return nil
+}
+
+// Returns the units of the currency per one unit of the base currency.
+func (r Rates) rate(currency string) (float64, bool) {
+	if strings.EqualFold(currency, r.Base) {
+		return 1, true
+	}
+	rate, ok := r.Rates[strings.ToUpper(currency)]
+
+	return rate, ok
+}
+
+// Converts the money to the currency, rounded to hundredths. Returns false if a rate is missing.
+func (r Rates) Convert(m Money, to string) (Money, bool) {
+	to = strings.ToUpper(to)
+	if m.Currency == to {
+		return m, true
+	}
+
+	from, ok := r.rate(m.Currency)
+	if !ok {
+		return Money{}, false
+	}
+	rate, ok := r.rate(to)
+	if !ok {
+		return Money{}, false
+	}
+
+	return Money{Amount: Amount(math.Round(float64(m.Amount) * rate / from)), Currency: to}, true
+}
+
+// Rates shared by the agent and the front-ends, replaced on refresh.
+type Table struct {
+	mu    sync.RWMutex
+	rates Rates
+}
+
+func NewTable(rates Rates) *Table {
+	return &Table{rates: rates}
+}
+
+// Returns the current rates.
+func (t *Table) Rates() Rates {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.rates
+}
+
+// Replaces the rates.
+func (t *Table) Set(rates Rates) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rates = rates
+}
+
+// Converts the money with the current rates, see Rates.Convert.
+func (t *Table) Convert(m Money, to string) (Money, bool) {
+	return t.Rates().Convert(m, to)
+}
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Downloads the rates from the source URL returning the Rates JSON, e.g. https://api.frankfurter.app/latest.
+func Fetch(ctx context.Context, sourceURL string) (Rates, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return Rates{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Rates{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Rates{}, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+
+	var rates Rates
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&rates); err != nil {
+		return Rates{}, fmt.Errorf("error decoding the rates: %v", err)
+	}
+	if err := rates.Validate(); err != nil {
+		return Rates{}, err
+	}
+
+	return rates, nil
+}
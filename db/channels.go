@@ -0,0 +1,74 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+var channelsMu sync.Mutex
+
+// Reads the delivery schedules of the Discord channels from the file filePath, keyed by the channel ID.
+// Default filePath is "channel_delivery.json".
+func ReadChannelDeliveries(filePath string) (map[string]Delivery, error) {
+	if filePath == "" {
+		filePath = "channel_delivery.json"
+	}
+
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+
+	return readChannelDeliveries(filePath)
+}
+
+// Sets the delivery schedule of the channel, the zero value removes it.
+// Default filePath is "channel_delivery.json".
+func SetChannelDelivery(filePath string, channelID string, delivery Delivery) error {
+	if filePath == "" {
+		filePath = "channel_delivery.json"
+	}
+
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+
+	deliveries, err := readChannelDeliveries(filePath)
+	if err != nil {
+		return err
+	}
+
+	if delivery == (Delivery{}) {
+		delete(deliveries, channelID)
+	} else {
+		deliveries[channelID] = delivery
+	}
+
+	updatedContent, err := json.Marshal(deliveries)
+	if err != nil {
+		return fmt.Errorf("error marshalling channel deliveries: %v", err)
+	}
+
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
+		return fmt.Errorf("error writing file while updating the json content: %v", err)
+	}
+
+	return nil
+}
+
+func readChannelDeliveries(filePath string) (map[string]Delivery, error) {
+	deliveries := make(map[string]Delivery)
+
+	var bytes []byte
+	if err := readBytes(filePath, &bytes); err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", filePath, err)
+	}
+
+	if bytes == nil {
+		return deliveries, nil
+	}
+
+	if err := json.Unmarshal(bytes, &deliveries); err != nil {
+		return nil, fmt.Errorf("error unmarshalling: %v", err)
+	}
+
+	return deliveries, nil
+}
@@ -5,48 +5,381 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+)
+
+var (
+	// Guards the read-modify-write cycles on the watchers file, the bot handlers run concurrently.
+	watchersMu sync.Mutex
+	// Guards the read-modify-write cycles on the items file.
+	itemsMu sync.Mutex
 )
 
 // JSON structure containing the URL of the watcher and the list of the seller_currency.
+// OwnerID, GuildID and ChannelID identify the Discord user and the place the watcher was created in,
+// new items are delivered to ChannelID or to the owner's DMs if DM is set.
+// Watchers of the other platforms are delivered only through their Sinks.
 type WatcherURL struct {
-	URL             string   `json:"url"`
+	ID             int      `json:"id"`
+	URL            string   `json:"url"`
 	SellerCurrency []string `json:"seller_currency"`
+	OwnerID        string   `json:"owner_id"`
+	GuildID        string   `json:"guild_id"`
+	ChannelID      string   `json:"channel_id"`
+	DM             bool     `json:"dm"`
+	// Seconds between two polls and the random deviation from it, 0 means the agent's default.
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+	JitterSeconds   int `json:"jitter_seconds,omitempty"`
+	// Watchers with higher priority get the requests to Vinted first.
+	Priority int `json:"priority,omitempty"`
+	// The interval adapts to the number of the new items, it stays between the min and max interval
+	// (0 means the agent's default).
+	Adaptive           bool `json:"adaptive,omitempty"`
+	MinIntervalSeconds int  `json:"min_interval_seconds,omitempty"`
+	MaxIntervalSeconds int  `json:"max_interval_seconds,omitempty"`
+	// Additional destinations of the new items besides Discord.
+	Sinks []Sink `json:"sinks,omitempty"`
+	// Front-end the watcher was created in, empty for Discord.
+	Platform string `json:"platform,omitempty"`
+	// Rules the new items must pass besides the seller country.
+	Filters Filters `json:"filters,omitzero"`
+	// ISO codes of the allowed seller countries, e.g. "SK", all countries if empty.
+	// Replaces SellerCurrency, which is used only by the watchers without countries.
+	Countries []string `json:"countries,omitempty"`
+	// Currency the prices are shown and filtered in, e.g. "CZK". The currency of the Vinted domain if empty.
+	Currency string `json:"currency,omitempty"`
+	// Reports the price drops of the seen items matching the watcher, opt-in.
+	PriceDrops bool `json:"price_drops,omitempty"`
+	// Marks the Discord messages of the items that were sold, reserved or removed.
+	MarkSold bool `json:"mark_sold,omitempty"`
+	// Prices the deal score compares the items with, DealBasisSearch or DealBasisBucket.
+	DealBasis string `json:"deal_basis,omitempty"`
+	// What happens to the reposts of recently notified items, RepostsOff, RepostsFlag or RepostsHide.
+	Reposts string `json:"reposts,omitempty"`
+	// Quiet hours and digests of the items, the schedule of the Discord channel applies if zero.
+	Delivery Delivery `json:"delivery,omitzero"`
+	// Colour of the Discord embeds as "#RRGGBB", picked by the ID if empty.
+	Color string `json:"color,omitempty"`
+	// The new items are not notified until this time.
+	SnoozedUntil time.Time `json:"snoozed_until,omitzero"`
+	// Items whose price drops are reported even without PriceDrops, the latest last.
+	TrackedItems []int `json:"tracked_items,omitempty"`
+}
+
+// Bases of the deal score of a watcher.
+const (
+	// The prices of all items of the watcher.
+	DealBasisSearch = ""
+	// The prices of the items of the same brand, category and size, found by any watcher.
+	DealBasisBucket = "bucket"
+)
+
+// Handling of the reposts by a watcher. A repost has a similar photo and title as an item of the same
+// seller notified recently.
+const (
+	// The reposts are not detected, the photos are not downloaded.
+	RepostsOff = ""
+	// The reposts are notified, marked as reposts.
+	RepostsFlag = "flag"
+	// The reposts are not notified.
+	RepostsHide = "hide"
+)
+
+// JSON structure of the delivery schedule of a watcher or a Discord channel, the zero value delivers
+// every item right away. The items found during the quiet hours or before the next digest are held
+// in the outbox and delivered together as a digest.
+type Delivery struct {
+	// Quiet hours as "15:04" in the Timezone, e.g. 22:00 to 07:00. None if empty.
+	QuietFrom string `json:"quiet_from,omitempty"`
+	QuietTo   string `json:"quiet_to,omitempty"`
+	// IANA time zone, e.g. "Europe/Bratislava", UTC if empty.
+	Timezone string `json:"timezone,omitempty"`
+	// DigestOff, DigestHourly or DigestDaily.
+	Digest string `json:"digest,omitempty"`
+	// Time of the daily digest as "15:04", 08:00 if empty.
+	DigestAt string `json:"digest_at,omitempty"`
+	// Number of the items shown in a digest and which ones, 0 and "" mean the defaults.
+	DigestSize  int    `json:"digest_size,omitempty"`
+	DigestOrder string `json:"digest_order,omitempty"`
+}
+
+// Digest modes of the Delivery.
+const (
+	// Every item is delivered right away, except during the quiet hours.
+	DigestOff    = ""
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+)
+
+// Items shown in a digest.
+const (
+	DigestNewest    = ""
+	DigestBestDeals = "deals"
+)
+
+// JSON structure of the item rules of a watcher, the zero value lets every item through.
+// The keywords and regular expressions are matched against the title and the brand, case-insensitive.
+type Filters struct {
+	// The item must contain at least one of the include keywords and none of the exclude ones.
+	IncludeKeywords []string `json:"include_keywords,omitempty"`
+	ExcludeKeywords []string `json:"exclude_keywords,omitempty"`
+	IncludeRegex    string   `json:"include_regex,omitempty"`
+	ExcludeRegex    string   `json:"exclude_regex,omitempty"`
+	// Price including the buyer protection fee.
+	MaxTotalPrice float64 `json:"max_total_price,omitempty"`
+	// Stars of the seller, 0 to 5.
+	MinSellerRating float64 `json:"min_seller_rating,omitempty"`
+	// Allowed conditions, e.g. "very_good", see agent.Conditions.
+	Conditions      []string `json:"conditions,omitempty"`
+	ExcludePromoted bool     `json:"exclude_promoted,omitempty"`
+	// Seller IDs or logins.
+	BlockedSellers []string `json:"blocked_sellers,omitempty"`
+	// Condition in the expression language of the expr package, e.g. `title contains "gore-tex" and price < 40`.
+	Expression string `json:"expression,omitempty"`
+	// Percent the price must be below the typical price, see db.WatcherURL.DealBasis.
+	MinDealScore int `json:"min_deal_score,omitempty"`
 }
 
-// JSON structure containing the id of the item.
+// JSON structure of a notification destination, e.g. {"type": "ntfy", "target": "https://ntfy.sh/topic"}.
+// The meaning of the target depends on the type.
+type Sink struct {
+	Type   string `json:"type"`
+	Target string `json:"target,omitempty"`
+}
+
+// Front-ends of the watchers.
+const (
+	PlatformDiscord  = ""
+	PlatformTelegram = "telegram"
+	PlatformSlack    = "slack"
+)
+
+// Priorities of the watchers.
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// JSON structure containing the id of the item and the history of its price, oldest first.
 type ItemID struct {
-	Id int `json:"id"`
+	Id     int          `json:"id"`
+	Prices []PricePoint `json:"prices,omitempty"`
+	// Last price each watcher saw the item at, keyed by the watcher ID. The price changes are
+	// reported to every watcher against its own last price.
+	WatcherPrices map[int]PricePoint `json:"watcher_prices,omitempty"`
+}
+
+// Price of an item, as listed by the seller, since the time it was seen.
+type PricePoint struct {
+	Price  currency.Money `json:"price"`
+	SeenAt time.Time      `json:"seen_at"`
+}
+
+// Change of the price of a seen item.
+type PriceChange struct {
+	ItemID int
+	Old    PricePoint
+	New    PricePoint
 }
 
+// Only the latest prices of an item are kept.
+const maxPriceHistory = 20
+
 // Loads teh content of the file filePath, appends the new items to the unmarshaled content and updates the file filePath.
+// The watcher gets the next free ID, which is returned.
 // Returns error if reading, marshalling or writing fails.
 // Default filePath is "watchers.json"
-func AppendWatcher(filePath string, watcher WatcherURL) error {
+func AppendWatcher(filePath string, watcher WatcherURL) (int, error) {
 	if filePath == "" {
 		filePath = "watchers.json"
 	}
 
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
 	// load the content of json file
 	watchers, err := ReadWatchers(filePath)
 	if err != nil {
-		return fmt.Errorf("error reading watcherURL: %v", err)
+		return 0, fmt.Errorf("error reading watcherURL: %v", err)
 	}
 
+	watcher.ID = nextWatcherID(watchers)
+
 	// append the new watcher
 	watchers = append(watchers, watcher)
 
+	if err := writeWatchers(filePath, watchers); err != nil {
+		return 0, err
+	}
+
+	return watcher.ID, nil
+}
+
+// Replaces the watcher with the same ID as the given watcher in the file filePath.
+// Returns error if there is no such watcher or if reading/writing fails.
+// Default filePath is "watchers.json"
+func UpdateWatcher(filePath string, watcher WatcherURL) error {
+	if filePath == "" {
+		filePath = "watchers.json"
+	}
+
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
+	watchers, err := ReadWatchers(filePath)
+	if err != nil {
+		return fmt.Errorf("error reading watcherURL: %v", err)
+	}
+
+	for i := range watchers {
+		if watchers[i].ID == watcher.ID {
+			watchers[i] = watcher
+
+			return writeWatchers(filePath, watchers)
+		}
+	}
+
+	return fmt.Errorf("watcher %d not found", watcher.ID)
+}
+
+// Removes the watcher with the given id from the file filePath.
+// Returns error if there is no such watcher or if reading/writing fails.
+// Default filePath is "watchers.json"
+func RemoveWatcher(filePath string, id int) error {
+	if filePath == "" {
+		filePath = "watchers.json"
+	}
+
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
+	watchers, err := ReadWatchers(filePath)
+	if err != nil {
+		return fmt.Errorf("error reading watcherURL: %v", err)
+	}
+
+	for i := range watchers {
+		if watchers[i].ID == id {
+			watchers = append(watchers[:i], watchers[i+1:]...)
+
+			return writeWatchers(filePath, watchers)
+		}
+	}
+
+	return fmt.Errorf("watcher %d not found", id)
+}
+
+// Returns the watcher with the given id from the file filePath.
+// Returns error if there is no such watcher or if reading fails.
+func GetWatcher(filePath string, id int) (WatcherURL, error) {
+	if filePath == "" {
+		filePath = "watchers.json"
+	}
+
+	watchers, err := ReadWatchers(filePath)
+	if err != nil {
+		return WatcherURL{}, fmt.Errorf("error reading watcherURL: %v", err)
+	}
+
+	for _, watcher := range watchers {
+		if watcher.ID == id {
+			return watcher, nil
+		}
+	}
+
+	return WatcherURL{}, fmt.Errorf("watcher %d not found", id)
+}
+
+// IDs start from 1, 0 marks a watcher without an ID.
+func nextWatcherID(watchers []WatcherURL) int {
+	maxID := 0
+	for _, watcher := range watchers {
+		if watcher.ID > maxID {
+			maxID = watcher.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func writeWatchers(filePath string, watchers []WatcherURL) error {
 	updatedContent, err := json.MarshalIndent(watchers, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshalling watchers: %v", err)
 	}
 
-	if err := os.WriteFile(filePath, updatedContent, 0644); err != nil {
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
 		return fmt.Errorf("error writing file while updating the json content: %v", err)
 	}
 
 	return nil
 }
 
+// Writes data to a temporary file first and renames it to filePath, so the file is never left
+// half written when the process is killed during the write.
+func writeFileAtomic(filePath string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// Waits until the writes in progress are finished. Called on shutdown after the writers are stopped.
+func Flush() {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
+	itemsMu.Lock()
+	defer itemsMu.Unlock()
+
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	marketMu.Lock()
+	defer marketMu.Unlock()
+
+	photosMu.Lock()
+	defer photosMu.Unlock()
+
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+
+	favouritesMu.Lock()
+	defer favouritesMu.Unlock()
+
+	ratesMu.Lock()
+	defer ratesMu.Unlock()
+}
+
 // Function changes the content of data parameter. Returns nil if file is empty/not found.
 func readBytes(filePath string, data *[]byte) error {
 	bytes, err := os.ReadFile(filePath)
@@ -68,7 +401,12 @@ func readBytes(filePath string, data *[]byte) error {
 
 // Reads the content of the given file filePath and returns the slice of WatcherURLs.
 // Returns nil if file is empty/not found.
+// Default filePath is "watchers.json".
 func ReadWatchers(filePath string) ([]WatcherURL, error) {
+	if filePath == "" {
+		filePath = "watchers.json"
+	}
+
 	var watchers []WatcherURL
 
 	var bytes []byte
@@ -84,6 +422,13 @@ func ReadWatchers(filePath string) ([]WatcherURL, error) {
 		return nil, fmt.Errorf("error unmarshalling: %v", err)
 	}
 
+	// Watchers stored before IDs were introduced get one, it is persisted on the next write.
+	for i := range watchers {
+		if watchers[i].ID == 0 {
+			watchers[i].ID = nextWatcherID(watchers)
+		}
+	}
+
 	return watchers, nil
 }
 
@@ -95,6 +440,9 @@ func AppendItemIDs(filePath string, items []ItemID) error {
 		filePath = "items.json"
 	}
 
+	itemsMu.Lock()
+	defer itemsMu.Unlock()
+
 	itemsToWrite, err := ReadItemIDs(filePath)
 	if err != nil {
 		return fmt.Errorf("error reading itemIDs: %v", err)
@@ -107,13 +455,115 @@ func AppendItemIDs(filePath string, items []ItemID) error {
 		return fmt.Errorf("error marshalling items: %v", err)
 	}
 
-	if err := os.WriteFile(filePath, updatedContent, 0644); err != nil {
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
 		return fmt.Errorf("error writing file while updating the json content: %v", err)
 	}
 
 	return nil
 }
 
+// Adds the items seen by the watcher which are not in the file filePath yet and returns them, together
+// with the price changes of the stored items since the watcher saw them last. The items carry their
+// current price as the only price point, if known. The check and the write happen under one lock, so
+// an item found by several watchers at once is returned as new only once, while every watcher gets
+// its price changes.
+// Default filePath is "items.json".
+func RecordItems(filePath string, watcherID int, items []ItemID) ([]ItemID, []PriceChange, error) {
+	if filePath == "" {
+		filePath = "items.json"
+	}
+
+	itemsMu.Lock()
+	defer itemsMu.Unlock()
+
+	stored, err := ReadItemIDs(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading itemIDs: %v", err)
+	}
+
+	index := make(map[int]int, len(stored)+len(items))
+	for i, item := range stored {
+		index[item.Id] = i
+	}
+
+	var newItems []ItemID
+	var changes []PriceChange
+	updated := false
+	for _, item := range items {
+		i, ok := index[item.Id]
+		if !ok {
+			if len(item.Prices) > 0 {
+				item.WatcherPrices = map[int]PricePoint{watcherID: item.Prices[len(item.Prices)-1]}
+			}
+			index[item.Id] = len(stored)
+			stored = append(stored, item)
+			newItems = append(newItems, item)
+			continue
+		}
+
+		if len(item.Prices) == 0 {
+			continue
+		}
+		current := item.Prices[len(item.Prices)-1]
+
+		// The items stored before the watchers' prices were kept compare with the last price of all
+		seen, known := stored[i].WatcherPrices[watcherID]
+		last, hasLast := seen, known
+		if !known && len(stored[i].WatcherPrices) == 0 && len(stored[i].Prices) > 0 {
+			last, hasLast = stored[i].Prices[len(stored[i].Prices)-1], true
+		}
+
+		var appended bool
+		stored[i].Prices, appended = appendPrice(stored[i].Prices, current)
+		updated = updated || appended
+
+		if known && seen.Price == current.Price {
+			continue
+		}
+
+		if stored[i].WatcherPrices == nil {
+			stored[i].WatcherPrices = make(map[int]PricePoint)
+		}
+		stored[i].WatcherPrices[watcherID] = current
+		updated = true
+
+		// The first sight of a known item is no change, the amounts in different currencies cannot be compared
+		if hasLast && last.Price != current.Price && last.Price.Currency == current.Price.Currency {
+			changes = append(changes, PriceChange{ItemID: item.Id, Old: last, New: current})
+		}
+	}
+
+	if len(newItems) == 0 && !updated {
+		return nil, nil, nil
+	}
+
+	updatedContent, err := json.Marshal(stored)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error marshalling items: %v", err)
+	}
+
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
+		return nil, nil, fmt.Errorf("error writing file while updating the json content: %v", err)
+	}
+
+	return newItems, changes, nil
+}
+
+// Appends the current price to the history if it differs from the last one, the oldest prices are
+// dropped. Returns false if the history is unchanged.
+func appendPrice(history []PricePoint, current PricePoint) ([]PricePoint, bool) {
+	if len(history) > 0 && history[len(history)-1].Price == current.Price {
+		return history, false
+	}
+
+	history = append(history, current)
+	if len(history) > maxPriceHistory {
+		history = history[len(history)-maxPriceHistory:]
+	}
+
+	return history, true
+}
+
 func ItemExists(item ItemID) bool {
 	ids, err := ReadItemIDs("items.json")
 	if err != nil {
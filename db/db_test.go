@@ -0,0 +1,192 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+)
+
+func TestRecordItems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.json")
+	seen := func(id int, amount currency.Amount, at time.Time) ItemID {
+		return ItemID{Id: id, Prices: []PricePoint{{Price: currency.Money{Amount: amount, Currency: "EUR"}, SeenAt: at}}}
+	}
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	newItems, changes, err := RecordItems(path, 1, []ItemID{seen(1, 3000, start), seen(2, 1000, start), {Id: 3}})
+	if err != nil {
+		t.Fatalf("RecordItems() error = %v", err)
+	}
+	if len(newItems) != 3 || len(changes) != 0 {
+		t.Fatalf("RecordItems() of new items = %v, %v, want 3 new items", newItems, changes)
+	}
+
+	later := start.Add(time.Hour)
+	newItems, changes, err = RecordItems(path, 1, []ItemID{seen(1, 2500, later), seen(2, 1000, later), seen(3, 500, later), seen(4, 100, later)})
+	if err != nil {
+		t.Fatalf("RecordItems() error = %v", err)
+	}
+	if len(newItems) != 1 || newItems[0].Id != 4 {
+		t.Errorf("RecordItems() new items = %v, want item 4", newItems)
+	}
+	// Item 3 had no price yet, that is not a change
+	if len(changes) != 1 || changes[0].ItemID != 1 || changes[0].Old.Price.Amount != 3000 || changes[0].New.Price.Amount != 2500 {
+		t.Errorf("RecordItems() changes = %+v, want item 1 from 30.00 to 25.00", changes)
+	}
+
+	// Watcher 2 sees item 1 for the first time, then its drop
+	if _, changes, _ := RecordItems(path, 2, []ItemID{seen(1, 2500, later)}); len(changes) != 0 {
+		t.Errorf("RecordItems() of another watcher = %+v, want no changes at the first sight", changes)
+	}
+	if _, changes, _ := RecordItems(path, 2, []ItemID{seen(1, 2000, later)}); len(changes) != 1 || changes[0].Old.Price.Amount != 2500 {
+		t.Errorf("RecordItems() of another watcher = %+v, want item 1 from 25.00 to 20.00", changes)
+	}
+
+	stored, err := ReadItemIDs(path)
+	if err != nil {
+		t.Fatalf("ReadItemIDs() error = %v", err)
+	}
+	if len(stored) != 4 || len(stored[0].Prices) != 3 || len(stored[1].Prices) != 1 || len(stored[2].Prices) != 1 {
+		t.Errorf("stored items = %+v", stored)
+	}
+
+	for i := range maxPriceHistory + 5 {
+		if _, _, err := RecordItems(path, 1, []ItemID{seen(2, currency.Amount(900-i), later)}); err != nil {
+			t.Fatalf("RecordItems() error = %v", err)
+		}
+	}
+	stored, _ = ReadItemIDs(path)
+	if got := len(stored[1].Prices); got != maxPriceHistory {
+		t.Errorf("price history of item 2 has %d prices, want %d", got, maxPriceHistory)
+	}
+}
+
+func TestItemStatuses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "item_status.json")
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := TrackItem(path, ItemStatus{ItemID: 1, WatcherIDs: []int{1}, NotifiedAt: start}); err != nil {
+		t.Fatalf("TrackItem() error = %v", err)
+	}
+	if err := TrackItem(path, ItemStatus{ItemID: 1, WatcherIDs: []int{2}, NotifiedAt: start}); err != nil {
+		t.Fatalf("TrackItem() error = %v", err)
+	}
+	if err := TrackItem(path, ItemStatus{ItemID: 2, WatcherIDs: []int{1}, NotifiedAt: start.Add(time.Hour)}); err != nil {
+		t.Fatalf("TrackItem() error = %v", err)
+	}
+	if err := AddItemMessage(path, 1, ItemMessage{WatcherID: 1, ChannelID: "c1", MessageID: "m1"}); err != nil {
+		t.Fatalf("AddItemMessage() error = %v", err)
+	}
+	if err := AddItemMessage(path, 3, ItemMessage{}); err == nil {
+		t.Errorf("AddItemMessage() of an untracked item error = nil")
+	}
+
+	if _, changed, _ := RecordItemStatus(path, 1, "available", start); changed {
+		t.Errorf("RecordItemStatus() of the first available status changed")
+	}
+	previous, changed, err := RecordItemStatus(path, 1, "sold", start.Add(time.Minute))
+	if err != nil || !changed || previous != "available" {
+		t.Errorf("RecordItemStatus() = %q, %v, %v, want change from available", previous, changed, err)
+	}
+
+	if err := PruneItemStatuses(path, start.Add(time.Minute)); err != nil {
+		t.Fatalf("PruneItemStatuses() error = %v", err)
+	}
+	statuses, err := ReadItemStatuses(path)
+	if err != nil {
+		t.Fatalf("ReadItemStatuses() error = %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].ItemID != 2 {
+		t.Errorf("statuses after pruning = %+v, want item 2", statuses)
+	}
+}
+
+func TestTrackItemMergesWatchers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "item_status.json")
+
+	for _, id := range []int{1, 2, 1} {
+		if err := TrackItem(path, ItemStatus{ItemID: 1, WatcherIDs: []int{id}}); err != nil {
+			t.Fatalf("TrackItem() error = %v", err)
+		}
+	}
+
+	statuses, err := ReadItemStatuses(path)
+	if err != nil {
+		t.Fatalf("ReadItemStatuses() error = %v", err)
+	}
+	if len(statuses) != 1 || len(statuses[0].WatcherIDs) != 2 {
+		t.Errorf("statuses = %+v, want one item of watchers 1 and 2", statuses)
+	}
+}
+
+func TestAddPhotoHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo_hashes.json")
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := AddPhotoHashes(path, []PhotoHash{
+		{ItemID: 1, Hash: 0xff, SeenAt: start},
+		{ItemID: 2, Hash: 0xf0, SeenAt: start},
+	}, start.Add(-time.Hour)); err != nil {
+		t.Fatalf("AddPhotoHashes() error = %v", err)
+	}
+	// Item 1 is old by now, item 2 is hashed again
+	if err := AddPhotoHashes(path, []PhotoHash{
+		{ItemID: 2, Hash: 0x0f, SeenAt: start.Add(2 * time.Hour)},
+	}, start.Add(time.Hour)); err != nil {
+		t.Fatalf("AddPhotoHashes() error = %v", err)
+	}
+
+	hashes, err := ReadPhotoHashes(path)
+	if err != nil {
+		t.Fatalf("ReadPhotoHashes() error = %v", err)
+	}
+	if len(hashes) != 1 || hashes[0].ItemID != 2 || hashes[0].Hash != 0x0f {
+		t.Errorf("ReadPhotoHashes() = %+v, want only the new hash of item 2", hashes)
+	}
+}
+
+func TestFavourites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "favourites.json")
+	price := currency.Money{Amount: 3000, Currency: "EUR"}
+
+	for _, f := range []Favourite{
+		{UserID: "u1", ItemID: 1, AddedPrice: price, Price: price},
+		{UserID: "u1", ItemID: 2},
+		{UserID: "u2", ItemID: 1},
+	} {
+		if added, err := AddFavourite(path, f); err != nil || !added {
+			t.Fatalf("AddFavourite(%+v) = %v, %v", f, added, err)
+		}
+	}
+	if added, err := AddFavourite(path, Favourite{UserID: "u1", ItemID: 1}); err != nil || added {
+		t.Errorf("AddFavourite() of a saved item = %v, %v, want not added", added, err)
+	}
+
+	checked := time.Now()
+	if err := RecordFavouriteCheck(path, 1, currency.Money{Amount: 2500, Currency: "EUR"}, "reserved", checked); err != nil {
+		t.Fatalf("RecordFavouriteCheck() error = %v", err)
+	}
+
+	favourites, err := UserFavourites(path, "u1")
+	if err != nil {
+		t.Fatalf("UserFavourites() error = %v", err)
+	}
+	if len(favourites) != 2 || favourites[0].ItemID != 2 || favourites[1].ItemID != 1 {
+		t.Fatalf("favourites of u1 = %+v, want items 2 and 1", favourites)
+	}
+	if f := favourites[1]; f.Price.Amount != 2500 || f.AddedPrice != price || f.Status != "reserved" || !f.CheckedAt.Equal(checked) {
+		t.Errorf("checked favourite = %+v", f)
+	}
+
+	if removed, err := RemoveFavourite(path, "u1", 1); err != nil || !removed {
+		t.Errorf("RemoveFavourite() = %v, %v, want removed", removed, err)
+	}
+	if removed, err := RemoveFavourite(path, "u1", 1); err != nil || removed {
+		t.Errorf("RemoveFavourite() of a removed item = %v, %v", removed, err)
+	}
+	if favourites, _ := UserFavourites(path, "u2"); len(favourites) != 1 {
+		t.Errorf("favourites of u2 = %+v, want item 1 kept", favourites)
+	}
+}
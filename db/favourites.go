@@ -0,0 +1,176 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+)
+
+// Items a Discord user may keep in the favourites.
+const MaxFavourites = 100
+
+var ErrFavouritesFull = fmt.Errorf("at most %d items can be in the favourites", MaxFavourites)
+
+var favouritesMu sync.Mutex
+
+// JSON structure of an item a user bookmarked from a notification, its price and status are re-checked.
+type Favourite struct {
+	UserID string `json:"user_id"`
+	ItemID int    `json:"item_id"`
+	// URL of the watcher that found the item, the item is checked on its host.
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	ItemURL string `json:"item_url"`
+	// Price when bookmarked and the one found by the last check.
+	AddedPrice currency.Money `json:"added_price,omitzero"`
+	Price      currency.Money `json:"price,omitzero"`
+	// One of the vintedApi item statuses.
+	Status    string    `json:"status,omitempty"`
+	AddedAt   time.Time `json:"added_at"`
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+}
+
+// Reads the favourites of all users from the file filePath, the newest last.
+// Default filePath is "favourites.json".
+func ReadFavourites(filePath string) ([]Favourite, error) {
+	if filePath == "" {
+		filePath = "favourites.json"
+	}
+
+	favouritesMu.Lock()
+	defer favouritesMu.Unlock()
+
+	return readFavourites(filePath)
+}
+
+// Returns the favourites of the user, the newest first.
+// Default filePath is "favourites.json".
+func UserFavourites(filePath string, userID string) ([]Favourite, error) {
+	favourites, err := ReadFavourites(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var own []Favourite
+	for _, f := range slices.Backward(favourites) {
+		if f.UserID == userID {
+			own = append(own, f)
+		}
+	}
+
+	return own, nil
+}
+
+// Adds the item to the favourites of the user, the item already there is kept as it was.
+// Returns ErrFavouritesFull if the user has MaxFavourites items.
+// Default filePath is "favourites.json".
+func AddFavourite(filePath string, favourite Favourite) (added bool, err error) {
+	err = updateFavourites(filePath, func(favourites []Favourite) ([]Favourite, error) {
+		count := 0
+		for _, f := range favourites {
+			if f.UserID != favourite.UserID {
+				continue
+			}
+			if f.ItemID == favourite.ItemID {
+				return favourites, nil
+			}
+			count++
+		}
+		if count >= MaxFavourites {
+			return nil, ErrFavouritesFull
+		}
+
+		added = true
+		return append(favourites, favourite), nil
+	})
+
+	return added, err
+}
+
+// Removes the item from the favourites of the user, removed is false if it was not there.
+// Default filePath is "favourites.json".
+func RemoveFavourite(filePath string, userID string, itemID int) (removed bool, err error) {
+	err = updateFavourites(filePath, func(favourites []Favourite) ([]Favourite, error) {
+		n := len(favourites)
+		favourites = slices.DeleteFunc(favourites, func(f Favourite) bool {
+			return f.UserID == userID && f.ItemID == itemID
+		})
+		removed = len(favourites) < n
+		return favourites, nil
+	})
+
+	return removed, err
+}
+
+// Records the price and status of the item found by the check in the favourites of all users.
+// The price of a removed item is kept.
+// Default filePath is "favourites.json".
+func RecordFavouriteCheck(filePath string, itemID int, price currency.Money, status string, at time.Time) error {
+	return updateFavourites(filePath, func(favourites []Favourite) ([]Favourite, error) {
+		for i := range favourites {
+			if favourites[i].ItemID != itemID {
+				continue
+			}
+			if !price.IsZero() {
+				favourites[i].Price = price
+			}
+			favourites[i].Status = status
+			favourites[i].CheckedAt = at
+		}
+		return favourites, nil
+	})
+}
+
+// Reads the favourites, applies the update and writes them back under one lock.
+func updateFavourites(filePath string, update func([]Favourite) ([]Favourite, error)) error {
+	if filePath == "" {
+		filePath = "favourites.json"
+	}
+
+	favouritesMu.Lock()
+	defer favouritesMu.Unlock()
+
+	favourites, err := readFavourites(filePath)
+	if err != nil {
+		return err
+	}
+
+	favourites, err = update(favourites)
+	if err != nil {
+		return err
+	}
+
+	updatedContent, err := json.MarshalIndent(favourites, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling favourites: %v", err)
+	}
+
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
+		return fmt.Errorf("error writing file while updating the json content: %v", err)
+	}
+
+	return nil
+}
+
+func readFavourites(filePath string) ([]Favourite, error) {
+	var favourites []Favourite
+
+	var bytes []byte
+	if err := readBytes(filePath, &bytes); err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", filePath, err)
+	}
+
+	if bytes == nil {
+		return nil, nil
+	}
+
+	if err := json.Unmarshal(bytes, &favourites); err != nil {
+		return nil, fmt.Errorf("error unmarshalling: %v", err)
+	}
+
+	return favourites, nil
+}
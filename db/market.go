@@ -0,0 +1,96 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+)
+
+var marketMu sync.Mutex
+
+// Price of an item seen by the agent, the samples of a market give its typical price.
+type PriceSample struct {
+	Price  currency.Amount `json:"price"`
+	SeenAt time.Time       `json:"seen_at"`
+}
+
+// Reads the price samples of all markets from the file filePath, keyed by the market.
+// Default filePath is "market.json".
+func ReadMarketSamples(filePath string) (map[string][]PriceSample, error) {
+	if filePath == "" {
+		filePath = "market.json"
+	}
+
+	marketMu.Lock()
+	defer marketMu.Unlock()
+
+	return readMarketSamples(filePath)
+}
+
+// Adds the samples to their markets. Only the latest keep samples of every market seen since
+// the given time are kept.
+// Default filePath is "market.json".
+func AddMarketSamples(filePath string, samples map[string][]PriceSample, keep int, since time.Time) error {
+	if filePath == "" {
+		filePath = "market.json"
+	}
+
+	marketMu.Lock()
+	defer marketMu.Unlock()
+
+	markets, err := readMarketSamples(filePath)
+	if err != nil {
+		return err
+	}
+
+	for key, added := range samples {
+		markets[key] = append(markets[key], added...)
+	}
+
+	for key, market := range markets {
+		first := 0
+		for first < len(market) && market[first].SeenAt.Before(since) {
+			first++
+		}
+		first = max(first, len(market)-keep)
+
+		if first >= len(market) {
+			delete(markets, key)
+			continue
+		}
+		markets[key] = market[first:]
+	}
+
+	updatedContent, err := json.Marshal(markets)
+	if err != nil {
+		return fmt.Errorf("error marshalling market samples: %v", err)
+	}
+
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
+		return fmt.Errorf("error writing file while updating the json content: %v", err)
+	}
+
+	return nil
+}
+
+func readMarketSamples(filePath string) (map[string][]PriceSample, error) {
+	markets := make(map[string][]PriceSample)
+
+	var bytes []byte
+	if err := readBytes(filePath, &bytes); err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", filePath, err)
+	}
+
+	if bytes == nil {
+		return markets, nil
+	}
+
+	if err := json.Unmarshal(bytes, &markets); err != nil {
+		return nil, fmt.Errorf("error unmarshalling: %v", err)
+	}
+
+	return markets, nil
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+var outboxMu sync.Mutex
+
+// Kinds of the outbox entries.
+const (
+	OutboxNewItem   = ""
+	OutboxPriceDrop = "price_drop"
+)
+
+// How the price of an item compares with the typical price.
+type Deal struct {
+	// Percent below the typical price, negative if above.
+	Score int `json:"score"`
+	// What the typical price is of, e.g. "this search" or "Nike, M".
+	Basis string `json:"basis"`
+}
+
+// How the held items are shown in the digest, see Delivery.
+type DigestOptions struct {
+	Size  int    `json:"size"`
+	Order string `json:"order,omitempty"`
+}
+
+// JSON structure of an item waiting to be delivered to its target. Sink names the notifier, the
+// entries without it go to Discord, either to ChannelID or to the DMs of UserID. The other sinks
+// use Target. Entries stay in the outbox until they are delivered or given up, so they survive restarts.
+type OutboxEntry struct {
+	ID        int                      `json:"id"`
+	WatcherID int                      `json:"watcher_id"`
+	Sink      string                   `json:"sink,omitempty"`
+	Target    string                   `json:"target,omitempty"`
+	ChannelID string                   `json:"channel_id,omitempty"`
+	UserID    string                   `json:"user_id,omitempty"`
+	Kind      string                   `json:"kind,omitempty"`
+	Item      vintedApi.VintedItemResp `json:"item"`
+
+	// Prices of the item in the display currency of the watcher, not set in the older entries.
+	Price      currency.Money `json:"price,omitzero"`
+	TotalPrice currency.Money `json:"total_price,omitzero"`
+	// The price before the drop, set for OutboxPriceDrop.
+	OldPrice currency.Money `json:"old_price,omitzero"`
+	// Comparison with the typical price, nil if it is not known.
+	Deal *Deal `json:"deal,omitempty"`
+	// ID of the recently notified item the new item is a repost of, 0 if none.
+	RepostOf int `json:"repost_of,omitempty"`
+	// Set for the items held for a digest, the due ones with the same destination are delivered together.
+	Digest *DigestOptions `json:"digest,omitempty"`
+
+	// Presentation of the item: stars of the seller (0 if not known), the watcher and its colour.
+	SellerRating float64 `json:"seller_rating,omitempty"`
+	WatcherName  string  `json:"watcher_name,omitempty"`
+	Color        int     `json:"color,omitempty"`
+
+	CreatedAt   time.Time  `json:"created_at"`
+	Attempts    int        `json:"attempts"`
+	NextAttempt time.Time  `json:"next_attempt"`
+	LastError   string     `json:"last_error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	// The delivery was given up after too many failures.
+	Failed bool `json:"failed,omitempty"`
+}
+
+// Reports whether the entry still waits for the delivery.
+func (e OutboxEntry) Pending() bool {
+	return e.DeliveredAt == nil && !e.Failed
+}
+
+// Appends the entries to the outbox file filePath. Every entry gets a new ID and is due immediately,
+// unless its NextAttempt is later. Default filePath is "outbox.json".
+func EnqueueOutbox(filePath string, entries []OutboxEntry) error {
+	now := time.Now()
+
+	return updateOutbox(filePath, func(outbox []OutboxEntry) ([]OutboxEntry, error) {
+		nextID := 1
+		for _, entry := range outbox {
+			if entry.ID >= nextID {
+				nextID = entry.ID + 1
+			}
+		}
+
+		for _, entry := range entries {
+			entry.ID = nextID
+			entry.CreatedAt = now
+			if entry.NextAttempt.Before(now) {
+				entry.NextAttempt = now
+			}
+			outbox = append(outbox, entry)
+			nextID++
+		}
+
+		return outbox, nil
+	})
+}
+
+// Returns the pending entries of the outbox file filePath whose next attempt is not after now,
+// the oldest first. Default filePath is "outbox.json".
+func DueOutboxEntries(filePath string, now time.Time) ([]OutboxEntry, error) {
+	if filePath == "" {
+		filePath = "outbox.json"
+	}
+
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	outbox, err := readOutbox(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []OutboxEntry
+	for _, entry := range outbox {
+		if entry.Pending() && !entry.NextAttempt.After(now) {
+			due = append(due, entry)
+		}
+	}
+
+	return due, nil
+}
+
+// Marks the entry with the given id as delivered at the time at.
+// Default filePath is "outbox.json".
+func MarkOutboxDelivered(filePath string, id int, at time.Time) error {
+	return updateOutboxEntry(filePath, id, func(entry *OutboxEntry) {
+		entry.DeliveredAt = &at
+		entry.LastError = ""
+	})
+}
+
+// Records the failed attempt of the entry with the given id. The entry is retried at nextAttempt,
+// or never again if giveUp is set. Default filePath is "outbox.json".
+func MarkOutboxFailed(filePath string, id int, deliveryErr string, nextAttempt time.Time, giveUp bool) error {
+	return updateOutboxEntry(filePath, id, func(entry *OutboxEntry) {
+		entry.Attempts++
+		entry.LastError = deliveryErr
+		entry.NextAttempt = nextAttempt
+		entry.Failed = giveUp
+	})
+}
+
+// Removes the delivered and given up entries created before the time before, so the file does not grow forever.
+// Default filePath is "outbox.json".
+func PruneOutbox(filePath string, before time.Time) error {
+	return updateOutbox(filePath, func(outbox []OutboxEntry) ([]OutboxEntry, error) {
+		kept := outbox[:0]
+		for _, entry := range outbox {
+			if entry.Pending() || !entry.CreatedAt.Before(before) {
+				kept = append(kept, entry)
+			}
+		}
+
+		return kept, nil
+	})
+}
+
+func updateOutboxEntry(filePath string, id int, update func(entry *OutboxEntry)) error {
+	return updateOutbox(filePath, func(outbox []OutboxEntry) ([]OutboxEntry, error) {
+		for i := range outbox {
+			if outbox[i].ID == id {
+				update(&outbox[i])
+				return outbox, nil
+			}
+		}
+
+		return nil, fmt.Errorf("outbox entry %d not found", id)
+	})
+}
+
+// Loads the outbox file, applies the update and writes the result back under the lock.
+func updateOutbox(filePath string, update func(outbox []OutboxEntry) ([]OutboxEntry, error)) error {
+	if filePath == "" {
+		filePath = "outbox.json"
+	}
+
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	outbox, err := readOutbox(filePath)
+	if err != nil {
+		return err
+	}
+
+	outbox, err = update(outbox)
+	if err != nil {
+		return err
+	}
+
+	updatedContent, err := json.Marshal(outbox)
+	if err != nil {
+		return fmt.Errorf("error marshalling outbox: %v", err)
+	}
+
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
+		return fmt.Errorf("error writing file while updating the json content: %v", err)
+	}
+
+	return nil
+}
+
+func readOutbox(filePath string) ([]OutboxEntry, error) {
+	var outbox []OutboxEntry
+
+	var bytes []byte
+	if err := readBytes(filePath, &bytes); err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", filePath, err)
+	}
+
+	if bytes == nil {
+		return nil, nil
+	}
+
+	if err := json.Unmarshal(bytes, &outbox); err != nil {
+		return nil, fmt.Errorf("error unmarshalling: %v", err)
+	}
+
+	return outbox, nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestOutboxLifecycle(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "outbox.json")
+
+	entries := []OutboxEntry{
+		{WatcherID: 1, ChannelID: "c1", Item: vintedApi.VintedItemResp{ID: 10}},
+		{WatcherID: 1, UserID: "u1", Item: vintedApi.VintedItemResp{ID: 11}},
+	}
+	if err := EnqueueOutbox(filePath, entries); err != nil {
+		t.Fatalf("EnqueueOutbox() error = %v", err)
+	}
+
+	now := time.Now()
+	due, err := DueOutboxEntries(filePath, now)
+	if err != nil {
+		t.Fatalf("DueOutboxEntries() error = %v", err)
+	}
+	if len(due) != 2 || due[0].ID != 1 || due[1].ID != 2 {
+		t.Fatalf("DueOutboxEntries() = %+v, want entries 1 and 2", due)
+	}
+
+	if err := MarkOutboxDelivered(filePath, 1, now); err != nil {
+		t.Fatalf("MarkOutboxDelivered() error = %v", err)
+	}
+	if err := MarkOutboxFailed(filePath, 2, "boom", now.Add(time.Minute), false); err != nil {
+		t.Fatalf("MarkOutboxFailed() error = %v", err)
+	}
+
+	due, _ = DueOutboxEntries(filePath, now)
+	if len(due) != 0 {
+		t.Errorf("DueOutboxEntries() before the retry = %+v, want none", due)
+	}
+
+	due, _ = DueOutboxEntries(filePath, now.Add(2*time.Minute))
+	if len(due) != 1 || due[0].ID != 2 || due[0].Attempts != 1 || due[0].LastError != "boom" {
+		t.Errorf("DueOutboxEntries() after the retry = %+v, want entry 2 with 1 attempt", due)
+	}
+
+	if err := MarkOutboxFailed(filePath, 2, "boom", now, true); err != nil {
+		t.Fatalf("MarkOutboxFailed() error = %v", err)
+	}
+	due, _ = DueOutboxEntries(filePath, now.Add(time.Hour))
+	if len(due) != 0 {
+		t.Errorf("DueOutboxEntries() after giving up = %+v, want none", due)
+	}
+
+	if err := PruneOutbox(filePath, now.Add(time.Hour)); err != nil {
+		t.Fatalf("PruneOutbox() error = %v", err)
+	}
+	outbox, _ := readOutbox(filePath)
+	if len(outbox) != 0 {
+		t.Errorf("PruneOutbox() left %+v, want empty outbox", outbox)
+	}
+
+	if err := EnqueueOutbox(filePath, entries[:1]); err != nil {
+		t.Fatalf("EnqueueOutbox() error = %v", err)
+	}
+	due, _ = DueOutboxEntries(filePath, time.Now())
+	if len(due) != 1 {
+		t.Errorf("DueOutboxEntries() after re-enqueue = %+v, want 1 entry", due)
+	}
+}
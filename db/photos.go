@@ -0,0 +1,93 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/smatand/vinted_go/imagehash"
+)
+
+var photosMu sync.Mutex
+
+// Perceptual hash of the photo of an item notified by the agent, the reposts of the item are looked up by it.
+type PhotoHash struct {
+	ItemID   int            `json:"item_id"`
+	SellerID int            `json:"seller_id"`
+	Title    string         `json:"title"`
+	Hash     imagehash.Hash `json:"hash"`
+	SeenAt   time.Time      `json:"seen_at"`
+}
+
+// Reads the photo hashes from the file filePath, the oldest first.
+// Default filePath is "photo_hashes.json".
+func ReadPhotoHashes(filePath string) ([]PhotoHash, error) {
+	if filePath == "" {
+		filePath = "photo_hashes.json"
+	}
+
+	photosMu.Lock()
+	defer photosMu.Unlock()
+
+	return readPhotoHashes(filePath)
+}
+
+// Adds the hashes, replacing the older hashes of the same items. The hashes seen before the given time are removed.
+// Default filePath is "photo_hashes.json".
+func AddPhotoHashes(filePath string, hashes []PhotoHash, since time.Time) error {
+	if filePath == "" {
+		filePath = "photo_hashes.json"
+	}
+
+	photosMu.Lock()
+	defer photosMu.Unlock()
+
+	stored, err := readPhotoHashes(filePath)
+	if err != nil {
+		return err
+	}
+
+	added := make(map[int]bool, len(hashes))
+	for _, hash := range hashes {
+		added[hash.ItemID] = true
+	}
+
+	kept := stored[:0]
+	for _, hash := range stored {
+		if !added[hash.ItemID] && !hash.SeenAt.Before(since) {
+			kept = append(kept, hash)
+		}
+	}
+	kept = append(kept, hashes...)
+
+	updatedContent, err := json.Marshal(kept)
+	if err != nil {
+		return fmt.Errorf("error marshalling photo hashes: %v", err)
+	}
+
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
+		return fmt.Errorf("error writing file while updating the json content: %v", err)
+	}
+
+	return nil
+}
+
+func readPhotoHashes(filePath string) ([]PhotoHash, error) {
+	var hashes []PhotoHash
+
+	var bytes []byte
+	if err := readBytes(filePath, &bytes); err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", filePath, err)
+	}
+
+	if bytes == nil {
+		return nil, nil
+	}
+
+	if err := json.Unmarshal(bytes, &hashes); err != nil {
+		return nil, fmt.Errorf("error unmarshalling: %v", err)
+	}
+
+	return hashes, nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/smatand/vinted_go/currency"
+)
+
+var ratesMu sync.Mutex
+
+// Reads the exchange rates from the file filePath, ok is false if the file does not exist yet.
+// Default filePath is "rates.json".
+func ReadRates(filePath string) (rates currency.Rates, ok bool, err error) {
+	if filePath == "" {
+		filePath = "rates.json"
+	}
+
+	ratesMu.Lock()
+	defer ratesMu.Unlock()
+
+	var bytes []byte
+	if err := readBytes(filePath, &bytes); err != nil {
+		return rates, false, fmt.Errorf("error reading %v: %v", filePath, err)
+	}
+
+	if bytes == nil {
+		return rates, false, nil
+	}
+
+	if err := json.Unmarshal(bytes, &rates); err != nil {
+		return rates, false, fmt.Errorf("error unmarshalling: %v", err)
+	}
+
+	if err := rates.Validate(); err != nil {
+		return rates, false, fmt.Errorf("invalid rates in %v: %v", filePath, err)
+	}
+
+	return rates, true, nil
+}
+
+// Stores the exchange rates in the file filePath.
+// Default filePath is "rates.json".
+func SaveRates(filePath string, rates currency.Rates) error {
+	if filePath == "" {
+		filePath = "rates.json"
+	}
+
+	ratesMu.Lock()
+	defer ratesMu.Unlock()
+
+	updatedContent, err := json.MarshalIndent(rates, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling rates: %v", err)
+	}
+
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
+		return fmt.Errorf("error writing file while updating the json content: %v", err)
+	}
+
+	return nil
+}
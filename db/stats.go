@@ -0,0 +1,84 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var statsMu sync.Mutex
+
+// JSON structure with the polling statistics of a watcher. It is kept apart from the watchers file,
+// which is written by the users, and updated by the agent after every poll.
+type WatcherStats struct {
+	WatcherID int `json:"watcher_id"`
+	// Current interval of the adaptive polling.
+	IntervalSeconds int `json:"interval_seconds"`
+	LastNewItems    int `json:"last_new_items"`
+	// Moving average of the new items per poll.
+	AvgNewItems float64   `json:"avg_new_items"`
+	Polls       int       `json:"polls"`
+	LastPoll    time.Time `json:"last_poll"`
+}
+
+// Reads the statistics of all watchers from the file filePath, keyed by the watcher ID.
+// Default filePath is "watcher_stats.json".
+func ReadWatcherStats(filePath string) (map[int]WatcherStats, error) {
+	if filePath == "" {
+		filePath = "watcher_stats.json"
+	}
+
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	return readWatcherStats(filePath)
+}
+
+// Stores the statistics of a single watcher in the file filePath.
+// Default filePath is "watcher_stats.json".
+func SaveWatcherStats(filePath string, stats WatcherStats) error {
+	if filePath == "" {
+		filePath = "watcher_stats.json"
+	}
+
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	all, err := readWatcherStats(filePath)
+	if err != nil {
+		return err
+	}
+
+	all[stats.WatcherID] = stats
+
+	updatedContent, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling watcher stats: %v", err)
+	}
+
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
+		return fmt.Errorf("error writing file while updating the json content: %v", err)
+	}
+
+	return nil
+}
+
+func readWatcherStats(filePath string) (map[int]WatcherStats, error) {
+	stats := make(map[int]WatcherStats)
+
+	var bytes []byte
+	if err := readBytes(filePath, &bytes); err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", filePath, err)
+	}
+
+	if bytes == nil {
+		return stats, nil
+	}
+
+	if err := json.Unmarshal(bytes, &stats); err != nil {
+		return nil, fmt.Errorf("error unmarshalling: %v", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+var statusMu sync.Mutex
+
+// Returned for the items whose status is not checked, e.g. of the watchers not marking the sold items.
+var ErrItemNotTracked = errors.New("the item is not tracked")
+
+// JSON structure of a notified item whose status is re-checked, e.g. until it is sold.
+type ItemStatus struct {
+	ItemID int `json:"item_id"`
+	// URL of the watcher that found the item, the item is checked on its host.
+	URL        string    `json:"url"`
+	Title      string    `json:"title"`
+	ItemURL    string    `json:"item_url"`
+	WatcherIDs []int     `json:"watcher_ids"`
+	NotifiedAt time.Time `json:"notified_at"`
+	CheckedAt  time.Time `json:"checked_at,omitzero"`
+	// Current status, one of the vintedApi item statuses, "" until the first check.
+	Status      string             `json:"status,omitempty"`
+	Transitions []StatusTransition `json:"transitions,omitempty"`
+	// Discord messages the item was posted in.
+	Messages []ItemMessage `json:"messages,omitempty"`
+}
+
+// Change of the status of an item.
+type StatusTransition struct {
+	From string    `json:"from,omitempty"`
+	To   string    `json:"to"`
+	At   time.Time `json:"at"`
+}
+
+// Discord message of an item, it is edited when the item is sold.
+type ItemMessage struct {
+	WatcherID int    `json:"watcher_id"`
+	ChannelID string `json:"channel_id"`
+	MessageID string `json:"message_id"`
+	// Index of the item's embed, the messages hold several items.
+	Embed int `json:"embed,omitempty"`
+}
+
+// Reads the statuses of all tracked items from the file filePath.
+// Default filePath is "item_status.json".
+func ReadItemStatuses(filePath string) ([]ItemStatus, error) {
+	if filePath == "" {
+		filePath = "item_status.json"
+	}
+
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	return readItemStatuses(filePath)
+}
+
+// Starts tracking the notified item, or adds the watcher to the already tracked one.
+// Default filePath is "item_status.json".
+func TrackItem(filePath string, item ItemStatus) error {
+	return updateItemStatuses(filePath, func(statuses []ItemStatus) ([]ItemStatus, error) {
+		i := slices.IndexFunc(statuses, func(s ItemStatus) bool { return s.ItemID == item.ItemID })
+		if i < 0 {
+			return append(statuses, item), nil
+		}
+
+		for _, id := range item.WatcherIDs {
+			if !slices.Contains(statuses[i].WatcherIDs, id) {
+				statuses[i].WatcherIDs = append(statuses[i].WatcherIDs, id)
+			}
+		}
+		return statuses, nil
+	})
+}
+
+// Records the status of the item found by the check at the given time. Returns the previous status
+// and whether it changed, the first check of an available item is not a change.
+// Default filePath is "item_status.json".
+func RecordItemStatus(filePath string, itemID int, status string, at time.Time) (previous string, changed bool, err error) {
+	err = updateItemStatuses(filePath, func(statuses []ItemStatus) ([]ItemStatus, error) {
+		i := slices.IndexFunc(statuses, func(s ItemStatus) bool { return s.ItemID == itemID })
+		if i < 0 {
+			return nil, fmt.Errorf("item %d: %w", itemID, ErrItemNotTracked)
+		}
+
+		item := &statuses[i]
+		previous = item.Status
+		item.CheckedAt = at
+		if status != item.Status {
+			item.Transitions = append(item.Transitions, StatusTransition{From: item.Status, To: status, At: at})
+			item.Status = status
+			changed = previous != "" || status != vintedApi.ItemAvailable
+		}
+		return statuses, nil
+	})
+
+	return previous, changed, err
+}
+
+// Remembers the Discord message the item was posted in.
+// Default filePath is "item_status.json".
+func AddItemMessage(filePath string, itemID int, message ItemMessage) error {
+	return updateItemStatuses(filePath, func(statuses []ItemStatus) ([]ItemStatus, error) {
+		i := slices.IndexFunc(statuses, func(s ItemStatus) bool { return s.ItemID == itemID })
+		if i < 0 {
+			return nil, fmt.Errorf("item %d: %w", itemID, ErrItemNotTracked)
+		}
+
+		statuses[i].Messages = append(statuses[i].Messages, message)
+		return statuses, nil
+	})
+}
+
+// Stops tracking the items notified before the given time.
+// Default filePath is "item_status.json".
+func PruneItemStatuses(filePath string, notifiedBefore time.Time) error {
+	return updateItemStatuses(filePath, func(statuses []ItemStatus) ([]ItemStatus, error) {
+		return slices.DeleteFunc(statuses, func(s ItemStatus) bool {
+			return s.NotifiedAt.Before(notifiedBefore)
+		}), nil
+	})
+}
+
+// Reads the statuses, applies the update and writes them back under one lock.
+func updateItemStatuses(filePath string, update func([]ItemStatus) ([]ItemStatus, error)) error {
+	if filePath == "" {
+		filePath = "item_status.json"
+	}
+
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	statuses, err := readItemStatuses(filePath)
+	if err != nil {
+		return err
+	}
+
+	statuses, err = update(statuses)
+	if err != nil {
+		return err
+	}
+
+	updatedContent, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling item statuses: %v", err)
+	}
+
+	if err := writeFileAtomic(filePath, updatedContent); err != nil {
+		return fmt.Errorf("error writing file while updating the json content: %v", err)
+	}
+
+	return nil
+}
+
+func readItemStatuses(filePath string) ([]ItemStatus, error) {
+	var statuses []ItemStatus
+
+	var bytes []byte
+	if err := readBytes(filePath, &bytes); err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", filePath, err)
+	}
+
+	if bytes == nil {
+		return nil, nil
+	}
+
+	if err := json.Unmarshal(bytes, &statuses); err != nil {
+		return nil, fmt.Errorf("error unmarshalling: %v", err)
+	}
+
+	return statuses, nil
+}
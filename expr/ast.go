@@ -0,0 +1,231 @@
+package expr
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Typed node of the compiled expression.
+type node interface {
+	typ() Type
+	pos() int
+	eval(env map[string]any) (any, error)
+}
+
+// Reports whether the node or the nodes under it read one of the fields.
+func uses(n node, fields []string) bool {
+	switch n := n.(type) {
+	case *fieldNode:
+		return slices.Contains(fields, n.name)
+	case *listNode:
+		return slices.ContainsFunc(n.elems, func(elem node) bool { return uses(elem, fields) })
+	case *unaryNode:
+		return uses(n.x, fields)
+	case *binaryNode:
+		return uses(n.l, fields) || uses(n.r, fields)
+	}
+
+	return false
+}
+
+type literal struct {
+	v any
+	t Type
+	p int
+}
+
+func (n *literal) typ() Type { return n.t }
+func (n *literal) pos() int  { return n.p }
+
+func (n *literal) eval(map[string]any) (any, error) {
+	return n.v, nil
+}
+
+type fieldNode struct {
+	name string
+	t    Type
+	p    int
+}
+
+func (n *fieldNode) typ() Type { return n.t }
+func (n *fieldNode) pos() int  { return n.p }
+
+func (n *fieldNode) eval(env map[string]any) (any, error) {
+	v, ok := env[n.name]
+	switch n.t {
+	case Number:
+		switch x := v.(type) {
+		case float64:
+			return x, nil
+		case int:
+			return float64(x), nil
+		case int64:
+			return float64(x), nil
+		}
+		if !ok {
+			return 0.0, nil
+		}
+	case String:
+		if s, isString := v.(string); isString {
+			return s, nil
+		}
+		if !ok {
+			return "", nil
+		}
+	case Bool:
+		if b, isBool := v.(bool); isBool {
+			return b, nil
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return nil, errorf(n.p, "field %s holds %T, not %s", n.name, v, n.t)
+}
+
+type listNode struct {
+	elems []node
+	elem  Type
+	p     int
+}
+
+func (n *listNode) typ() Type { return List }
+func (n *listNode) pos() int  { return n.p }
+
+func (n *listNode) eval(env map[string]any) (any, error) {
+	values := make([]any, 0, len(n.elems))
+	for _, elem := range n.elems {
+		v, err := elem.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+type unaryNode struct {
+	op string
+	p  int
+	x  node
+}
+
+func (n *unaryNode) typ() Type { return n.x.typ() }
+func (n *unaryNode) pos() int  { return n.p }
+
+func (n *unaryNode) eval(env map[string]any) (any, error) {
+	v, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "not" {
+		return !v.(bool), nil
+	}
+
+	return -v.(float64), nil
+}
+
+type binaryNode struct {
+	op   string
+	p    int
+	l, r node
+	t    Type
+	// Compiled pattern of matches.
+	re *regexp.Regexp
+}
+
+func (n *binaryNode) typ() Type { return n.t }
+func (n *binaryNode) pos() int  { return n.p }
+
+func (n *binaryNode) eval(env map[string]any) (any, error) {
+	left, err := n.l.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// The right side is not evaluated when the result is known
+	switch n.op {
+	case "and":
+		if !left.(bool) {
+			return false, nil
+		}
+	case "or":
+		if left.(bool) {
+			return true, nil
+		}
+	}
+
+	right, err := n.r.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "and", "or":
+		return right.(bool), nil
+	case "+":
+		return left.(float64) + right.(float64), nil
+	case "-":
+		return left.(float64) - right.(float64), nil
+	case "*":
+		return left.(float64) * right.(float64), nil
+	case "/":
+		if right.(float64) == 0 {
+			return nil, errorf(n.p, "division by zero")
+		}
+		return left.(float64) / right.(float64), nil
+	case "%":
+		if int64(right.(float64)) == 0 {
+			return nil, errorf(n.p, "division by zero")
+		}
+		return float64(int64(left.(float64)) % int64(right.(float64))), nil
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "<":
+		return left.(float64) < right.(float64), nil
+	case "<=":
+		return left.(float64) <= right.(float64), nil
+	case ">":
+		return left.(float64) > right.(float64), nil
+	case ">=":
+		return left.(float64) >= right.(float64), nil
+	case "contains":
+		return strings.Contains(strings.ToLower(left.(string)), strings.ToLower(right.(string))), nil
+	case "startswith":
+		return strings.HasPrefix(strings.ToLower(left.(string)), strings.ToLower(right.(string))), nil
+	case "endswith":
+		return strings.HasSuffix(strings.ToLower(left.(string)), strings.ToLower(right.(string))), nil
+	case "matches":
+		return n.re.MatchString(left.(string)), nil
+	case "in", "not in":
+		found := false
+		if list, ok := right.([]any); ok {
+			for _, v := range list {
+				if equal(left, v) {
+					found = true
+					break
+				}
+			}
+		} else {
+			found = strings.Contains(strings.ToLower(right.(string)), strings.ToLower(left.(string)))
+		}
+		return found == (n.op == "in"), nil
+	}
+
+	return nil, errorf(n.p, "unknown operator %s", n.op)
+}
+
+// Compares the values of the same type, the strings ignoring the case.
+func equal(a, b any) bool {
+	if s, ok := a.(string); ok {
+		return strings.EqualFold(s, b.(string))
+	}
+
+	return a == b
+}
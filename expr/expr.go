@@ -0,0 +1,152 @@
+// Package expr is a small expression language for the item filters, e.g.
+//
+//	title contains "gore-tex" and price < 40 or brand == "Arc'teryx"
+//
+// The expressions are type checked against the known fields when compiled and cannot do anything
+// but compute a value from the fields: there are no loops, calls or assignments, the regular
+// expressions run in linear time and the size of the expressions is limited.
+//
+// Operators by precedence, from the lowest:
+//
+//	or ||
+//	and &&
+//	not !
+//	== != < <= > >= contains startswith endswith matches in "not in"
+//	+ -
+//	* / %
+//	unary -
+//
+// String comparisons ignore the case. Lists are written as ["a", "b"].
+package expr
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	// Longest accepted expression in bytes.
+	MaxLength = 1000
+	// Deepest accepted nesting of the operators and parentheses.
+	maxDepth = 32
+)
+
+// Type of a field or an expression.
+type Type int
+
+const (
+	Number Type = iota + 1
+	String
+	Bool
+	// List of strings or numbers, only as the right side of in.
+	List
+)
+
+func (t Type) String() string {
+	switch t {
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Bool:
+		return "bool"
+	case List:
+		return "list"
+	default:
+		return "unknown"
+	}
+}
+
+// Compile or evaluation error, Pos is the byte offset in the source the error refers to.
+type Error struct {
+	Pos int
+	Msg string
+	// Source of the expression, for Column.
+	src string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column(), e.Msg)
+}
+
+// Returns the 1-based column of the error in characters.
+func (e *Error) Column() int {
+	if e.Pos > len(e.src) {
+		return utf8.RuneCountInString(e.src) + 1
+	}
+
+	return utf8.RuneCountInString(e.src[:e.Pos]) + 1
+}
+
+func errorf(pos int, format string, args ...any) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Compiled expression, safe for concurrent use.
+type Program struct {
+	src  string
+	root node
+}
+
+// Compiles the boolean expression using the fields of the given types.
+func Compile(src string, fields map[string]Type) (*Program, error) {
+	if len(src) > MaxLength {
+		return nil, &Error{Pos: MaxLength, Msg: fmt.Sprintf("expression longer than %d characters", MaxLength), src: src}
+	}
+
+	root, err := compile(src, fields)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			e.src = src
+		}
+		return nil, err
+	}
+
+	if root.typ() != Bool {
+		return nil, &Error{Pos: root.pos(), Msg: fmt.Sprintf("expression must be a condition, it is a %s", root.typ()), src: src}
+	}
+
+	return &Program{src: src, root: root}, nil
+}
+
+func compile(src string, fields map[string]Type) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, fields: fields}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, errorf(tok.pos, "unexpected %s", describe(tok))
+	}
+
+	return root, nil
+}
+
+// Evaluates the expression with the field values, float64 for the numbers.
+// The fields missing in env are the zero values of their types.
+func (p *Program) Eval(env map[string]any) (bool, error) {
+	v, err := p.root.eval(env)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			e.src = p.src
+		}
+		return false, err
+	}
+
+	return v.(bool), nil
+}
+
+// Reports whether the expression reads any of the fields.
+func (p *Program) Uses(fields ...string) bool {
+	return uses(p.root, fields)
+}
+
+func (p *Program) String() string {
+	return p.src
+}
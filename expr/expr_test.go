@@ -0,0 +1,136 @@
+package expr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testFields = map[string]Type{
+	"title":    String,
+	"brand":    String,
+	"price":    Number,
+	"promoted": Bool,
+}
+
+func TestEval(t *testing.T) {
+	env := map[string]any{
+		"title":    "Gore-Tex Jacket",
+		"brand":    "Arc'teryx",
+		"price":    35.5,
+		"promoted": false,
+	}
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{src: `title contains 'gore-tex' and price < 40 or brand == "Arc'teryx"`, want: true},
+		{src: `title contains "boots" or brand == 'arc\'teryx'`, want: true},
+		{src: `title contains "boots" and price < 40`, want: false},
+		{src: `not promoted && price * 2 >= 71`, want: true},
+		{src: `!(price > 30)`, want: false},
+		{src: `brand in ["Nike", "ARC'TERYX"]`, want: true},
+		{src: `price not in [35.5, 40]`, want: false},
+		{src: `"tex" in title`, want: true},
+		{src: `title matches "^gore-?tex\\b"`, want: true},
+		{src: `title startswith "gore" and title endswith "JACKET"`, want: true},
+		{src: `-price + 40 > 4 and price % 10 == 5`, want: true},
+		{src: `promoted == false`, want: true},
+		// The missing fields are the zero values
+		{src: `price > 0 and title != ""`, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			p, err := Compile(tt.src, testFields)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			got, err := p.Eval(env)
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUses(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{src: `title contains "boots"`},
+		{src: `title contains "boots" or price < 40`, want: true},
+		{src: `not (-price > 30)`, want: true},
+		{src: `40 in [price, 50]`, want: true},
+		{src: `brand in ["price"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			p, err := Compile(tt.src, testFields)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			if got := p.Uses("price", "total_price"); got != tt.want {
+				t.Errorf("Uses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		column  int
+		message string
+	}{
+		{src: `titel contains "x"`, column: 1, message: `unknown field "titel", did you mean title?`},
+		{src: `price < "40"`, column: 7, message: "< needs numbers on both sides, got number and string"},
+		{src: `title contains 'gore`, column: 16, message: "unterminated string"},
+		{src: `price`, column: 1, message: "expression must be a condition, it is a number"},
+		{src: `(price < 40`, column: 12, message: "missing )"},
+		{src: `price < 40 and`, column: 15, message: "unexpected end of the expression"},
+		{src: `title matches "("`, column: 15, message: "invalid pattern"},
+		{src: `title matches brand`, column: 7, message: "matches needs a string on the left and a quoted pattern"},
+		{src: `brand in ["a", 1]`, column: 16, message: "list mixes string and number"},
+		{src: `price ; 1`, column: 7, message: "unexpected character ';'"},
+		{src: `price == 1 price`, column: 12, message: `unexpected "price"`},
+		{src: strings.Repeat("(", 40) + "promoted" + strings.Repeat(")", 40), column: 34, message: "nested too deep"},
+		{src: strings.Repeat("a", MaxLength+1), column: MaxLength + 1, message: "longer than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Compile(tt.src, testFields)
+
+			var exprErr *Error
+			if !errors.As(err, &exprErr) {
+				t.Fatalf("Compile() error = %v, want *Error", err)
+			}
+			if exprErr.Column() != tt.column || !strings.Contains(exprErr.Msg, tt.message) {
+				t.Errorf("Compile() error = %v, want column %d: %s", err, tt.column, tt.message)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	p, err := Compile(`price / 0 > 1`, testFields)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	if _, err := p.Eval(map[string]any{"price": 1.0}); err == nil || !strings.Contains(err.Error(), "division by zero") {
+		t.Errorf("Eval() error = %v, want division by zero", err)
+	}
+
+	if _, err := p.Eval(map[string]any{"price": "1"}); err == nil {
+		t.Errorf("Eval() with a string price = nil error")
+	}
+}
@@ -0,0 +1,110 @@
+package expr
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	// Operators and punctuation, the text holds the operator.
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// Byte offset of the token in the source.
+	pos int
+}
+
+// Words with a meaning in the language, they cannot be used as field names.
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true, "in": true, "true": true, "false": true,
+	"contains": true, "startswith": true, "endswith": true, "matches": true,
+}
+
+// Splits the source into tokens.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9' || r == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			start := i
+			dot := false
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.' && !dot) {
+				dot = dot || src[i] == '.'
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], pos: start})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+		case r == '\'' || r == '"':
+			text, end, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: i})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, errorf(i, "unexpected character %q", r)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// Reads the quoted string starting at src[start], returns its value and the offset after it.
+func lexString(src string, start int) (string, int, error) {
+	quote := src[start]
+	var b strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(src[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", 0, errorf(start, "unterminated string")
+}
@@ -0,0 +1,375 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type parser struct {
+	tokens []token
+	next   int
+	fields map[string]Type
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+
+	return tok
+}
+
+// Reports whether the next token is one of the operators or keywords, and consumes it if so.
+func (p *parser) accept(texts ...string) (token, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp && tok.kind != tokIdent {
+		return tok, false
+	}
+
+	for _, text := range texts {
+		if tok.text == text {
+			p.advance()
+			return tok, true
+		}
+	}
+
+	return tok, false
+}
+
+func (p *parser) parseOr(depth int) (node, error) {
+	if depth > maxDepth {
+		return nil, errorf(p.peek().pos, "expression nested too deep")
+	}
+
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept("or", "||")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newLogical("or", op.pos, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseAnd(depth int) (node, error) {
+	left, err := p.parseNot(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept("and", "&&")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseNot(depth)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newLogical("and", op.pos, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseNot(depth int) (node, error) {
+	op, ok := p.accept("not", "!")
+	if !ok {
+		return p.parseComparison(depth)
+	}
+
+	if depth > maxDepth {
+		return nil, errorf(op.pos, "expression nested too deep")
+	}
+
+	x, err := p.parseNot(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	if x.typ() != Bool {
+		return nil, errorf(op.pos, "not needs a condition, got %s", x.typ())
+	}
+
+	return &unaryNode{op: "not", p: op.pos, x: x}, nil
+}
+
+func (p *parser) parseComparison(depth int) (node, error) {
+	left, err := p.parseAdditive(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "contains", "startswith", "endswith", "matches", "in")
+	if !ok {
+		// "not in" is the only comparison of two words
+		if p.peek().text == "not" && p.tokens[p.next+1].text == "in" && p.peek().kind == tokIdent {
+			op = p.advance()
+			p.advance()
+			op.text = "not in"
+		} else {
+			return left, nil
+		}
+	}
+
+	right, err := p.parseAdditive(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	return newComparison(op.text, op.pos, left, right)
+}
+
+func (p *parser) parseAdditive(depth int) (node, error) {
+	left, err := p.parseMultiplicative(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative(depth)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newArithmetic(op.text, op.pos, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseMultiplicative(depth int) (node, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newArithmetic(op.text, op.pos, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseUnary(depth int) (node, error) {
+	op, ok := p.accept("-")
+	if !ok {
+		return p.parsePrimary(depth)
+	}
+
+	if depth > maxDepth {
+		return nil, errorf(op.pos, "expression nested too deep")
+	}
+
+	x, err := p.parseUnary(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	if x.typ() != Number {
+		return nil, errorf(op.pos, "- needs a number, got %s", x.typ())
+	}
+
+	return &unaryNode{op: "-", p: op.pos, x: x}, nil
+}
+
+func (p *parser) parsePrimary(depth int) (node, error) {
+	tok := p.advance()
+
+	switch tok.kind {
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, errorf(tok.pos, "invalid number %s", tok.text)
+		}
+		return &literal{v: n, t: Number, p: tok.pos}, nil
+	case tokString:
+		return &literal{v: tok.text, t: String, p: tok.pos}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return &literal{v: tok.text == "true", t: Bool, p: tok.pos}, nil
+		}
+		if keywords[tok.text] {
+			return nil, errorf(tok.pos, "unexpected %s", describe(tok))
+		}
+
+		t, ok := p.fields[tok.text]
+		if !ok {
+			return nil, errorf(tok.pos, "unknown field %q%s", tok.text, suggest(tok.text, p.fields))
+		}
+		return &fieldNode{name: tok.text, t: t, p: tok.pos}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			x, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, errorf(p.peek().pos, "missing )")
+			}
+			return x, nil
+		case "[":
+			return p.parseList(tok, depth)
+		}
+	}
+
+	return nil, errorf(tok.pos, "unexpected %s", describe(tok))
+}
+
+func (p *parser) parseList(open token, depth int) (node, error) {
+	list := &listNode{p: open.pos}
+	for {
+		x, err := p.parseAdditive(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if x.typ() != Number && x.typ() != String {
+			return nil, errorf(x.pos(), "lists hold strings or numbers, got %s", x.typ())
+		}
+		if list.elem != 0 && x.typ() != list.elem {
+			return nil, errorf(x.pos(), "list mixes %s and %s", list.elem, x.typ())
+		}
+		list.elem = x.typ()
+		list.elems = append(list.elems, x)
+
+		if _, ok := p.accept("]"); ok {
+			return list, nil
+		}
+		if _, ok := p.accept(","); !ok {
+			return nil, errorf(p.peek().pos, "expected , or ] in the list")
+		}
+	}
+}
+
+func describe(tok token) string {
+	switch tok.kind {
+	case tokEOF:
+		return "end of the expression"
+	case tokString:
+		return strconv.Quote(tok.text)
+	default:
+		return fmt.Sprintf("%q", tok.text)
+	}
+}
+
+// Suggests the field with the closest name, e.g. for the misspelled ones.
+func suggest(name string, fields map[string]Type) string {
+	best, bestDistance := "", 3
+	for field := range fields {
+		if d := distance(strings.ToLower(name), field); d < bestDistance || d == bestDistance && field < best {
+			best, bestDistance = field, d
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(", did you mean %s?", best)
+}
+
+// Levenshtein distance of the strings.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func newLogical(op string, pos int, left, right node) (node, error) {
+	if left.typ() != Bool || right.typ() != Bool {
+		return nil, errorf(pos, "%s needs conditions on both sides, got %s and %s", op, left.typ(), right.typ())
+	}
+
+	return &binaryNode{op: op, p: pos, l: left, r: right, t: Bool}, nil
+}
+
+func newArithmetic(op string, pos int, left, right node) (node, error) {
+	if left.typ() != Number || right.typ() != Number {
+		return nil, errorf(pos, "%s needs numbers on both sides, got %s and %s", op, left.typ(), right.typ())
+	}
+
+	return &binaryNode{op: op, p: pos, l: left, r: right, t: Number}, nil
+}
+
+func newComparison(op string, pos int, left, right node) (node, error) {
+	n := &binaryNode{op: op, p: pos, l: left, r: right, t: Bool}
+
+	switch op {
+	case "==", "!=":
+		if left.typ() != right.typ() || left.typ() == List {
+			return nil, errorf(pos, "cannot compare %s with %s", left.typ(), right.typ())
+		}
+	case "<", "<=", ">", ">=":
+		if left.typ() != Number || right.typ() != Number {
+			return nil, errorf(pos, "%s needs numbers on both sides, got %s and %s", op, left.typ(), right.typ())
+		}
+	case "contains", "startswith", "endswith":
+		if left.typ() != String || right.typ() != String {
+			return nil, errorf(pos, "%s needs strings on both sides, got %s and %s", op, left.typ(), right.typ())
+		}
+	case "matches":
+		pattern, ok := right.(*literal)
+		if left.typ() != String || !ok || pattern.t != String {
+			return nil, errorf(pos, "matches needs a string on the left and a quoted pattern on the right")
+		}
+		re, err := regexp.Compile("(?i)" + pattern.v.(string))
+		if err != nil {
+			return nil, errorf(right.pos(), "invalid pattern: %v", err)
+		}
+		n.re = re
+	case "in", "not in":
+		list, isList := right.(*listNode)
+		switch {
+		case isList && list.elem == left.typ():
+		case left.typ() == String && right.typ() == String:
+		default:
+			return nil, errorf(pos, "%s needs a list of %ss or a string on the right, got %s", op, left.typ(), right.typ())
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,98 @@
+package imagehash
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math/bits"
+	"strconv"
+)
+
+// Size of the grey image the hash is computed from, one bit per pair of neighbouring pixels in a row.
+const (
+	hashWidth  = 9
+	hashHeight = 8
+)
+
+// Perceptual hash of an image. The hashes of similar images, e.g. resized or recompressed, differ in few bits.
+type Hash uint64
+
+// Computes the difference hash of the image. The image is shrunk to 9x8 grey pixels and every bit
+// tells whether a pixel is brighter than its right neighbour, so the hash survives resizing,
+// recompression and small changes of the brightness. An empty image has the hash 0.
+func Compute(img image.Image) Hash {
+	b := img.Bounds()
+	if b.Empty() {
+		return 0
+	}
+
+	var grey [hashHeight][hashWidth]float64
+	for y := range hashHeight {
+		y0 := b.Min.Y + y*b.Dy()/hashHeight
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/hashHeight, y0+1)
+		for x := range hashWidth {
+			x0 := b.Min.X + x*b.Dx()/hashWidth
+			x1 := max(b.Min.X+(x+1)*b.Dx()/hashWidth, x0+1)
+
+			// Average of the area the grey pixel covers
+			var sum float64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			grey[y][x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	var hash Hash
+	for y := range hashHeight {
+		for x := range hashWidth - 1 {
+			hash <<= 1
+			if grey[y][x] > grey[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// Decodes the JPEG, PNG or GIF image from r and returns its hash.
+func Decode(r io.Reader) (Hash, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding image: %v", err)
+	}
+
+	return Compute(img), nil
+}
+
+// Returns the number of bits the hashes differ in, 0 for the same images and 64 at most.
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// Formats the hash as 16 hexadecimal digits.
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Stores the hash as its hexadecimal digits, JSON numbers lose the precision of the large hashes.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	value, err := strconv.ParseUint(string(text), 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid image hash %q", text)
+	}
+
+	*h = Hash(value)
+	return nil
+}
@@ -0,0 +1,78 @@
+package imagehash
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+	"testing"
+)
+
+func hashFile(t *testing.T, name string) Hash {
+	t.Helper()
+
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	hash, err := Decode(f)
+	if err != nil {
+		t.Fatalf("Decode(%s): %v", name, err)
+	}
+
+	return hash
+}
+
+func TestDistance(t *testing.T) {
+	original := hashFile(t, "jacket.png")
+
+	tests := []struct {
+		name    string
+		similar bool
+	}{
+		// Half the size, brighter and recompressed as JPEG
+		{"jacket_repost.jpg", true},
+		// The same kind of picture, the jacket moved aside
+		{"jacket_other.jpg", false},
+		{"shoe.png", false},
+	}
+	for _, tt := range tests {
+		distance := Distance(original, hashFile(t, tt.name))
+		if similar := distance <= 8; similar != tt.similar {
+			t.Errorf("distance of jacket.png and %s = %d, want similar = %v", tt.name, distance, tt.similar)
+		}
+	}
+
+	if distance := Distance(original, original); distance != 0 {
+		t.Errorf("distance of the same hash = %d, want 0", distance)
+	}
+}
+
+func TestComputeEmpty(t *testing.T) {
+	if hash := Compute(image.NewGray(image.Rect(0, 0, 0, 0))); hash != 0 {
+		t.Errorf("Compute(empty) = %v, want 0", hash)
+	}
+	// Smaller than the grey image
+	Compute(image.NewGray(image.Rect(0, 0, 3, 2)))
+}
+
+func TestHashJSON(t *testing.T) {
+	hash := Hash(0xfedcba9876543210)
+
+	data, err := json.Marshal(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"fedcba9876543210"` {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	var decoded Hash
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != hash {
+		t.Errorf("json.Unmarshal() = %v, want %v", decoded, hash)
+	}
+}
@@ -1,21 +1,89 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/smatand/vinted_go/agent"
 	discordBot "github.com/smatand/vinted_go/bot"
+	"github.com/smatand/vinted_go/slack"
 )
 
+// Fits into the 10s docker stop waits before it kills the container.
+const defaultShutdownTimeout = 8 * time.Second
+
 func main() {
+	unregister := flag.Bool("unregister-commands", false, "delete all registered slash commands and exit")
+	flag.Parse()
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatalf("Error loading the .env file: %s", err)
 	}
 
-	token := os.Getenv("DISCORD_TOKEN")
-	guildID := os.Getenv("GUILD_ID")
+	cfg := discordBot.Config{
+		Token:             os.Getenv("DISCORD_TOKEN"),
+		GuildIDs:          discordBot.SplitIDs(os.Getenv("GUILD_ID")),
+		GlobalCommands:    os.Getenv("GLOBAL_COMMANDS") == "true",
+		DefaultChannelIDs: discordBot.SplitIDs(os.Getenv("CHANNEL_IDS")),
+		ManageRoleID:      os.Getenv("MANAGE_ROLE_ID"),
+		ShutdownTimeout:   defaultShutdownTimeout,
+		Agent:             agent.DefaultConfig(),
+		NtfyToken:         os.Getenv("NTFY_TOKEN"),
+		Slack: slack.Config{
+			BotToken:      os.Getenv("SLACK_BOT_TOKEN"),
+			SigningSecret: os.Getenv("SLACK_SIGNING_SECRET"),
+			Addr:          os.Getenv("SLACK_ADDR"),
+		},
+		SMTP: discordBot.SMTPConfig{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		},
+	}
+
+	cfg.Telegram.Token = os.Getenv("TELEGRAM_TOKEN")
+	cfg.Telegram.AllowedUserIDs, err = discordBot.SplitIntIDs(os.Getenv("TELEGRAM_ALLOWED_USERS"))
+	if err != nil {
+		log.Fatalf("Invalid TELEGRAM_ALLOWED_USERS: %s", err)
+	}
+
+	if workers := os.Getenv("AGENT_WORKERS"); workers != "" {
+		cfg.Agent.Workers, err = strconv.Atoi(workers)
+		if err != nil {
+			log.Fatalf("Invalid AGENT_WORKERS: %s", err)
+		}
+	}
+
+	cfg.Agent.RatesSource = os.Getenv("RATES_URL")
+
+	if distance := os.Getenv("REPOST_MAX_DISTANCE"); distance != "" {
+		cfg.Agent.RepostDistance, err = strconv.Atoi(distance)
+		if err != nil || cfg.Agent.RepostDistance < 1 || cfg.Agent.RepostDistance > 64 {
+			log.Fatalf("Invalid REPOST_MAX_DISTANCE: %s, want 1 to 64", distance)
+		}
+	}
+
+	if timeout := os.Getenv("SHUTDOWN_TIMEOUT"); timeout != "" {
+		cfg.ShutdownTimeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("Invalid SHUTDOWN_TIMEOUT: %s", err)
+		}
+	}
+
+	if *unregister {
+		if err := discordBot.UnregisterCommands(cfg); err != nil {
+			log.Fatalf("Error unregistering the commands: %s", err)
+		}
+		return
+	}
 
-	discordBot.Run(token, guildID)
+	if err := discordBot.Run(cfg); err != nil {
+		log.Fatalf("Error running the bot: %s", err)
+	}
 }
@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+)
+
+const (
+	// Items shown in a digest unless the delivery says otherwise.
+	DefaultDigestSize = 10
+	MaxDigestSize     = 25
+	// Time of the daily digest unless the delivery says otherwise, in minutes after midnight.
+	defaultDigestAt = 8 * 60
+	clockLayout     = "15:04"
+)
+
+// Checks the delivery schedule of a watcher or a channel.
+func ValidateDelivery(d db.Delivery) error {
+	if (d.QuietFrom == "") != (d.QuietTo == "") {
+		return fmt.Errorf("quiet hours need both the start and the end")
+	}
+	for _, clock := range []string{d.QuietFrom, d.QuietTo, d.DigestAt} {
+		if _, err := parseClock(clock, 0); err != nil {
+			return err
+		}
+	}
+	if d.QuietFrom != "" && d.QuietFrom == d.QuietTo {
+		return fmt.Errorf("quiet hours must not start and end at the same time")
+	}
+
+	if _, err := time.LoadLocation(d.Timezone); err != nil {
+		return fmt.Errorf("unknown time zone %q, use e.g. Europe/Bratislava", d.Timezone)
+	}
+
+	switch d.Digest {
+	case db.DigestOff, db.DigestHourly, db.DigestDaily:
+	default:
+		return fmt.Errorf("unknown digest %q", d.Digest)
+	}
+
+	switch d.DigestOrder {
+	case db.DigestNewest, db.DigestBestDeals:
+	default:
+		return fmt.Errorf("unknown digest order %q", d.DigestOrder)
+	}
+
+	if d.DigestSize < 0 || d.DigestSize > MaxDigestSize {
+		return fmt.Errorf("digest size must be between 1 and %d", MaxDigestSize)
+	}
+
+	return nil
+}
+
+// Parses the "15:04" clock to minutes after midnight, "" is the fallback.
+func parseClock(clock string, fallback int) (int, error) {
+	if clock == "" {
+		return fallback, nil
+	}
+
+	t, err := time.Parse(clockLayout, clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use e.g. 22:00", clock)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Returns the time at the given minutes after the midnight of the day of t, in the location of t.
+func dayAt(t time.Time, minutes int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), minutes/60, minutes%60, 0, 0, t.Location())
+}
+
+// Returns the end of the quiet hours t falls in, quiet is false if t is outside of them.
+func quietEnd(d db.Delivery, t time.Time) (end time.Time, quiet bool) {
+	if d.QuietFrom == "" {
+		return time.Time{}, false
+	}
+
+	from, _ := parseClock(d.QuietFrom, 0)
+	to, _ := parseClock(d.QuietTo, 0)
+	minutes := t.Hour()*60 + t.Minute()
+
+	switch {
+	case from < to && minutes >= from && minutes < to:
+		return dayAt(t, to), true
+	// The quiet hours over the midnight, e.g. 22:00 to 07:00
+	case from > to && minutes >= from:
+		return dayAt(t.AddDate(0, 0, 1), to), true
+	case from > to && minutes < to:
+		return dayAt(t, to), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// Returns the time the item found at now is delivered at by the schedule d, held is false if it is
+// delivered right away. The digests falling into the quiet hours wait for their end.
+func ReleaseTime(d db.Delivery, now time.Time) (release time.Time, held bool) {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	release = now.In(loc)
+
+	switch d.Digest {
+	case db.DigestHourly:
+		release = time.Date(release.Year(), release.Month(), release.Day(), release.Hour()+1, 0, 0, 0, loc)
+		held = true
+	case db.DigestDaily:
+		at, _ := parseClock(d.DigestAt, defaultDigestAt)
+		next := dayAt(release, at)
+		if !next.After(release) {
+			next = dayAt(release.AddDate(0, 0, 1), at)
+		}
+		release = next
+		held = true
+	}
+
+	if end, quiet := quietEnd(d, release); quiet {
+		release = end
+		held = true
+	}
+
+	return release, held
+}
+
+// Holds the entry found at now for the digest if the schedule d says so.
+func Hold(entry *db.OutboxEntry, d db.Delivery, now time.Time) {
+	release, held := ReleaseTime(d, now)
+	if !held {
+		return
+	}
+
+	size := d.DigestSize
+	if size == 0 {
+		size = DefaultDigestSize
+	}
+	entry.NextAttempt = release
+	entry.Digest = &db.DigestOptions{Size: size, Order: d.DigestOrder}
+}
+
+// Returns the entries shown in the digest of the given entries, by the options of the first one:
+// the newest or the best deals first. The other entries are only counted in the digest.
+func DigestItems(entries []db.OutboxEntry) []db.OutboxEntry {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	options := db.DigestOptions{Size: DefaultDigestSize}
+	if entries[0].Digest != nil {
+		options = *entries[0].Digest
+	}
+
+	sorted := append([]db.OutboxEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if options.Order == db.DigestBestDeals && (a.Deal == nil) != (b.Deal == nil) {
+			return a.Deal != nil
+		}
+		if options.Order == db.DigestBestDeals && a.Deal != nil && a.Deal.Score != b.Deal.Score {
+			return a.Deal.Score > b.Deal.Score
+		}
+
+		return a.ID > b.ID
+	})
+
+	return sorted[:min(len(sorted), max(options.Size, 1))]
+}
@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// Records the digests besides the single entries.
+type fakeDigestNotifier struct {
+	fakeNotifier
+	digests [][]db.OutboxEntry
+}
+
+func (n *fakeDigestNotifier) NotifyDigest(ctx context.Context, entries []db.OutboxEntry) error {
+	n.digests = append(n.digests, entries)
+	return nil
+}
+
+func TestReleaseTime(t *testing.T) {
+	bratislava, err := time.LoadLocation("Europe/Bratislava")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, bratislava)
+	}
+	quiet := db.Delivery{QuietFrom: "22:00", QuietTo: "07:00", Timezone: "Europe/Bratislava"}
+
+	tests := []struct {
+		name     string
+		delivery db.Delivery
+		now      time.Time
+		want     time.Time
+		held     bool
+	}{
+		{"no schedule", db.Delivery{}, at(19, 3, 0), at(19, 3, 0), false},
+		{"before quiet hours", quiet, at(19, 21, 59), at(19, 21, 59), false},
+		{"quiet before midnight", quiet, at(19, 23, 30), at(20, 7, 0), true},
+		{"quiet after midnight", quiet, at(20, 3, 0), at(20, 7, 0), true},
+		{"daytime quiet hours", db.Delivery{QuietFrom: "09:00", QuietTo: "17:00", Timezone: "Europe/Bratislava"}, at(19, 12, 0), at(19, 17, 0), true},
+		{"hourly", db.Delivery{Digest: db.DigestHourly, Timezone: "Europe/Bratislava"}, at(19, 12, 10), at(19, 13, 0), true},
+		{"hourly into quiet hours", db.Delivery{QuietFrom: "22:00", QuietTo: "07:00", Digest: db.DigestHourly, Timezone: "Europe/Bratislava"}, at(19, 21, 30), at(20, 7, 0), true},
+		{"daily later today", db.Delivery{Digest: db.DigestDaily, DigestAt: "18:00", Timezone: "Europe/Bratislava"}, at(19, 12, 0), at(19, 18, 0), true},
+		{"daily tomorrow", db.Delivery{Digest: db.DigestDaily, Timezone: "Europe/Bratislava"}, at(19, 8, 0), at(20, 8, 0), true},
+	}
+	for _, tt := range tests {
+		got, held := ReleaseTime(tt.delivery, tt.now)
+		if !got.Equal(tt.want) || held != tt.held {
+			t.Errorf("%s: ReleaseTime() = %v, %v, want %v, %v", tt.name, got, held, tt.want, tt.held)
+		}
+	}
+}
+
+func TestValidateDelivery(t *testing.T) {
+	valid := []db.Delivery{
+		{},
+		{QuietFrom: "22:00", QuietTo: "07:00", Timezone: "Europe/Bratislava"},
+		{Digest: db.DigestDaily, DigestAt: "18:30", DigestSize: 5, DigestOrder: db.DigestBestDeals},
+	}
+	for _, d := range valid {
+		if err := ValidateDelivery(d); err != nil {
+			t.Errorf("ValidateDelivery(%+v) error = %v", d, err)
+		}
+	}
+
+	invalid := []db.Delivery{
+		{QuietFrom: "22:00"},
+		{QuietFrom: "22:00", QuietTo: "22:00"},
+		{QuietFrom: "25:00", QuietTo: "07:00"},
+		{Timezone: "Mars/Olympus"},
+		{Digest: "weekly"},
+		{DigestSize: MaxDigestSize + 1},
+	}
+	for _, d := range invalid {
+		if err := ValidateDelivery(d); err == nil {
+			t.Errorf("ValidateDelivery(%+v) = nil, want error", d)
+		}
+	}
+}
+
+func TestDigestItems(t *testing.T) {
+	entries := []db.OutboxEntry{
+		{ID: 1, Digest: &db.DigestOptions{Size: 2, Order: db.DigestBestDeals}, Deal: &db.Deal{Score: 10}},
+		{ID: 2},
+		{ID: 3, Deal: &db.Deal{Score: 30}},
+		{ID: 4, Deal: &db.Deal{Score: -5}},
+	}
+	if got := DigestItems(entries); len(got) != 2 || got[0].ID != 3 || got[1].ID != 1 {
+		t.Errorf("DigestItems() by deals = %+v, want items 3 and 1", got)
+	}
+
+	entries[0].Digest.Order = db.DigestNewest
+	if got := DigestItems(entries); len(got) != 2 || got[0].ID != 4 || got[1].ID != 3 {
+		t.Errorf("DigestItems() by newest = %+v, want items 4 and 3", got)
+	}
+}
+
+func TestDispatcherDigest(t *testing.T) {
+	outboxPath := filepath.Join(t.TempDir(), "outbox.json")
+	discord := &fakeDigestNotifier{fakeNotifier: fakeNotifier{name: SinkDiscord}}
+	webhook := &fakeNotifier{name: SinkWebhook}
+
+	d := NewDispatcher(outboxPath)
+	d.Register(discord)
+	d.Register(webhook)
+
+	digest := &db.DigestOptions{Size: 10}
+	past := time.Now().Add(-time.Minute)
+	item := vintedApi.VintedItemResp{ID: 1, Title: "Jacket"}
+	err := d.Enqueue([]db.OutboxEntry{
+		{WatcherID: 1, Sink: SinkDiscord, ChannelID: "c1", Item: item, Digest: digest, NextAttempt: past},
+		{WatcherID: 2, Sink: SinkDiscord, ChannelID: "c1", Item: item, Digest: digest, NextAttempt: past},
+		{WatcherID: 1, Sink: SinkDiscord, ChannelID: "c2", Item: item, Digest: digest, NextAttempt: past},
+		// Held for later
+		{WatcherID: 1, Sink: SinkDiscord, ChannelID: "c1", Item: item, Digest: digest, NextAttempt: time.Now().Add(time.Hour)},
+		// Without digests the held items come one by one
+		{WatcherID: 1, Sink: SinkWebhook, Target: "https://example.com/hook", Item: item, Digest: digest, NextAttempt: past},
+		{WatcherID: 1, Sink: SinkWebhook, Target: "https://example.com/hook", Item: item, Digest: digest, NextAttempt: past},
+	})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	d.deliverDueEntries(context.Background())
+
+	if len(discord.digests) != 2 || len(discord.digests[0]) != 2 || len(discord.digests[1]) != 1 {
+		t.Errorf("digests = %+v, want 2 items to c1 and 1 to c2", discord.digests)
+	}
+	if len(discord.delivered) != 0 {
+		t.Errorf("discord delivered %+v one by one", discord.delivered)
+	}
+	if len(webhook.delivered) != 2 {
+		t.Errorf("webhook delivered %d entries, want 2", len(webhook.delivered))
+	}
+
+	entries, err := db.DueOutboxEntries(outboxPath, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("DueOutboxEntries() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("pending entries = %+v, want the held one", entries)
+	}
+}
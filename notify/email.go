@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+)
+
+// Limit of the whole conversation with the SMTP server when the ctx has no deadline.
+const smtpTimeout = time.Minute
+
+// Emails the new items through the SMTP server, the target is the recipient address.
+type SMTPNotifier struct {
+	// Address of the server, host:port.
+	Addr string
+	// Optional, smtp.PlainAuth requires TLS unless the server is on localhost.
+	Auth smtp.Auth
+	From string
+}
+
+func (n *SMTPNotifier) Name() string {
+	return SinkEmail
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, entry db.OutboxEntry) error {
+	if strings.ContainsAny(entry.Target, "\r\n") {
+		return &PermanentError{Err: fmt.Errorf("invalid recipient %q", entry.Target)}
+	}
+
+	if err := n.send(ctx, entry.Target, n.message(entry)); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+
+	return nil
+}
+
+// Sends the message like smtp.SendMail, but the connection is closed once the ctx is done.
+func (n *SMTPNotifier) send(ctx context.Context, to string, message []byte) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, smtpTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	// Unblocks the reads and writes when the ctx is cancelled before the deadline
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(n.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(n.Auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(n.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+func (n *SMTPNotifier) message(entry db.OutboxEntry) []byte {
+	item := entry.Item
+
+	var b strings.Builder
+	b.WriteString("From: " + n.From + "\r\n")
+	b.WriteString("To: " + entry.Target + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", "Vinted: "+Headline(entry)) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	fmt.Fprintf(&b, "<h2><a href=\"%s\">%s</a></h2>\r\n", html.EscapeString(item.Url), html.EscapeString(Headline(entry)))
+	fmt.Fprintf(&b, "<p>%s %s</p>\r\n", html.EscapeString(PriceText(entry)), html.EscapeString(item.BrandTitle))
+	if deal := DealText(entry); deal != "" {
+		fmt.Fprintf(&b, "<p>%s</p>\r\n", html.EscapeString(deal))
+	}
+	if item.Photo.Url != "" {
+		fmt.Fprintf(&b, "<img src=\"%s\" alt=\"\">\r\n", html.EscapeString(item.Photo.Url))
+	}
+
+	return []byte(b.String())
+}
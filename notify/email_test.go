@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Accepts a single message over plain SMTP and returns its data.
+func fakeSMTPServer(t *testing.T) (addr string, received <-chan string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					ch <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return l.Addr().String(), ch
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+
+	n := &SMTPNotifier{Addr: addr, From: "bot@example.com"}
+	if err := n.Notify(context.Background(), testEntry("me@example.com")); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	message := <-received
+	for _, want := range []string{"To: me@example.com", "Subject: =?utf-8?q?Vinted:_Kab=C3=A1t?=", `href="https://www.vinted.sk/items/7"`} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message does not contain %q:\n%s", want, message)
+		}
+	}
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	// The server accepts the connection, but never greets
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	n := &SMTPNotifier{Addr: l.Addr().String(), From: "bot@example.com"}
+	done := make(chan error, 1)
+	go func() { done <- n.Notify(ctx, testEntry("me@example.com")) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Notify() error = nil, want timeout")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify() did not return after the ctx deadline")
+	}
+}
+
+func TestWriterNotifier(t *testing.T) {
+	var b strings.Builder
+	n := &WriterNotifier{W: &b}
+	if err := n.Notify(context.Background(), testEntry("")); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if want := "[watcher 3] Kabát | 12.5 | https://www.vinted.sk/items/7\n"; b.String() != want {
+		t.Errorf("printed %q, want %q", b.String(), want)
+	}
+}
@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// Wait used when a rate limited target does not say how long to wait.
+const defaultRetryAfter = 30 * time.Second
+
+// Posts the new items as JSON to the target URL.
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+// JSON body posted by the WebhookNotifier.
+type webhookPayload struct {
+	WatcherID int                      `json:"watcher_id"`
+	CreatedAt time.Time                `json:"created_at"`
+	Item      vintedApi.VintedItemResp `json:"item"`
+	// "" for a new item, "price_drop" for a price drop with the previous price in OldPrice.
+	Kind string `json:"kind,omitempty"`
+	// Prices in the display currency of the watcher.
+	Price      currency.Money `json:"price,omitzero"`
+	TotalPrice currency.Money `json:"total_price,omitzero"`
+	OldPrice   currency.Money `json:"old_price,omitzero"`
+	Deal       *db.Deal       `json:"deal,omitempty"`
+	RepostOf   int            `json:"repost_of,omitempty"`
+}
+
+func (n *WebhookNotifier) Name() string {
+	return SinkWebhook
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, entry db.OutboxEntry) error {
+	body, err := json.Marshal(webhookPayload{
+		WatcherID:  entry.WatcherID,
+		CreatedAt:  entry.CreatedAt,
+		Item:       entry.Item,
+		Kind:       entry.Kind,
+		Price:      entry.Price,
+		TotalPrice: entry.TotalPrice,
+		OldPrice:   entry.OldPrice,
+		Deal:       entry.Deal,
+		RepostOf:   entry.RepostOf,
+	})
+	if err != nil {
+		return &PermanentError{Err: fmt.Errorf("error marshalling webhook payload: %v", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, entry.Target, bytes.NewReader(body))
+	if err != nil {
+		return &PermanentError{Err: fmt.Errorf("invalid webhook url: %v", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doRequest(n.Client, req)
+}
+
+// Publishes the new items to a ntfy topic, the target is the topic URL, e.g. https://ntfy.sh/my-topic.
+type NtfyNotifier struct {
+	Client *http.Client
+	// Access token of protected topics, optional.
+	Token string
+}
+
+func (n *NtfyNotifier) Name() string {
+	return SinkNtfy
+}
+
+func (n *NtfyNotifier) Notify(ctx context.Context, entry db.OutboxEntry) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, entry.Target, bytes.NewBufferString(itemSummary(entry)))
+	if err != nil {
+		return &PermanentError{Err: fmt.Errorf("invalid ntfy url: %v", err)}
+	}
+
+	// Headers are ASCII only, ntfy decodes the RFC 2047 encoded ones
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", Headline(entry)))
+	req.Header.Set("Click", entry.Item.Url)
+	req.Header.Set("Tags", "shopping_bags")
+	if entry.Item.Photo.Url != "" {
+		req.Header.Set("Attach", entry.Item.Photo.Url)
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+
+	return doRequest(n.Client, req)
+}
+
+// Pushes the new items to a Gotify server, the target is the message URL with the application token,
+// e.g. https://gotify.example.com/message?token=XYZ.
+type GotifyNotifier struct {
+	Client *http.Client
+}
+
+// JSON body of the Gotify message.
+type gotifyMessage struct {
+	Title    string         `json:"title"`
+	Message  string         `json:"message"`
+	Priority int            `json:"priority"`
+	Extras   map[string]any `json:"extras,omitempty"`
+}
+
+func (n *GotifyNotifier) Name() string {
+	return SinkGotify
+}
+
+func (n *GotifyNotifier) Notify(ctx context.Context, entry db.OutboxEntry) error {
+	body, err := json.Marshal(gotifyMessage{
+		Title:    Headline(entry),
+		Message:  itemSummary(entry),
+		Priority: 5,
+		Extras: map[string]any{
+			"client::notification": map[string]any{
+				"click":       map[string]string{"url": entry.Item.Url},
+				"bigImageUrl": entry.Item.Photo.Url,
+			},
+		},
+	})
+	if err != nil {
+		return &PermanentError{Err: fmt.Errorf("error marshalling gotify message: %v", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, entry.Target, bytes.NewReader(body))
+	if err != nil {
+		return &PermanentError{Err: fmt.Errorf("invalid gotify url: %v", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doRequest(n.Client, req)
+}
+
+// Sends the request and maps the response status to the notify errors: 429 asks to retry later,
+// the other 4xx are permanent and 5xx are retried with the backoff.
+func doRequest(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = publicClient
+	}
+
+	resp, err := client.Do(req)
+	if errors.Is(err, errInternalTarget) {
+		return &PermanentError{Err: fmt.Errorf("failed to make request: %v", err)}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Drain the body, so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		delay := defaultRetryAfter
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			delay = time.Duration(seconds) * time.Second
+		}
+		return &RetryAfterError{Delay: delay, Err: fmt.Errorf("status code: %v", resp.StatusCode)}
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &PermanentError{Err: fmt.Errorf("status code: %v", resp.StatusCode)}
+	default:
+		return fmt.Errorf("status code: %v", resp.StatusCode)
+	}
+}
+
+// One line about the item for the plain text notifications.
+func itemSummary(entry db.OutboxEntry) string {
+	summary := PriceText(entry)
+	if entry.Item.BrandTitle != "" {
+		summary += " · " + entry.Item.BrandTitle
+	}
+	if deal := DealText(entry); deal != "" {
+		summary += "\n" + deal
+	}
+
+	return summary + "\n" + entry.Item.Url
+}
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func testEntry(target string) db.OutboxEntry {
+	item := vintedApi.VintedItemResp{ID: 7, Title: "Kabát", Url: "https://www.vinted.sk/items/7", BrandTitle: "Zara"}
+	item.Price.Amount = "12.5"
+	item.Photo.Url = "https://images.vinted.net/7.jpg"
+
+	return db.OutboxEntry{WatcherID: 3, Target: target, Item: item}
+}
+
+func TestHTTPNotifiers(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	t.Run("webhook", func(t *testing.T) {
+		n := &WebhookNotifier{Client: srv.Client()}
+		if err := n.Notify(context.Background(), testEntry(srv.URL+"/hook")); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+
+		var payload webhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatalf("invalid payload %s: %v", body, err)
+		}
+		if got.URL.Path != "/hook" || payload.WatcherID != 3 || payload.Item.ID != 7 {
+			t.Errorf("posted %s %s, want the item 7 of watcher 3 to /hook", got.URL.Path, body)
+		}
+	})
+
+	t.Run("ntfy", func(t *testing.T) {
+		n := &NtfyNotifier{Client: srv.Client(), Token: "secret"}
+		if err := n.Notify(context.Background(), testEntry(srv.URL+"/topic")); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+
+		if title := got.Header.Get("Title"); title != "=?utf-8?q?Kab=C3=A1t?=" {
+			t.Errorf("Title = %q, want the encoded title", title)
+		}
+		if got.Header.Get("Click") != "https://www.vinted.sk/items/7" || got.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("headers = %v", got.Header)
+		}
+		if want := "12.5 · Zara\nhttps://www.vinted.sk/items/7"; string(body) != want {
+			t.Errorf("body = %q, want %q", body, want)
+		}
+	})
+
+	t.Run("gotify", func(t *testing.T) {
+		n := &GotifyNotifier{Client: srv.Client()}
+		if err := n.Notify(context.Background(), testEntry(srv.URL+"/message?token=abc")); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+
+		var message gotifyMessage
+		if err := json.Unmarshal(body, &message); err != nil {
+			t.Fatalf("invalid message %s: %v", body, err)
+		}
+		if got.URL.Query().Get("token") != "abc" || message.Title != "Kabát" {
+			t.Errorf("posted %s to %s", body, got.URL)
+		}
+	})
+}
+
+func TestDoRequestStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		retryAfter    string
+		wantErr       bool
+		wantPermanent bool
+		wantDelay     time.Duration
+	}{
+		{name: "ok", status: http.StatusNoContent},
+		{name: "rate limited", status: http.StatusTooManyRequests, retryAfter: "7", wantErr: true, wantDelay: 7 * time.Second},
+		{name: "rate limited without header", status: http.StatusTooManyRequests, wantErr: true, wantDelay: defaultRetryAfter},
+		{name: "unauthorized", status: http.StatusUnauthorized, wantErr: true, wantPermanent: true},
+		{name: "server error", status: http.StatusBadGateway, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			err := (&WebhookNotifier{Client: srv.Client()}).Notify(context.Background(), testEntry(srv.URL))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var permanent *PermanentError
+			if errors.As(err, &permanent) != tt.wantPermanent {
+				t.Errorf("Notify() error = %v, want permanent %v", err, tt.wantPermanent)
+			}
+
+			var retryAfter *RetryAfterError
+			if errors.As(err, &retryAfter) && retryAfter.Delay != tt.wantDelay {
+				t.Errorf("retry after %v, want %v", retryAfter.Delay, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestPublicClientRefusesInternalTargets(t *testing.T) {
+	requested := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer srv.Close()
+
+	// The default client is used, the test server listens on the loopback
+	err := (&WebhookNotifier{}).Notify(context.Background(), testEntry(srv.URL))
+	var permanent *PermanentError
+	if !errors.As(err, &permanent) {
+		t.Errorf("Notify() error = %v, want permanent error", err)
+	}
+	if requested {
+		t.Error("the request reached the loopback server")
+	}
+}
+
+func TestPriceText(t *testing.T) {
+	entry := testEntry("")
+	if got := PriceText(entry); got != "12.5" {
+		t.Errorf("PriceText() of an older entry = %q, want the raw price", got)
+	}
+
+	entry.Item.Price.CurrencyCode = "EUR"
+	entry.Price = currency.Money{Amount: 1250, Currency: "EUR"}
+	if got := PriceText(entry); got != "12.50 EUR" {
+		t.Errorf("PriceText() = %q, want %q", got, "12.50 EUR")
+	}
+
+	entry.Price = currency.Money{Amount: 31250, Currency: "CZK"}
+	if got := PriceText(entry); got != "312.50 CZK (12.5 EUR)" {
+		t.Errorf("PriceText() of a converted price = %q, want %q", got, "312.50 CZK (12.5 EUR)")
+	}
+}
+
+func TestPriceDropText(t *testing.T) {
+	entry := testEntry("")
+	entry.Kind = db.OutboxPriceDrop
+	entry.Price = currency.Money{Amount: 2500, Currency: "EUR"}
+	entry.OldPrice = currency.Money{Amount: 3000, Currency: "EUR"}
+
+	if got, want := PriceText(entry), "25.00 EUR, was 30.00 EUR (-17%)"; got != want {
+		t.Errorf("PriceText() = %q, want %q", got, want)
+	}
+	if got, want := Headline(entry), "Price drop: Kabát"; got != want {
+		t.Errorf("Headline() = %q, want %q", got, want)
+	}
+	entry.Kind = db.OutboxNewItem
+	entry.RepostOf = 5
+	if got, want := Headline(entry), "Repost: Kabát"; got != want {
+		t.Errorf("Headline() of a repost = %q, want %q", got, want)
+	}
+}
+
+func TestDealText(t *testing.T) {
+	entry := testEntry("")
+	if got := DealText(entry); got != "" {
+		t.Errorf("DealText() without deal = %q, want empty", got)
+	}
+
+	tests := []struct {
+		score int
+		want  string
+	}{
+		{32, "32% below typical price for this search"},
+		{-5, "5% above typical price for this search"},
+		{0, "typical price for this search"},
+	}
+	for _, tt := range tests {
+		entry.Deal = &db.Deal{Score: tt.score, Basis: "this search"}
+		if got := DealText(entry); got != tt.want {
+			t.Errorf("DealText(%d) = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+// Package notify delivers the items found by the agent through the outbox to the notifiers,
+// e.g. Discord, webhooks, push services or email.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+)
+
+// Names of the sinks, used as db.Sink.Type and db.OutboxEntry.Sink.
+const (
+	SinkDiscord = "discord"
+	SinkWebhook = "webhook"
+	SinkNtfy    = "ntfy"
+	SinkGotify  = "gotify"
+	SinkEmail   = "email"
+	SinkStdout  = "stdout"
+	// Target is the chat ID.
+	SinkTelegram = "telegram"
+	// Target is the channel ID.
+	SinkSlack = "slack"
+)
+
+const (
+	// How often the outbox is checked for the entries due to a retry.
+	outboxPollInterval = 5 * time.Second
+	maxOutboxBackoff   = 30 * time.Minute
+	// The delivery is given up after this many failed attempts.
+	maxOutboxAttempts = 12
+	// Delivered entries are kept this long for troubleshooting.
+	outboxRetention = 24 * time.Hour
+	// How often the entries older than outboxRetention are pruned.
+	outboxPruneInterval = time.Hour
+)
+
+// Delivers a single outbox entry to its target.
+type Notifier interface {
+	// Name of the sink the notifier handles, e.g. SinkWebhook.
+	Name() string
+	Notify(ctx context.Context, entry db.OutboxEntry) error
+}
+
+// Implemented by the notifiers delivering the items held for a digest as a single message, see Hold.
+// The held items of the other notifiers are delivered one by one when the digest is due.
+type DigestNotifier interface {
+	// Delivers the entries with the same destination, the first DigestItems of them are shown.
+	NotifyDigest(ctx context.Context, entries []db.OutboxEntry) error
+}
+
+// Implemented by the notifiers delivering several items with the same destination at once, e.g. in
+// a single message. The due entries of their sink are always delivered in batches.
+type BatchNotifier interface {
+	// Delivers the entries in their order, returns the error of every entry, nil if it was delivered.
+	NotifyBatch(ctx context.Context, entries []db.OutboxEntry) []error
+}
+
+// Returned by the notifiers when the target asks to wait, e.g. on a rate limit.
+// It does not count towards giving up the delivery.
+type RetryAfterError struct {
+	Delay time.Duration
+	Err   error
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("retry after %v: %v", e.Delay, e.Err)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// Returned by the notifiers when retrying cannot help, e.g. an invalid target.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Runs the outbox, every entry is delivered by the notifier registered for its sink.
+type Dispatcher struct {
+	notifiers  map[string]Notifier
+	outboxPath string
+	wake       chan struct{}
+}
+
+// Creates the dispatcher of the outbox file outboxPath, "" is the default outbox.
+func NewDispatcher(outboxPath string) *Dispatcher {
+	return &Dispatcher{
+		notifiers:  make(map[string]Notifier),
+		outboxPath: outboxPath,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Registers the notifier for its sink, replacing the previous one. Must be called before Run.
+func (d *Dispatcher) Register(n Notifier) {
+	d.notifiers[n.Name()] = n
+}
+
+// Reports whether a notifier for the sink is registered.
+func (d *Dispatcher) Supports(sink string) bool {
+	_, ok := d.notifiers[sink]
+	return ok
+}
+
+// Stores the entries in the outbox and wakes up the dispatcher.
+func (d *Dispatcher) Enqueue(entries []db.OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := db.EnqueueOutbox(d.outboxPath, entries); err != nil {
+		return err
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Delivers the due outbox entries until the ctx is cancelled. Once draining is closed, it returns
+// as soon as there is nothing due. Undelivered entries stay in the outbox for the next start.
+func (d *Dispatcher) Run(ctx context.Context, draining <-chan struct{}) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(outboxPruneInterval)
+	defer pruneTicker.Stop()
+
+	d.prune()
+
+	for {
+		d.deliverDueEntries(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-draining:
+			// Entries waiting for the backoff are not retried during the shutdown.
+			if !d.hasDueEntries() {
+				return
+			}
+		case <-d.wake:
+		case <-ticker.C:
+		case <-pruneTicker.C:
+			d.prune()
+		}
+	}
+}
+
+// Removes the delivered and given up entries created more than outboxRetention ago.
+func (d *Dispatcher) prune() {
+	if err := db.PruneOutbox(d.outboxPath, time.Now().Add(-outboxRetention)); err != nil {
+		log.Printf("error pruning the outbox: %v", err)
+	}
+}
+
+// Tries to deliver every due entry of the outbox once.
+func (d *Dispatcher) deliverDueEntries(ctx context.Context) {
+	due, err := db.DueOutboxEntries(d.outboxPath, time.Now())
+	if err != nil {
+		log.Printf("error reading the outbox: %v", err)
+		return
+	}
+
+	// The held items of the same destination are delivered together
+	digests := make(map[string][]db.OutboxEntry)
+	var keys []string
+	for _, entry := range due {
+		if entry.Digest == nil {
+			continue
+		}
+		if _, ok := d.notifiers[sinkOf(entry)].(DigestNotifier); !ok {
+			continue
+		}
+
+		key := destinationKey(entry)
+		if _, ok := digests[key]; !ok {
+			keys = append(keys, key)
+		}
+		digests[key] = append(digests[key], entry)
+	}
+
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+
+		entries := digests[key]
+		err := d.notifiers[sinkOf(entries[0])].(DigestNotifier).NotifyDigest(ctx, entries)
+		if err == nil {
+			log.Printf("delivered digest of %d items to %s", len(entries), sinkOf(entries[0]))
+		}
+		for _, entry := range entries {
+			d.recordAttempt(entry, err)
+		}
+	}
+
+	// The other items of the same destination are delivered together where the sink can
+	batches := make(map[string][]db.OutboxEntry)
+	keys = nil
+	for _, entry := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, ok := digests[destinationKey(entry)]; ok && entry.Digest != nil {
+			continue
+		}
+
+		if _, ok := d.notifiers[sinkOf(entry)].(BatchNotifier); ok {
+			key := destinationKey(entry)
+			if _, ok := batches[key]; !ok {
+				keys = append(keys, key)
+			}
+			batches[key] = append(batches[key], entry)
+			continue
+		}
+
+		err := d.notify(ctx, entry)
+		if err == nil {
+			log.Printf("delivered to %s: %s", sinkOf(entry), Headline(entry))
+		}
+		d.recordAttempt(entry, err)
+	}
+
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+
+		entries := batches[key]
+		errs := d.notifiers[sinkOf(entries[0])].(BatchNotifier).NotifyBatch(ctx, entries)
+		for i, entry := range entries {
+			if errs[i] == nil {
+				log.Printf("delivered to %s: %s", sinkOf(entry), Headline(entry))
+			}
+			d.recordAttempt(entry, errs[i])
+		}
+	}
+}
+
+// Marks the entry delivered, or failed with the err.
+func (d *Dispatcher) recordAttempt(entry db.OutboxEntry, err error) {
+	if err == nil {
+		if err := db.MarkOutboxDelivered(d.outboxPath, entry.ID, time.Now()); err != nil {
+			log.Printf("error marking outbox entry %d delivered: %v", entry.ID, err)
+		}
+		return
+	}
+
+	// Rate limits say nothing about the target, they do not count towards giving up.
+	var retryAfter *RetryAfterError
+	var permanent *PermanentError
+	rateLimited := errors.As(err, &retryAfter)
+	giveUp := errors.As(err, &permanent) || (!rateLimited && entry.Attempts+1 >= maxOutboxAttempts)
+	delay := retryDelay(entry.Attempts, err)
+	if giveUp {
+		log.Printf("giving up delivery of %q to %s: %v", entry.Item.Title, sinkOf(entry), err)
+	} else {
+		log.Printf("error delivering to %s, retrying in %v: %v", sinkOf(entry), delay, err)
+	}
+
+	if err := db.MarkOutboxFailed(d.outboxPath, entry.ID, err.Error(), time.Now().Add(delay), giveUp); err != nil {
+		log.Printf("error updating outbox entry %d: %v", entry.ID, err)
+	}
+}
+
+// Returns the destination of the entry, the digests and batches are delivered per destination.
+func destinationKey(entry db.OutboxEntry) string {
+	return sinkOf(entry) + "|" + entry.Target + "|" + entry.ChannelID + "|" + entry.UserID
+}
+
+func (d *Dispatcher) notify(ctx context.Context, entry db.OutboxEntry) error {
+	n, ok := d.notifiers[sinkOf(entry)]
+	if !ok {
+		return &PermanentError{Err: fmt.Errorf("no notifier for sink %q", sinkOf(entry))}
+	}
+
+	return n.Notify(ctx, entry)
+}
+
+func (d *Dispatcher) hasDueEntries() bool {
+	due, err := db.DueOutboxEntries(d.outboxPath, time.Now())
+	return err == nil && len(due) > 0
+}
+
+// The entries stored before the sinks were introduced belong to Discord.
+func sinkOf(entry db.OutboxEntry) string {
+	if entry.Sink == "" {
+		return SinkDiscord
+	}
+
+	return entry.Sink
+}
+
+// Returns the time to wait before the next attempt. The targets asking to wait get their way,
+// other errors back off exponentially up to maxOutboxBackoff.
+func retryDelay(attempts int, err error) time.Duration {
+	var retryAfter *RetryAfterError
+	if errors.As(err, &retryAfter) {
+		return retryAfter.Delay
+	}
+
+	delay := time.Duration(1<<min(attempts, 16)) * 5 * time.Second
+	if delay > maxOutboxBackoff {
+		delay = maxOutboxBackoff
+	}
+
+	return delay
+}
+
+// Returns the outbox entries delivering the items of the watcher to its additional sinks.
+func SinkEntries(watcher db.WatcherURL) []db.OutboxEntry {
+	var entries []db.OutboxEntry
+	for _, sink := range watcher.Sinks {
+		entries = append(entries, db.OutboxEntry{WatcherID: watcher.ID, Sink: sink.Type, Target: sink.Target})
+	}
+
+	return entries
+}
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// Records the delivered entries and fails with the queued errors first.
+type fakeNotifier struct {
+	name string
+
+	mu        sync.Mutex
+	errs      []error
+	delivered []db.OutboxEntry
+}
+
+func (n *fakeNotifier) Name() string {
+	return n.name
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, entry db.OutboxEntry) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.errs) > 0 {
+		err := n.errs[0]
+		n.errs = n.errs[1:]
+		return err
+	}
+	n.delivered = append(n.delivered, entry)
+
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	outboxPath := filepath.Join(t.TempDir(), "outbox.json")
+	webhook := &fakeNotifier{name: SinkWebhook, errs: []error{errors.New("connection reset")}}
+	ntfy := &fakeNotifier{name: SinkNtfy, errs: []error{&PermanentError{Err: errors.New("status code: 404")}}}
+
+	d := NewDispatcher(outboxPath)
+	d.Register(webhook)
+	d.Register(ntfy)
+
+	item := vintedApi.VintedItemResp{ID: 1, Title: "Jacket"}
+	err := d.Enqueue([]db.OutboxEntry{
+		{WatcherID: 1, Sink: SinkWebhook, Target: "https://example.com/hook", Item: item},
+		{WatcherID: 1, Sink: SinkNtfy, Target: "https://ntfy.sh/topic", Item: item},
+		{WatcherID: 1, Sink: SinkGotify, Target: "https://gotify.example.com/message", Item: item},
+	})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	d.deliverDueEntries(context.Background())
+
+	// The webhook failed temporarily, the other two gave up
+	entries, err := db.DueOutboxEntries(outboxPath, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("DueOutboxEntries() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Sink != SinkWebhook || entries[0].Attempts != 1 {
+		t.Fatalf("pending entries = %+v, want the webhook entry after 1 attempt", entries)
+	}
+
+	if err := db.MarkOutboxFailed(outboxPath, entries[0].ID, "", time.Now(), false); err != nil {
+		t.Fatalf("MarkOutboxFailed() error = %v", err)
+	}
+	d.deliverDueEntries(context.Background())
+
+	if len(webhook.delivered) != 1 || webhook.delivered[0].Target != "https://example.com/hook" {
+		t.Errorf("webhook delivered %+v, want the retried entry", webhook.delivered)
+	}
+	if len(ntfy.delivered) != 0 {
+		t.Errorf("ntfy delivered %+v after a permanent error", ntfy.delivered)
+	}
+	if d.hasDueEntries() {
+		t.Errorf("hasDueEntries() = true, want nothing left")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		want     time.Duration
+	}{
+		{
+			name:     "first failure",
+			attempts: 0,
+			err:      errors.New("connection reset"),
+			want:     5 * time.Second,
+		},
+		{
+			name:     "third failure",
+			attempts: 3,
+			err:      errors.New("connection reset"),
+			want:     40 * time.Second,
+		},
+		{
+			name:     "capped",
+			attempts: 30,
+			err:      errors.New("connection reset"),
+			want:     maxOutboxBackoff,
+		},
+		{
+			name:     "retry after",
+			attempts: 5,
+			err:      &RetryAfterError{Delay: 3 * time.Second, Err: errors.New("status code: 429")},
+			want:     3 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryDelay(tt.attempts, tt.err); got != tt.want {
+				t.Errorf("retryDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSink(t *testing.T) {
+	tests := []struct {
+		sink    db.Sink
+		wantErr bool
+	}{
+		{sink: db.Sink{Type: SinkWebhook, Target: "https://example.com/hook"}},
+		{sink: db.Sink{Type: SinkNtfy, Target: "ntfy.sh/topic"}, wantErr: true},
+		{sink: db.Sink{Type: SinkWebhook, Target: "http://localhost:8080/hook"}, wantErr: true},
+		{sink: db.Sink{Type: SinkWebhook, Target: "http://127.0.0.1/hook"}, wantErr: true},
+		{sink: db.Sink{Type: SinkWebhook, Target: "http://169.254.169.254/latest/meta-data"}, wantErr: true},
+		{sink: db.Sink{Type: SinkNtfy, Target: "http://192.168.1.10/topic"}, wantErr: true},
+		{sink: db.Sink{Type: SinkGotify, Target: "http://[::1]/message"}, wantErr: true},
+		{sink: db.Sink{Type: SinkGotify, Target: "ftp://gotify.example.com"}, wantErr: true},
+		{sink: db.Sink{Type: SinkEmail, Target: "me@example.com"}},
+		{sink: db.Sink{Type: SinkEmail, Target: "Me <me@example.com>"}, wantErr: true},
+		{sink: db.Sink{Type: SinkStdout}},
+		{sink: db.Sink{Type: "pager"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sink.Type+" "+tt.sink.Target, func(t *testing.T) {
+			if err := ValidateSink(tt.sink); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Delivers the batches, failing the last entry of every batch.
+type fakeBatchNotifier struct {
+	fakeNotifier
+	batches [][]db.OutboxEntry
+}
+
+func (n *fakeBatchNotifier) NotifyBatch(ctx context.Context, entries []db.OutboxEntry) []error {
+	n.batches = append(n.batches, entries)
+	errs := make([]error, len(entries))
+	errs[len(errs)-1] = &RetryAfterError{Delay: time.Minute, Err: errors.New("rate limited")}
+	return errs
+}
+
+func TestDispatcherBatches(t *testing.T) {
+	outboxPath := filepath.Join(t.TempDir(), "outbox.json")
+	discord := &fakeBatchNotifier{fakeNotifier: fakeNotifier{name: SinkDiscord}}
+
+	d := NewDispatcher(outboxPath)
+	d.Register(discord)
+
+	item := vintedApi.VintedItemResp{ID: 1, Title: "Jacket"}
+	err := d.Enqueue([]db.OutboxEntry{
+		{WatcherID: 1, Sink: SinkDiscord, ChannelID: "c1", Item: item},
+		{WatcherID: 2, Sink: SinkDiscord, ChannelID: "c2", Item: item},
+		{WatcherID: 3, Sink: SinkDiscord, ChannelID: "c1", Item: item},
+	})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	d.deliverDueEntries(context.Background())
+
+	if len(discord.batches) != 2 || len(discord.batches[0]) != 2 || len(discord.batches[1]) != 1 {
+		t.Fatalf("batches = %+v, want 2 entries to c1 and 1 to c2", discord.batches)
+	}
+
+	// The rate limited entries wait for the time the notifier asked for
+	entries, err := db.DueOutboxEntries(outboxPath, time.Now().Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("DueOutboxEntries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].WatcherID != 2 || entries[1].WatcherID != 3 {
+		t.Errorf("pending entries = %+v, want the last entries of both batches", entries)
+	}
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/smatand/vinted_go/currency"
+	"github.com/smatand/vinted_go/db"
+)
+
+// Formats the price of the entry item in the display currency of the watcher, followed by the original
+// price if it was converted, e.g. "250.00 CZK (10.00 EUR)". The older entries show the raw price.
+// The price drops show the old price and the change, e.g. "25.00 EUR, was 30.00 EUR (-17%)".
+func PriceText(entry db.OutboxEntry) string {
+	return priceText(entry, false)
+}
+
+// Formats the price like PriceText, with the currency symbols, e.g. "€25.00, was €30.00 (-17%)".
+func SymbolPriceText(entry db.OutboxEntry) string {
+	return priceText(entry, true)
+}
+
+func priceText(entry db.OutboxEntry, symbols bool) string {
+	format := currency.Money.String
+	if symbols {
+		format = currency.Money.Display
+	}
+
+	if entry.Kind == db.OutboxPriceDrop && !entry.OldPrice.IsZero() && !entry.Price.IsZero() {
+		text := format(entry.Price) + ", was " + format(entry.OldPrice)
+		if entry.OldPrice.Currency == entry.Price.Currency && entry.OldPrice.Amount > 0 {
+			change := float64(entry.Price.Amount-entry.OldPrice.Amount) / float64(entry.OldPrice.Amount) * 100
+			text += fmt.Sprintf(" (%d%%)", int(math.Round(change)))
+		}
+		return text
+	}
+
+	original := strings.TrimSpace(entry.Item.Price.Amount + " " + entry.Item.Price.CurrencyCode)
+	if price, err := currency.Parse(entry.Item.Price.Amount, entry.Item.Price.CurrencyCode); symbols && err == nil {
+		original = format(price)
+	}
+	if entry.Price.IsZero() {
+		return original
+	}
+
+	if entry.Item.Price.CurrencyCode != "" && !strings.EqualFold(entry.Item.Price.CurrencyCode, entry.Price.Currency) {
+		return format(entry.Price) + " (" + original + ")"
+	}
+
+	return format(entry.Price)
+}
+
+// Returns the title of the notification about the entry item, the price drops and reposts are marked.
+func Headline(entry db.OutboxEntry) string {
+	if entry.Kind == db.OutboxPriceDrop {
+		return "Price drop: " + entry.Item.Title
+	}
+	if entry.RepostOf != 0 {
+		return "Repost: " + entry.Item.Title
+	}
+
+	return entry.Item.Title
+}
+
+// Describes how the price of the entry item compares with the typical price,
+// e.g. "32% below typical price for this search". "" if the typical price is not known.
+func DealText(entry db.OutboxEntry) string {
+	deal := entry.Deal
+	switch {
+	case deal == nil:
+		return ""
+	case deal.Score > 0:
+		return fmt.Sprintf("%d%% below typical price for %s", deal.Score, deal.Basis)
+	case deal.Score < 0:
+		return fmt.Sprintf("%d%% above typical price for %s", -deal.Score, deal.Basis)
+	default:
+		return "typical price for " + deal.Basis
+	}
+}
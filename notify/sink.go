@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+)
+
+// Checks the target of the additional sink of a watcher.
+func ValidateSink(sink db.Sink) error {
+	switch sink.Type {
+	case SinkWebhook, SinkNtfy, SinkGotify:
+		parsed, err := url.Parse(sink.Target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s target must be a http(s) url", sink.Type)
+		}
+		if isInternalHost(parsed.Hostname()) {
+			return fmt.Errorf("%s target must be a public address", sink.Type)
+		}
+	case SinkEmail:
+		addr, err := mail.ParseAddress(sink.Target)
+		if err != nil || addr.Address != sink.Target {
+			return fmt.Errorf("email target must be a plain email address")
+		}
+	case SinkStdout:
+	default:
+		return fmt.Errorf("unknown sink %q", sink.Type)
+	}
+
+	return nil
+}
+
+// Returned when a sink resolves to the host of the bot or a private network.
+var errInternalTarget = errors.New("the target is not a public address")
+
+// Client of the http sinks, it refuses to connect to the internal addresses, whatever the name of
+// the target resolves to. The proxy of the environment is not used, it would connect instead.
+var publicClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+					return errInternalTarget
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// Reports whether the host of a sink URL is the host of the bot or on a private network, e.g. the
+// cloud metadata at 169.254.169.254. The names are checked again when they are resolved.
+func isInternalHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && isInternalIP(ip)
+}
+
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
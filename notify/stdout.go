@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/smatand/vinted_go/db"
+)
+
+// Prints the new items, one per line. Useful for running without Discord or piping to other tools.
+type WriterNotifier struct {
+	// os.Stdout if nil.
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+func (n *WriterNotifier) Name() string {
+	return SinkStdout
+}
+
+func (n *WriterNotifier) Notify(ctx context.Context, entry db.OutboxEntry) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	w := n.W
+	if w == nil {
+		w = os.Stdout
+	}
+
+	_, err := fmt.Fprintf(w, "[watcher %d] %s | %s | %s\n", entry.WatcherID, Headline(entry), PriceText(entry), entry.Item.Url)
+
+	return err
+}
@@ -0,0 +1,83 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default base URL of the Slack Web API.
+const defaultAPIURL = "https://slack.com/api"
+
+// Error returned by the Web API, e.g. "channel_not_found". RetryAfter is set for the rate limited requests.
+type apiError struct {
+	Code       string
+	Status     int
+	RetryAfter time.Duration
+}
+
+func (e *apiError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("slack error, status code: %v", e.Status)
+	}
+
+	return "slack error: " + e.Code
+}
+
+// Calls the Web API method with the JSON params.
+func (a *App) call(ctx context.Context, method string, params any) error {
+	url := strings.TrimSuffix(a.cfg.APIURL, "/") + "/" + method
+
+	return a.postJSON(ctx, url, a.cfg.BotToken, params)
+}
+
+// Posts the JSON body to the url, e.g. the Web API method or the response_url of an interaction.
+func (a *App) postJSON(ctx context.Context, url string, token string, params any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("error marshalling slack request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := 30 * time.Second
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return &apiError{Code: "ratelimited", Status: resp.StatusCode, RetryAfter: retryAfter}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &apiError{Status: resp.StatusCode}
+	}
+
+	// The response_url answers with plain "ok"
+	var apiResp struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err == nil && !apiResp.OK && apiResp.Error != "" {
+		return &apiError{Code: apiResp.Error, Status: resp.StatusCode}
+	}
+
+	return nil
+}
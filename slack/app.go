@@ -0,0 +1,348 @@
+// Package slack is the Slack front-end of the watchers. It serves the /vinted slash command and the
+// interactive buttons over HTTP and posts the new items of its watchers as Block Kit messages.
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+	"github.com/smatand/vinted_go/vinted"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+const (
+	// Slack never sends bigger requests.
+	maxRequestSize = 1 << 20
+
+	// Action of the "Stop watching" button, its value is the watcher ID.
+	actionRemoveWatcher = "remove_watcher"
+	// Action of the "Open on Vinted" link button, Slack reports the clicks as well.
+	actionOpenItem = "open_item"
+)
+
+// Configuration of the Slack app.
+type Config struct {
+	// Bot User OAuth Token (xoxb-...), the app is disabled if empty.
+	BotToken string
+	// Signing Secret of the app, the requests with a wrong signature are refused.
+	SigningSecret string
+	// Address the slash commands and the interactions are served on, ":3000" by default.
+	Addr string
+	// Base URL of the Web API, https://slack.com/api by default.
+	APIURL string
+}
+
+// Slack app managing the watchers of its users. It is also the notifier of the slack sink.
+type App struct {
+	cfg    Config
+	client *http.Client
+
+	// Replaceable in tests.
+	watchersFilePath string
+	now              func() time.Time
+}
+
+func New(cfg Config) *App {
+	if cfg.Addr == "" {
+		cfg.Addr = ":3000"
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = defaultAPIURL
+	}
+
+	return &App{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// Serves the Slack requests until the ctx is cancelled.
+func (a *App) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              a.cfg.Addr,
+		Handler:           a.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Slack app listening on %s", a.cfg.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Returns the handler of the Request URLs configured in the Slack app:
+// /slack/commands for the slash command and /slack/interactions for the buttons.
+func (a *App) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /slack/commands", a.verified(a.handleCommand))
+	mux.HandleFunc("POST /slack/interactions", a.verified(a.handleInteraction))
+
+	return mux
+}
+
+// Passes only the requests signed by Slack to the handler, with the form already parsed.
+func (a *App) verified(handler func(w http.ResponseWriter, form url.Values)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+		if err != nil {
+			http.Error(w, "cannot read the request", http.StatusBadRequest)
+			return
+		}
+
+		if err := verifySignature(a.cfg.SigningSecret, r.Header, body, a.now()); err != nil {
+			log.Printf("refused slack request: %v", err)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+
+		handler(w, form)
+	}
+}
+
+// JSON response to the slash command.
+type commandResponse struct {
+	// "ephemeral" is visible only to the user, "in_channel" to everyone.
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+func (a *App) handleCommand(w http.ResponseWriter, form url.Values) {
+	owner := ownerID(form.Get("team_id"), form.Get("user_id"))
+	channelID := form.Get("channel_id")
+	args := strings.Fields(form.Get("text"))
+
+	var response commandResponse
+	if len(args) == 0 {
+		response = ephemeral(usage)
+	} else {
+		switch args[0] {
+		case "watch":
+			response = a.watch(owner, channelID, args[1:])
+		case "list":
+			response = a.list(owner)
+		case "remove":
+			response = ephemeral(a.remove(owner, args[1:]))
+		case "move":
+			response = a.move(owner, channelID, args[1:])
+		default:
+			response = ephemeral(usage)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+const usage = "`/vinted watch <vinted url> [SK CZ PL …]` watches the url in this channel, " +
+	"`/vinted list` shows your watchers, `/vinted move <id>` moves a watcher to this channel " +
+	"and `/vinted remove <id>` removes one."
+
+func ephemeral(text string) commandResponse {
+	return commandResponse{ResponseType: "ephemeral", Text: text}
+}
+
+func (a *App) watch(owner string, channelID string, args []string) commandResponse {
+	if len(args) == 0 {
+		return ephemeral(usage)
+	}
+
+	rawURL := unescapeLink(args[0])
+	if !strings.Contains(rawURL, "vinted.") {
+		return ephemeral(usage)
+	}
+
+	countries, unknown := agent.ParseCountries(strings.Join(args[1:], ","))
+	if unknown != "" {
+		return ephemeral(fmt.Sprintf("unknown country %s, use the two letter codes like SK, CZ or PL", unknown))
+	}
+
+	var parsedParams vinted.Vinted
+	parsedParams.ParseParams(rawURL)
+	apiUrl := vintedApi.ConstructVintedAPIRequest(parsedParams)
+
+	id, err := db.AppendWatcher(a.watchersFilePath, db.WatcherURL{
+		URL:       apiUrl,
+		Countries: countries,
+		OwnerID:   owner,
+		ChannelID: channelID,
+		Platform:  db.PlatformSlack,
+		Sinks:     []db.Sink{{Type: notify.SinkSlack, Target: channelID}},
+	})
+	if err != nil {
+		log.Printf("error when adding slack watcher to db has occurred: %v", err)
+		return ephemeral("the watcher could not be saved, try again later")
+	}
+
+	log.Printf("added URL %s with countries %v to db for slack user %s", apiUrl, countries, owner)
+
+	return commandResponse{
+		ResponseType: "in_channel",
+		Text: fmt.Sprintf("you entered %s to watch for %s, the watcher has ID %d",
+			rawURL, agent.DescribeSellers(db.WatcherURL{Countries: countries}), id),
+	}
+}
+
+func (a *App) list(owner string) commandResponse {
+	watchers, err := db.ReadWatchers(a.watchersFilePath)
+	if err != nil {
+		log.Printf("error reading watchers: %v", err)
+		return ephemeral("the watchers could not be loaded, try again later")
+	}
+
+	var lines []string
+	for _, watcher := range watchers {
+		if watcher.OwnerID == owner {
+			lines = append(lines, fmt.Sprintf("`%d` %s → <#%s>, %s", watcher.ID, watcher.URL, watcher.ChannelID, agent.DescribeSellers(watcher)))
+		}
+	}
+
+	if len(lines) == 0 {
+		return ephemeral("you have no watchers")
+	}
+
+	return ephemeral(strings.Join(lines, "\n"))
+}
+
+func (a *App) remove(owner string, args []string) string {
+	watcher, errText := a.ownedWatcher(owner, args)
+	if errText != "" {
+		return errText
+	}
+
+	if err := db.RemoveWatcher(a.watchersFilePath, watcher.ID); err != nil {
+		log.Printf("error removing watcher %d: %v", watcher.ID, err)
+		return "the watcher could not be removed, try again later"
+	}
+
+	log.Printf("watcher %d removed by slack user %s", watcher.ID, owner)
+
+	return fmt.Sprintf("removed watcher %d", watcher.ID)
+}
+
+func (a *App) move(owner string, channelID string, args []string) commandResponse {
+	watcher, errText := a.ownedWatcher(owner, args)
+	if errText != "" {
+		return ephemeral(errText)
+	}
+
+	watcher.ChannelID = channelID
+	watcher.Sinks = slices.DeleteFunc(watcher.Sinks, func(sink db.Sink) bool { return sink.Type == notify.SinkSlack })
+	watcher.Sinks = append(watcher.Sinks, db.Sink{Type: notify.SinkSlack, Target: channelID})
+
+	if err := db.UpdateWatcher(a.watchersFilePath, watcher); err != nil {
+		log.Printf("error updating watcher %d: %v", watcher.ID, err)
+		return ephemeral("the watcher could not be saved, try again later")
+	}
+
+	log.Printf("watcher %d now posts to slack channel %s", watcher.ID, channelID)
+
+	return ephemeral(fmt.Sprintf("watcher %d now posts to this channel", watcher.ID))
+}
+
+// Loads the watcher given by the first argument, the error text is set if the owner cannot manage it.
+func (a *App) ownedWatcher(owner string, args []string) (db.WatcherURL, string) {
+	if len(args) == 0 {
+		return db.WatcherURL{}, usage
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return db.WatcherURL{}, usage
+	}
+
+	watcher, err := db.GetWatcher(a.watchersFilePath, id)
+	if err != nil || watcher.OwnerID != owner {
+		return db.WatcherURL{}, fmt.Sprintf("there is no watcher %d you could manage", id)
+	}
+
+	return watcher, ""
+}
+
+// JSON payload of the block_actions interaction, only the used fields.
+type interactionPayload struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Team struct {
+		ID string `json:"id"`
+	} `json:"team"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+func (a *App) handleInteraction(w http.ResponseWriter, form url.Values) {
+	var payload interactionPayload
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	owner := ownerID(payload.Team.ID, payload.User.ID)
+	for _, action := range payload.Actions {
+		if action.ActionID != actionRemoveWatcher {
+			continue
+		}
+
+		text := a.remove(owner, []string{action.Value})
+		err := a.postJSON(context.Background(), payload.ResponseURL, "", map[string]any{
+			"response_type":    "ephemeral",
+			"replace_original": false,
+			"text":             text,
+		})
+		if err != nil {
+			log.Printf("error responding to slack interaction: %v", err)
+		}
+	}
+
+	// Slack only needs the acknowledgement
+	w.WriteHeader(http.StatusOK)
+}
+
+// Owner of the watchers created by the Slack user, the user IDs are unique only within the workspace.
+func ownerID(teamID string, userID string) string {
+	return "slack:" + teamID + ":" + userID
+}
+
+// Slack sends the links in the command text as <url> or <url|label> when escaping is enabled.
+func unescapeLink(text string) string {
+	if strings.HasPrefix(text, "<") && strings.HasSuffix(text, ">") {
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "<"), ">")
+		text, _, _ = strings.Cut(text, "|")
+	}
+
+	return text
+}
@@ -0,0 +1,174 @@
+package slack
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+)
+
+const testSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+var testNow = time.Unix(1531420618, 0)
+
+func newTestApp(t *testing.T, apiURL string) *App {
+	a := New(Config{BotToken: "xoxb-test", SigningSecret: testSecret, APIURL: apiURL})
+	a.watchersFilePath = filepath.Join(t.TempDir(), "watchers.json")
+	a.now = func() time.Time { return testNow }
+
+	return a
+}
+
+// Sends the form to the app as Slack would, signed with the secret.
+func post(t *testing.T, a *App, path string, form url.Values, secret string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body := form.Encode()
+	timestamp := strconv.FormatInt(testNow.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", sign(secret, timestamp, []byte(body)))
+
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, req)
+
+	return rec
+}
+
+func command(t *testing.T, a *App, user string, channel string, text string) commandResponse {
+	t.Helper()
+
+	rec := post(t, a, "/slack/commands", url.Values{
+		"team_id":    {"T1"},
+		"user_id":    {user},
+		"channel_id": {channel},
+		"command":    {"/vinted"},
+		"text":       {text},
+	}, testSecret)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%q status = %d, want 200", text, rec.Code)
+	}
+
+	var resp commandResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%q invalid response %s: %v", text, rec.Body, err)
+	}
+
+	return resp
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte("token=xyz&team_id=T1&text=list")
+	timestamp := strconv.FormatInt(testNow.Unix(), 10)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		now       time.Time
+		wantErr   bool
+	}{
+		{name: "valid", timestamp: timestamp, signature: sign(testSecret, timestamp, body), now: testNow},
+		{name: "wrong secret", timestamp: timestamp, signature: sign("other", timestamp, body), now: testNow, wantErr: true},
+		{name: "replayed", timestamp: timestamp, signature: sign(testSecret, timestamp, body), now: testNow.Add(10 * time.Minute), wantErr: true},
+		{name: "missing timestamp", signature: sign(testSecret, "", body), now: testNow, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Slack-Request-Timestamp", tt.timestamp)
+			header.Set("X-Slack-Signature", tt.signature)
+
+			if err := verifySignature(testSecret, header, body, tt.now); (err != nil) != tt.wantErr {
+				t.Errorf("verifySignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCommands(t *testing.T) {
+	a := newTestApp(t, "")
+
+	if rec := post(t, a, "/slack/commands", url.Values{"text": {"list"}}, "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned request status = %d, want 401", rec.Code)
+	}
+
+	resp := command(t, a, "U1", "C1", "watch <https://www.vinted.sk/catalog?search_text=nike> cz")
+	if resp.ResponseType != "in_channel" || !strings.Contains(resp.Text, "the watcher has ID 1") {
+		t.Errorf("watch response = %+v", resp)
+	}
+
+	watcher, err := db.GetWatcher(a.watchersFilePath, 1)
+	if err != nil {
+		t.Fatalf("GetWatcher() error = %v", err)
+	}
+	if watcher.Platform != db.PlatformSlack || watcher.OwnerID != "slack:T1:U1" || watcher.Countries[0] != "CZ" {
+		t.Errorf("watcher = %+v", watcher)
+	}
+
+	if resp := command(t, a, "U2", "C1", "remove 1"); !strings.Contains(resp.Text, "no watcher 1") {
+		t.Errorf("remove by other user = %q", resp.Text)
+	}
+
+	if resp := command(t, a, "U1", "C2", "move 1"); !strings.Contains(resp.Text, "now posts to this channel") {
+		t.Errorf("move response = %q", resp.Text)
+	}
+	watcher, _ = db.GetWatcher(a.watchersFilePath, 1)
+	if len(watcher.Sinks) != 1 || watcher.Sinks[0] != (db.Sink{Type: notify.SinkSlack, Target: "C2"}) {
+		t.Errorf("sinks after move = %+v, want channel C2", watcher.Sinks)
+	}
+
+	if resp := command(t, a, "U1", "C2", "list"); resp.ResponseType != "ephemeral" || !strings.Contains(resp.Text, "`1`") {
+		t.Errorf("list response = %+v", resp)
+	}
+
+	if resp := command(t, a, "U1", "C2", "remove 1"); resp.Text != "removed watcher 1" {
+		t.Errorf("remove response = %q", resp.Text)
+	}
+}
+
+func TestStopWatchingButton(t *testing.T) {
+	var mu sync.Mutex
+	var responses []string
+	responseURL := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		responses = append(responses, string(body))
+		mu.Unlock()
+		w.Write([]byte("ok"))
+	}))
+	defer responseURL.Close()
+
+	a := newTestApp(t, "")
+	command(t, a, "U1", "C1", "watch https://www.vinted.sk/catalog?search_text=nike")
+
+	payload, _ := json.Marshal(map[string]any{
+		"type":         "block_actions",
+		"user":         map[string]string{"id": "U1"},
+		"team":         map[string]string{"id": "T1"},
+		"actions":      []map[string]string{{"action_id": actionRemoveWatcher, "value": "1"}},
+		"response_url": responseURL.URL,
+	})
+	if rec := post(t, a, "/slack/interactions", url.Values{"payload": {string(payload)}}, testSecret); rec.Code != http.StatusOK {
+		t.Fatalf("interaction status = %d, want 200", rec.Code)
+	}
+
+	if _, err := db.GetWatcher(a.watchersFilePath, 1); err == nil {
+		t.Errorf("watcher 1 still exists after Stop watching")
+	}
+	if len(responses) != 1 || !strings.Contains(responses[0], "removed watcher 1") {
+		t.Errorf("responses = %q, want the removal confirmed", responses)
+	}
+}
@@ -0,0 +1,90 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+)
+
+func (a *App) Name() string {
+	return notify.SinkSlack
+}
+
+// Posts the item to the channel given by the entry target.
+func (a *App) Notify(ctx context.Context, entry db.OutboxEntry) error {
+	return notifyError(a.call(ctx, "chat.postMessage", map[string]any{
+		"channel":      entry.Target,
+		"text":         notify.Headline(entry),
+		"blocks":       itemBlocks(entry),
+		"unfurl_links": false,
+	}))
+}
+
+// Block Kit layout of the item: the title link with the price and the thumbnail, then the buttons.
+func itemBlocks(entry db.OutboxEntry) []any {
+	item := entry.Item
+
+	text := "*<" + item.Url + "|" + escape(notify.Headline(entry)) + ">*\n" + escape(notify.PriceText(entry))
+	if item.BrandTitle != "" {
+		text += " · " + escape(item.BrandTitle)
+	}
+	if deal := notify.DealText(entry); deal != "" {
+		text += "\n" + escape(deal)
+	}
+
+	section := map[string]any{
+		"type": "section",
+		"text": map[string]any{"type": "mrkdwn", "text": text},
+	}
+	if item.Photo.Url != "" {
+		section["accessory"] = map[string]any{"type": "image", "image_url": item.Photo.Url, "alt_text": item.Title}
+	}
+
+	actions := map[string]any{
+		"type": "actions",
+		"elements": []any{
+			map[string]any{
+				"type":      "button",
+				"action_id": actionOpenItem,
+				"text":      map[string]any{"type": "plain_text", "text": "Open on Vinted"},
+				"url":       item.Url,
+			},
+			map[string]any{
+				"type":      "button",
+				"action_id": actionRemoveWatcher,
+				"text":      map[string]any{"type": "plain_text", "text": "Stop watching"},
+				"value":     strconv.Itoa(entry.WatcherID),
+				"style":     "danger",
+			},
+		},
+	}
+
+	return []any{section, actions}
+}
+
+// Escapes the control characters of the mrkdwn text.
+func escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// Maps the Web API errors to the notify errors: rate limits ask to retry later, the errors about
+// the channel or the token are permanent.
+func notifyError(err error) error {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch {
+	case apiErr.RetryAfter > 0:
+		return &notify.RetryAfterError{Delay: apiErr.RetryAfter, Err: err}
+	case apiErr.Code != "" && apiErr.Code != "internal_error" && apiErr.Code != "fatal_error":
+		return &notify.PermanentError{Err: err}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,102 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+func TestNotify(t *testing.T) {
+	item := vintedApi.VintedItemResp{ID: 7, Title: "Jacket <L>", Url: "https://www.vinted.sk/items/7", BrandTitle: "Zara"}
+	item.Price.Amount = "12.5"
+	item.Photo.Url = "https://images.vinted.net/7.jpg"
+	entry := db.OutboxEntry{WatcherID: 3, Sink: notify.SinkSlack, Target: "C1", Item: item}
+
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantErr       bool
+		wantPermanent bool
+		wantDelay     time.Duration
+	}{
+		{name: "posted", status: http.StatusOK, body: `{"ok":true}`},
+		{name: "not in channel", status: http.StatusOK, body: `{"ok":false,"error":"not_in_channel"}`, wantErr: true, wantPermanent: true},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantErr: true, wantDelay: 4 * time.Second},
+		{name: "server error", status: http.StatusServiceUnavailable, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]any
+			var auth string
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/chat.postMessage" {
+					t.Errorf("called %s, want /chat.postMessage", r.URL.Path)
+				}
+				auth = r.Header.Get("Authorization")
+				json.NewDecoder(r.Body).Decode(&got)
+
+				w.Header().Set("Retry-After", "4")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer api.Close()
+
+			err := newTestApp(t, api.URL).Notify(context.Background(), entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var permanent *notify.PermanentError
+			if errors.As(err, &permanent) != tt.wantPermanent {
+				t.Errorf("Notify() error = %v, want permanent %v", err, tt.wantPermanent)
+			}
+			var retryAfter *notify.RetryAfterError
+			if errors.As(err, &retryAfter) && retryAfter.Delay != tt.wantDelay {
+				t.Errorf("retry after %v, want %v", retryAfter.Delay, tt.wantDelay)
+			}
+
+			if auth != "Bearer xoxb-test" || got["channel"] != "C1" {
+				t.Errorf("posted %v with %q", got, auth)
+			}
+		})
+	}
+}
+
+func TestItemBlocks(t *testing.T) {
+	item := vintedApi.VintedItemResp{Title: "Jacket <L>", Url: "https://www.vinted.sk/items/7", BrandTitle: "H&M"}
+	item.Price.Amount = "12.5"
+
+	blocks, _ := json.Marshal(itemBlocks(db.OutboxEntry{WatcherID: 3, Item: item}))
+
+	var parsed []struct {
+		Type string `json:"type"`
+		Text struct {
+			Text string `json:"text"`
+		} `json:"text"`
+		Accessory map[string]any   `json:"accessory"`
+		Elements  []map[string]any `json:"elements"`
+	}
+	if err := json.Unmarshal(blocks, &parsed); err != nil {
+		t.Fatalf("invalid blocks %s: %v", blocks, err)
+	}
+
+	if want := "*<https://www.vinted.sk/items/7|Jacket &lt;L&gt;>*\n12.5 · H&amp;M"; parsed[0].Text.Text != want {
+		t.Errorf("section text = %q, want %q", parsed[0].Text.Text, want)
+	}
+	if parsed[0].Accessory != nil {
+		t.Errorf("accessory = %v without a photo", parsed[0].Accessory)
+	}
+	if len(parsed[1].Elements) != 2 || parsed[1].Elements[1]["value"] != "3" {
+		t.Errorf("buttons = %v, want the Stop watching button of watcher 3", parsed[1].Elements)
+	}
+}
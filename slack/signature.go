@@ -0,0 +1,42 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Requests signed longer ago are refused to prevent replays.
+const maxSignatureAge = 5 * time.Minute
+
+// Checks the X-Slack-Signature of the request with the raw body against the signing secret,
+// see https://api.slack.com/authentication/verifying-requests-from-slack.
+func verifySignature(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid request timestamp %q", timestamp)
+	}
+
+	if age := now.Sub(time.Unix(seconds, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return fmt.Errorf("request timestamp too far from now: %v", age)
+	}
+
+	if !hmac.Equal([]byte(header.Get("X-Slack-Signature")), []byte(sign(secret, timestamp, body))) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}
+
+func sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
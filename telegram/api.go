@@ -0,0 +1,111 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Default base URL of the Telegram Bot API.
+const defaultAPIURL = "https://api.telegram.org"
+
+// JSON envelope of every Bot API response.
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  *struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// Error returned by the Bot API, RetryAfter is set in seconds for the rate limited requests.
+type apiError struct {
+	Code        int
+	Description string
+	RetryAfter  int
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("telegram error %d: %s", e.Code, e.Description)
+}
+
+// JSON structures of the Bot API used by the bot.
+type update struct {
+	UpdateID int      `json:"update_id"`
+	Message  *message `json:"message"`
+}
+
+type message struct {
+	MessageID int    `json:"message_id"`
+	From      *user  `json:"from"`
+	Chat      chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+type user struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type chat struct {
+	ID int64 `json:"id"`
+}
+
+type botCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// Calls the Bot API method with the JSON params and unmarshals the result into result, if not nil.
+func (b *Bot) call(ctx context.Context, method string, params any, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("error marshalling %s params: %v", method, err)
+	}
+
+	url := strings.TrimSuffix(b.cfg.APIURL, "/") + "/bot" + b.cfg.Token + "/" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// The token is part of the url, keep it out of the logs
+		return fmt.Errorf("failed to make %s request: %v", method, strings.ReplaceAll(err.Error(), b.cfg.Token, "<token>"))
+	}
+	defer resp.Body.Close()
+
+	var apiResp apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return fmt.Errorf("invalid %s response, status code: %v", method, resp.StatusCode)
+	}
+
+	if !apiResp.OK {
+		apiErr := &apiError{Code: apiResp.ErrorCode, Description: apiResp.Description}
+		if apiResp.Parameters != nil {
+			apiErr.RetryAfter = apiResp.Parameters.RetryAfter
+		}
+		return apiErr
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(apiResp.Result, result)
+}
+
+func (b *Bot) sendMessage(ctx context.Context, chatID int64, text string) error {
+	return b.call(ctx, "sendMessage", map[string]any{
+		"chat_id":                  chatID,
+		"text":                     truncate(text, maxMessageLength),
+		"disable_web_page_preview": true,
+	}, nil)
+}
@@ -0,0 +1,249 @@
+// Package telegram is the Telegram front-end of the watchers. It offers the /watch, /list and /remove
+// commands in the chats with the bot and delivers the new items of its watchers as photos.
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smatand/vinted_go/agent"
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/vinted"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+const (
+	// Seconds the getUpdates request waits for the new messages.
+	pollTimeout = 30
+	// Wait after a failed getUpdates request.
+	pollRetryDelay = 5 * time.Second
+
+	maxMessageLength = 4096
+	maxCaptionLength = 1024
+)
+
+// Configuration of the Telegram bot.
+type Config struct {
+	// Token from @BotFather, the bot is disabled if empty.
+	Token string
+	// Base URL of the Bot API, https://api.telegram.org by default.
+	APIURL string
+	// Users allowed to use the bot, everyone if empty.
+	AllowedUserIDs []int64
+}
+
+// Telegram bot managing the watchers of its users. It is also the notifier of the telegram sink.
+type Bot struct {
+	cfg    Config
+	client *http.Client
+
+	// Replaceable in tests.
+	watchersFilePath string
+}
+
+func New(cfg Config) *Bot {
+	if cfg.APIURL == "" {
+		cfg.APIURL = defaultAPIURL
+	}
+
+	return &Bot{
+		cfg: cfg,
+		// Longer than the long polling of getUpdates
+		client: &http.Client{Timeout: (pollTimeout + 10) * time.Second},
+	}
+}
+
+// Handles the messages sent to the bot until the ctx is cancelled.
+func (b *Bot) Run(ctx context.Context) {
+	err := b.call(ctx, "setMyCommands", map[string]any{"commands": []botCommand{
+		{Command: "watch", Description: "Watch a Vinted url: /watch <url> [SK CZ PL …]"},
+		{Command: "list", Description: "List your watchers"},
+		{Command: "remove", Description: "Remove a watcher: /remove <id>"},
+	}}, nil)
+	if err != nil {
+		log.Printf("cannot set the telegram commands: %v", err)
+	}
+
+	log.Println("Telegram bot is up!")
+
+	offset := 0
+	for {
+		var updates []update
+		err := b.call(ctx, "getUpdates", map[string]any{
+			"offset":          offset,
+			"timeout":         pollTimeout,
+			"allowed_updates": []string{"message"},
+		}, &updates)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("error getting telegram updates: %v", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay(err)):
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message != nil {
+				b.handleMessage(ctx, u.Message)
+			}
+		}
+	}
+}
+
+func (b *Bot) handleMessage(ctx context.Context, msg *message) {
+	if msg.From == nil || !strings.HasPrefix(msg.Text, "/") {
+		return
+	}
+
+	if len(b.cfg.AllowedUserIDs) > 0 && !slices.Contains(b.cfg.AllowedUserIDs, msg.From.ID) {
+		b.reply(ctx, msg, "you are not allowed to use this bot")
+		return
+	}
+
+	fields := strings.Fields(msg.Text)
+	// In groups the commands may be addressed as /watch@BotName
+	command, _, _ := strings.Cut(fields[0], "@")
+	args := fields[1:]
+
+	switch command {
+	case "/watch":
+		b.handleWatch(ctx, msg, args)
+	case "/list":
+		b.handleList(ctx, msg)
+	case "/remove":
+		b.handleRemove(ctx, msg, args)
+	case "/start", "/help":
+		b.reply(ctx, msg, "Send /watch <vinted url> [SK CZ PL …] to get the new items of the url here.\n"+
+			"/list shows your watchers, /remove <id> removes one.")
+	default:
+		b.reply(ctx, msg, "unknown command, see /help")
+	}
+}
+
+func (b *Bot) handleWatch(ctx context.Context, msg *message, args []string) {
+	if len(args) == 0 || !strings.Contains(args[0], "vinted.") {
+		b.reply(ctx, msg, "usage: /watch <vinted url> [SK CZ PL …]")
+		return
+	}
+
+	countries, unknown := agent.ParseCountries(strings.Join(args[1:], ","))
+	if unknown != "" {
+		b.reply(ctx, msg, fmt.Sprintf("unknown country %s, use the two letter codes like SK, CZ or PL", unknown))
+		return
+	}
+
+	var parsedParams vinted.Vinted
+	parsedParams.ParseParams(args[0])
+	apiUrl := vintedApi.ConstructVintedAPIRequest(parsedParams)
+
+	id, err := db.AppendWatcher(b.watchersFilePath, db.WatcherURL{
+		URL:       apiUrl,
+		Countries: countries,
+		OwnerID:   ownerID(msg.From.ID),
+		Platform:  db.PlatformTelegram,
+		Sinks:     []db.Sink{{Type: sinkName, Target: strconv.FormatInt(msg.Chat.ID, 10)}},
+	})
+	if err != nil {
+		log.Printf("error when adding telegram watcher to db has occurred: %v", err)
+		b.reply(ctx, msg, "the watcher could not be saved, try again later")
+		return
+	}
+
+	log.Printf("added URL %s with countries %v to db for telegram user %d", apiUrl, countries, msg.From.ID)
+	b.reply(ctx, msg, fmt.Sprintf("you entered %s to watch for %s, the watcher has ID %d",
+		args[0], agent.DescribeSellers(db.WatcherURL{Countries: countries}), id))
+}
+
+func (b *Bot) handleList(ctx context.Context, msg *message) {
+	watchers, err := db.ReadWatchers(b.watchersFilePath)
+	if err != nil {
+		log.Printf("error reading watchers: %v", err)
+		b.reply(ctx, msg, "the watchers could not be loaded, try again later")
+		return
+	}
+
+	var lines []string
+	for _, watcher := range watchers {
+		if watcher.OwnerID == ownerID(msg.From.ID) {
+			lines = append(lines, fmt.Sprintf("%d: %s, %s", watcher.ID, watcher.URL, agent.DescribeSellers(watcher)))
+		}
+	}
+
+	if len(lines) == 0 {
+		b.reply(ctx, msg, "you have no watchers")
+		return
+	}
+
+	b.reply(ctx, msg, strings.Join(lines, "\n"))
+}
+
+func (b *Bot) handleRemove(ctx context.Context, msg *message, args []string) {
+	var id int
+	var err error
+	if len(args) > 0 {
+		id, err = strconv.Atoi(args[0])
+	}
+	if len(args) == 0 || err != nil {
+		b.reply(ctx, msg, "usage: /remove <id>, see /list")
+		return
+	}
+
+	watcher, err := db.GetWatcher(b.watchersFilePath, id)
+	if err != nil || watcher.OwnerID != ownerID(msg.From.ID) {
+		b.reply(ctx, msg, fmt.Sprintf("there is no watcher %d you could manage", id))
+		return
+	}
+
+	if err := db.RemoveWatcher(b.watchersFilePath, id); err != nil {
+		log.Printf("error removing watcher %d: %v", id, err)
+		b.reply(ctx, msg, "the watcher could not be removed, try again later")
+		return
+	}
+
+	log.Printf("watcher %d removed by telegram user %d", id, msg.From.ID)
+	b.reply(ctx, msg, fmt.Sprintf("removed watcher %d", id))
+}
+
+func (b *Bot) reply(ctx context.Context, msg *message, text string) {
+	if err := b.sendMessage(ctx, msg.Chat.ID, text); err != nil {
+		log.Printf("error replying in telegram chat %d: %v", msg.Chat.ID, err)
+	}
+}
+
+// Owner of the watchers created by the Telegram user, distinct from the Discord user IDs.
+func ownerID(userID int64) string {
+	return "telegram:" + strconv.FormatInt(userID, 10)
+}
+
+// Returns the wait after the failed request, the rate limited ones say how long.
+func retryDelay(err error) time.Duration {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second
+	}
+
+	return pollRetryDelay
+}
+
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	return string(runes[:limit-3]) + "..."
+}
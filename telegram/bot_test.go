@@ -0,0 +1,222 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+	vintedApi "github.com/smatand/vinted_go/vintedApi"
+)
+
+// Stand-in for the Bot API: serves the queued updates and records the other calls.
+type fakeAPI struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	updates []update
+	calls   []fakeCall
+	// Response of the next sendPhoto call, ok if empty.
+	photoResponse string
+}
+
+type fakeCall struct {
+	method string
+	params map[string]any
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, method, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if token != "test-token" {
+		http.Error(w, `{"ok":false,"error_code":401,"description":"Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var params map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		f.t.Errorf("invalid %s params: %v", method, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch method {
+	case "getUpdates":
+		offset := int(params["offset"].(float64))
+		var pending []update
+		for _, u := range f.updates {
+			if u.UpdateID >= offset {
+				pending = append(pending, u)
+			}
+		}
+		result, _ := json.Marshal(pending)
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": json.RawMessage(result)})
+		return
+	case "sendPhoto":
+		if f.photoResponse != "" {
+			w.Write([]byte(f.photoResponse))
+			f.photoResponse = ""
+			f.calls = append(f.calls, fakeCall{method: method, params: params})
+			return
+		}
+	}
+
+	f.calls = append(f.calls, fakeCall{method: method, params: params})
+	w.Write([]byte(`{"ok":true,"result":true}`))
+}
+
+// Returns the texts of the sent messages.
+func (f *fakeAPI) sentTexts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var texts []string
+	for _, c := range f.calls {
+		if c.method == "sendMessage" {
+			texts = append(texts, c.params["text"].(string))
+		}
+	}
+
+	return texts
+}
+
+func newTestBot(t *testing.T, api *fakeAPI) *Bot {
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	b := New(Config{Token: "test-token", APIURL: srv.URL, AllowedUserIDs: []int64{42}})
+	b.watchersFilePath = filepath.Join(t.TempDir(), "watchers.json")
+
+	return b
+}
+
+func textUpdate(id int, userID int64, text string) update {
+	return update{UpdateID: id, Message: &message{MessageID: id, From: &user{ID: userID}, Chat: chat{ID: 1000 + userID}, Text: text}}
+}
+
+func TestCommands(t *testing.T) {
+	api := &fakeAPI{t: t, updates: []update{
+		textUpdate(1, 42, "/watch https://www.vinted.sk/catalog?search_text=nike sk"),
+		textUpdate(2, 7, "/list"),
+		textUpdate(3, 42, "/list@VintedBot"),
+		textUpdate(4, 42, "/remove 1"),
+		textUpdate(5, 42, "/list"),
+	}}
+	b := newTestBot(t, api)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(api.sentTexts()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	texts := api.sentTexts()
+	if len(texts) != 5 {
+		t.Fatalf("sent %q, want 5 replies", texts)
+	}
+
+	wants := []string{
+		"the watcher has ID 1",
+		"you are not allowed",
+		"1: https://www.vinted.sk/api/v2/catalog/items?",
+		"removed watcher 1",
+		"you have no watchers",
+	}
+	for i, want := range wants {
+		if !strings.Contains(texts[i], want) {
+			t.Errorf("reply %d = %q, want it to contain %q", i, texts[i], want)
+		}
+	}
+}
+
+func TestWatchStoresTelegramSink(t *testing.T) {
+	api := &fakeAPI{t: t}
+	b := newTestBot(t, api)
+
+	b.handleMessage(context.Background(), textUpdate(1, 42, "/watch https://www.vinted.sk/catalog?search_text=nike CZ").Message)
+
+	watcher, err := db.GetWatcher(b.watchersFilePath, 1)
+	if err != nil {
+		t.Fatalf("GetWatcher() error = %v", err)
+	}
+	if watcher.Platform != db.PlatformTelegram || watcher.OwnerID != "telegram:42" {
+		t.Errorf("watcher = %+v, want a telegram watcher of user 42", watcher)
+	}
+	if len(watcher.Sinks) != 1 || watcher.Sinks[0] != (db.Sink{Type: notify.SinkTelegram, Target: "1042"}) {
+		t.Errorf("sinks = %+v, want chat 1042", watcher.Sinks)
+	}
+	if len(watcher.Countries) != 1 || watcher.Countries[0] != "CZ" {
+		t.Errorf("countries = %v, want [CZ]", watcher.Countries)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	item := vintedApi.VintedItemResp{ID: 7, Title: "Jacket", Url: "https://www.vinted.sk/items/7", BrandTitle: "Zara"}
+	item.Price.Amount = "12.5"
+	item.Photo.Url = "https://images.vinted.net/7.jpg"
+	entry := db.OutboxEntry{Sink: notify.SinkTelegram, Target: "1042", Item: item}
+
+	t.Run("photo", func(t *testing.T) {
+		api := &fakeAPI{t: t}
+		b := newTestBot(t, api)
+
+		if err := b.Notify(context.Background(), entry); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+		if len(api.calls) != 1 || api.calls[0].method != "sendPhoto" {
+			t.Fatalf("calls = %+v, want sendPhoto", api.calls)
+		}
+		params := api.calls[0].params
+		if params["photo"] != item.Photo.Url || params["caption"] != "Jacket\n12.5 · Zara\nhttps://www.vinted.sk/items/7" {
+			t.Errorf("sendPhoto params = %v", params)
+		}
+	})
+
+	t.Run("photo refused", func(t *testing.T) {
+		api := &fakeAPI{t: t, photoResponse: `{"ok":false,"error_code":400,"description":"Bad Request: wrong file identifier"}`}
+		b := newTestBot(t, api)
+
+		if err := b.Notify(context.Background(), entry); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+		if texts := api.sentTexts(); len(texts) != 1 {
+			t.Errorf("sent %q, want the text instead of the photo", texts)
+		}
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		api := &fakeAPI{t: t, photoResponse: `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":3}}`}
+		b := newTestBot(t, api)
+
+		var retryAfter *notify.RetryAfterError
+		if err := b.Notify(context.Background(), entry); !errors.As(err, &retryAfter) || retryAfter.Delay != 3*time.Second {
+			t.Errorf("Notify() error = %v, want retry after 3s", err)
+		}
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		api := &fakeAPI{t: t, photoResponse: `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`}
+		b := newTestBot(t, api)
+
+		var permanent *notify.PermanentError
+		if err := b.Notify(context.Background(), entry); !errors.As(err, &permanent) {
+			t.Errorf("Notify() error = %v, want permanent error", err)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/smatand/vinted_go/db"
+	"github.com/smatand/vinted_go/notify"
+)
+
+const sinkName = notify.SinkTelegram
+
+func (b *Bot) Name() string {
+	return sinkName
+}
+
+// Sends the item to the chat given by the entry target, as a photo with the caption if it has one.
+func (b *Bot) Notify(ctx context.Context, entry db.OutboxEntry) error {
+	chatID, err := strconv.ParseInt(entry.Target, 10, 64)
+	if err != nil {
+		return &notify.PermanentError{Err: fmt.Errorf("invalid telegram chat %q", entry.Target)}
+	}
+
+	item := entry.Item
+	text := notify.Headline(entry) + "\n" + notify.PriceText(entry)
+	if item.BrandTitle != "" {
+		text += " · " + item.BrandTitle
+	}
+	if deal := notify.DealText(entry); deal != "" {
+		text += "\n" + deal
+	}
+	text += "\n" + item.Url
+
+	if item.Photo.Url != "" {
+		err = b.call(ctx, "sendPhoto", map[string]any{
+			"chat_id": chatID,
+			"photo":   item.Photo.Url,
+			"caption": truncate(text, maxCaptionLength),
+		}, nil)
+
+		// Telegram could not fetch the photo, the text is better than nothing
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest {
+			err = b.sendMessage(ctx, chatID, text)
+		}
+	} else {
+		err = b.sendMessage(ctx, chatID, text)
+	}
+
+	return notifyError(err)
+}
+
+// Maps the Bot API errors to the notify errors: 429 asks to retry later, the other 4xx,
+// e.g. the user blocked the bot, are permanent.
+func notifyError(err error) error {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch {
+	case apiErr.RetryAfter > 0:
+		return &notify.RetryAfterError{Delay: retryDelay(err), Err: err}
+	case apiErr.Code >= 400 && apiErr.Code < 500:
+		return &notify.PermanentError{Err: err}
+	default:
+		return err
+	}
+}
@@ -1,7 +1,9 @@
 package vintedApi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,6 +12,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sony/gobreaker/v2"
@@ -31,12 +34,20 @@ const (
 )
 
 var (
+	// Guards the maps below, the items are fetched concurrently.
+	cookieMu     sync.Mutex
 	cookieCache  = make(map[string]*cookies)
 	cookieExpiry = make(map[string]time.Time)
-	// For exponential backoff ~ waitExponential().
-	retryCountExp = 0
-	headersMap    map[string]string
-	cb            *gobreaker.CircuitBreaker[*VintedItemsResp]
+	// Held while the cookies of the host are fetched, so the concurrent requests wait for the same
+	// cookies without blocking the other hosts.
+	cookieLocks = make(map[string]*sync.Mutex)
+	// Failed cookie fetches of the host in a row, for exponential backoff ~ waitExponential().
+	cookieRetries = make(map[string]int)
+	// Shared by all the requests of the Vinted API.
+	cb *gobreaker.CircuitBreaker[struct{}]
+
+	breakerHandlerMu     sync.Mutex
+	breakerStateHandlers []func(from, to string)
 )
 
 // Keeps the AccessTokenWeb for authentification in API and RefreshTokenWeb for refreshing the AccessTokenWeb after it expires.
@@ -59,11 +70,44 @@ type VintedItemResp struct {
 	Url        string           `json:"url"`
 	Conversion VintedConversion `json:"conversion"`
 	Photo      VintedPhoto      `json:"photo"`
+	// Price including the buyer protection fee, without the shipping.
+	TotalItemPrice VintedPrice `json:"total_item_price"`
+	ServiceFee     VintedPrice `json:"service_fee"`
+	// Condition as shown on the site, e.g. "Very good", in the language of the domain.
+	Status   string     `json:"status"`
+	StatusID int        `json:"status_id"`
+	Promoted bool       `json:"promoted"`
+	User     VintedUser `json:"user"`
+	// e.g. "M" or "42", empty for the items without sizes.
+	SizeTitle string `json:"size_title"`
+	CatalogID int    `json:"catalog_id"`
 }
 
 // Structure of json price in response from Vinted API.
 type VintedPrice struct {
-	Amount string `json:"amount"`
+	Amount       string `json:"amount"`
+	CurrencyCode string `json:"currency_code"`
+}
+
+// Structure of the seller in the item or in the user profile. The feedback is present only in the profile.
+type VintedUser struct {
+	ID    int    `json:"id"`
+	Login string `json:"login"`
+	// Share of the positive feedback, 0 to 1.
+	FeedbackReputation float64 `json:"feedback_reputation"`
+	FeedbackCount      int     `json:"feedback_count"`
+	// Country of the seller, e.g. "SK".
+	CountryISOCode string `json:"country_iso_code"`
+	CountryCode    string `json:"country_code"`
+}
+
+// Returns the ISO code of the seller's country, "" if not known.
+func (u VintedUser) Country() string {
+	if u.CountryISOCode != "" {
+		return strings.ToUpper(u.CountryISOCode)
+	}
+
+	return strings.ToUpper(u.CountryCode)
 }
 
 // Structure which helps to decide the country of the seller.
@@ -74,19 +118,61 @@ type VintedConversion struct {
 // Structure to hold thumbnail of item photo.
 type VintedPhoto struct {
 	Url string `json:"url"`
+	// Upload time of the photo, the listing time of the item.
+	HighResolution struct {
+		Timestamp int64 `json:"timestamp"`
+	} `json:"high_resolution"`
+}
+
+// Returns the time the item was listed, the zero time if it is not known.
+func (i VintedItemResp) ListedAt() time.Time {
+	if i.Photo.HighResolution.Timestamp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(i.Photo.HighResolution.Timestamp, 0)
 }
 
 // Inits gobreaker circuit breaker for handling the API requests and the failures if they occur.
 func init() {
+	cb = newBreaker()
+}
+
+func newBreaker() *gobreaker.CircuitBreaker[struct{}] {
 	var st gobreaker.Settings
 	st.Name = "HTTP GET"
 	st.ReadyToTrip = func(counts gobreaker.Counts) bool {
 		failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
 		return counts.Requests >= 3 && failureRatio >= 0.6
 	}
+	// A removed item or user is a valid answer
+	st.IsSuccessful = func(err error) bool {
+		return err == nil || errors.Is(err, errNotFound)
+	}
+
+	st.OnStateChange = func(name string, from, to gobreaker.State) {
+		log.Printf("circuit breaker %q changed from %v to %v", name, from, to)
+
+		breakerHandlerMu.Lock()
+		handlers := breakerStateHandlers
+		breakerHandlerMu.Unlock()
+
+		for _, handler := range handlers {
+			handler(from.String(), to.String())
+		}
+	}
 
 	// Set the default settings.
-	cb = gobreaker.NewCircuitBreaker[*VintedItemsResp](st)
+	return gobreaker.NewCircuitBreaker[struct{}](st)
+}
+
+// Registers the function called when the circuit breaker changes its state ("closed", "half-open", "open").
+// It is called while the breaker is locked, so it must not block or fetch items.
+func OnBreakerStateChange(handler func(from, to string)) {
+	breakerHandlerMu.Lock()
+	defer breakerHandlerMu.Unlock()
+
+	breakerStateHandlers = append(breakerStateHandlers, handler)
 }
 
 // Constructs rest API URL which by default retrieves 1st page with 16 items. The function then adds
@@ -159,56 +245,117 @@ func constructParamString(paramName string, ids []int) string {
 	return toRet
 }
 
-// Waits exponential time, maximum is 30 mins.
-func waitExponential() {
-	delaySecs := 1 << retryCountExp
+// Waits exponential time after the given number of retries, maximum is 30 mins.
+// Returns the error of the ctx if it is cancelled first.
+func waitExponential(ctx context.Context, retries int) error {
+	delaySecs := 1 << min(retries, 16)
 	if delaySecs > maxExponentialWait {
 		delaySecs = maxExponentialWait
 	}
 
-	time.Sleep(time.Duration(delaySecs) * time.Second)
+	timer := time.NewTimer(time.Duration(delaySecs) * time.Second)
+	defer timer.Stop()
 
-	retryCountExp++
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
-// Fetches cookie access_token_web and refresh_token_web from the given host.
-func fetchVintedCookies(host string) (*cookies, error) {
-	// CHeck if stored cookies exist
+// Returns the cookies of the host if they did not expire yet.
+func cachedCookies(host string) (*cookies, bool) {
+	cookieMu.Lock()
+	defer cookieMu.Unlock()
+
 	cachedCookie, exists := cookieCache[host]
 	expiry, hasExpiry := cookieExpiry[host]
 
-	// If the timeout is not exceeded and they exist, return them
-	if exists && hasExpiry && time.Now().Before(expiry) {
-		return cachedCookie, nil
+	return cachedCookie, exists && hasExpiry && time.Now().Before(expiry)
+}
+
+// Returns the lock held while the cookies of the host are fetched.
+func hostCookieLock(host string) *sync.Mutex {
+	cookieMu.Lock()
+	defer cookieMu.Unlock()
+
+	lock, ok := cookieLocks[host]
+	if !ok {
+		lock = &sync.Mutex{}
+		cookieLocks[host] = lock
 	}
 
-	cookieData := &cookies{}
+	return lock
+}
 
-	client := http.Client{}
+// Forgets the cookies of the host, e.g. after Vinted refused them, the next request fetches new ones.
+func invalidateCookies(host string) {
+	cookieMu.Lock()
+	defer cookieMu.Unlock()
+
+	delete(cookieCache, host)
+	delete(cookieExpiry, host)
+}
+
+// Fetches cookie access_token_web and refresh_token_web from the given host, the cached ones are
+// returned until they expire. The failed attempts are retried with exponential backoff until the ctx
+// is cancelled.
+func fetchVintedCookies(ctx context.Context, host string, headers map[string]string) (*cookies, error) {
 	maxRetries := 3
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		if attempt > 0 {
-			waitExponential()
+			cookieMu.Lock()
+			retries := cookieRetries[host]
+			cookieMu.Unlock()
+
+			// The other requests to the host may fetch the cookies meanwhile
+			if err := waitExponential(ctx, retries); err != nil {
+				return nil, err
+			}
 		}
 
-		req, err := http.NewRequest("GET", host, nil)
+		cookieData, err := fetchHostCookies(ctx, host, headers)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %v", err)
+			return nil, err
 		}
+		if cookieData != nil {
+			return cookieData, nil
+		}
+	}
 
-		applyHeaders(req)
+	return nil, fmt.Errorf("could not retrieve cookies")
+}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("could not create client: %v", err)
-		}
-		defer resp.Body.Close()
+// Makes one attempt to fetch the cookies of the host under its lock, so the concurrent requests
+// wait for the same cookies. Returns nil cookies if the host did not give them.
+func fetchHostCookies(ctx context.Context, host string, headers map[string]string) (*cookies, error) {
+	lock := hostCookieLock(host)
+	lock.Lock()
+	defer lock.Unlock()
 
-		if resp.StatusCode != http.StatusOK {
-			continue
-		}
+	// Fetched by another request while this one waited
+	if cachedCookie, ok := cachedCookies(host); ok {
+		return cachedCookie, nil
+	}
 
+	req, err := http.NewRequestWithContext(ctx, "GET", host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	applyHeaders(req, headers)
+
+	client := http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not create client: %v", err)
+	}
+	defer resp.Body.Close()
+
+	cookieData := &cookies{}
+	if resp.StatusCode == http.StatusOK {
 		for _, cookie := range resp.Cookies() {
 			switch cookie.Name {
 			case accessTokenCookieName:
@@ -217,21 +364,25 @@ func fetchVintedCookies(host string) (*cookies, error) {
 				cookieData.RefreshTokenWeb = cookie.Value
 			}
 		}
+	}
 
-		// Reset the exponentialWait() counter when both cookies are retrieved
-		if cookieData.AccessTokenWeb != "" && cookieData.RefreshTokenWeb != "" {
-			retryCountExp = 0
+	cookieMu.Lock()
+	defer cookieMu.Unlock()
 
-			cookieCache[host] = cookieData
-			cookieExpiry[host] = time.Now().Add(cookieTTL)
+	if cookieData.AccessTokenWeb == "" || cookieData.RefreshTokenWeb == "" {
+		cookieRetries[host]++
+		return nil, nil
+	}
 
-			log.Printf("cookies for %v are stored in cache for %v mins", host, cookieTTL.Minutes())
+	// Reset the exponential backoff when both cookies are retrieved
+	cookieRetries[host] = 0
 
-			return cookieData, nil
-		}
-	}
+	cookieCache[host] = cookieData
+	cookieExpiry[host] = time.Now().Add(cookieTTL)
 
-	return nil, fmt.Errorf("could not retrieve cookies")
+	log.Printf("cookies for %v are stored in cache for %v mins", host, cookieTTL.Minutes())
+
+	return cookieData, nil
 }
 
 // Extracts all the content before "/api" from the given URL.
@@ -239,7 +390,7 @@ func extractHost(URL string) string {
 	return strings.Split(URL, "/api")[0]
 }
 
-// Loads the randomly picked headers from filePath.json into a global variable headersMap.
+// Loads the randomly picked headers from filePath.json.
 func loadRandomHeaders(filePath string) (map[string]string, error) {
 	file, err := os.ReadFile(filePath)
 	if err != nil {
@@ -257,43 +408,27 @@ func loadRandomHeaders(filePath string) (map[string]string, error) {
 	return headers, nil
 }
 
-// Loads the headers from the headersMap into the request.
-func applyHeaders(req *http.Request) {
-	for key, value := range headersMap {
+// Loads the headers into the request.
+func applyHeaders(req *http.Request, headers map[string]string) {
+	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
 }
 
-func parseVintedItemsResp(bodyData *io.ReadCloser) (*VintedItemsResp, error) {
-	body, err := io.ReadAll(*bodyData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
-	}
-
-	vintedResp := &VintedItemsResp{}
-	err = json.Unmarshal(body, &vintedResp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
-	}
-
-	return vintedResp, nil
-}
-
-func prepareVintedRequest(requestURL string) (*http.Request, error) {
-	var err error
-	headersMap, err = loadRandomHeaders(headersFilePath)
+func prepareVintedRequest(ctx context.Context, requestURL string) (*http.Request, error) {
+	headers, err := loadRandomHeaders(headersFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load headers: %v", err)
 	}
 
 	//  "https://vinted.sk/api/v2/..." -> "https://vinted.sk".
 	host := extractHost(requestURL)
-	cookies, err := fetchVintedCookies(host)
+	cookies, err := fetchVintedCookies(ctx, host, headers)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", requestURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
@@ -303,46 +438,200 @@ func prepareVintedRequest(requestURL string) (*http.Request, error) {
 		Value: cookies.AccessTokenWeb,
 	})
 
-	// From global var headersMap to req type.
-	applyHeaders(req)
+	applyHeaders(req, headers)
 
 	return req, nil
 }
 
-// Fetches the actual items from the Vinted API and returns the VintedItemsResp structure or nil in case of error.
-func fetchVintedItems(req *http.Request) (*VintedItemsResp, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+// Errors of the Vinted API requests.
+var (
+	// Vinted asks to slow down. The request is not retried, it counts as a failure of the circuit
+	// breaker and the agent polls the watcher again after its failure backoff.
+	ErrRateLimited = errors.New("rate limited by vinted")
+	errNotFound    = errors.New("not found")
+)
+
+var apiClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// Requests the requestURL of the Vinted API with the cookies of its host and decodes the JSON response
+// into v. Vinted refuses the expired cookies with 401, they are fetched again and the request is
+// repeated once. Returns ErrRateLimited on 429 and errNotFound on 404. The requests go through the
+// circuit breaker, they fail with gobreaker.ErrOpenState without a request while it is open.
+func getVintedJSON(ctx context.Context, requestURL string, v any) error {
+	_, err := cb.Execute(func() (struct{}, error) {
+		return struct{}{}, retryVintedJSON(ctx, requestURL, v)
+	})
+
+	return err
+}
+
+// Makes the request of getVintedJSON, repeated with new cookies if the old ones were refused.
+func retryVintedJSON(ctx context.Context, requestURL string, v any) error {
+	status, err := requestVintedJSON(ctx, requestURL, v)
+	if status == http.StatusUnauthorized {
+		host := extractHost(requestURL)
+		log.Printf("cookies for %v were refused, fetching new ones", host)
+
+		invalidateCookies(host)
+		status, err = requestVintedJSON(ctx, requestURL, v)
+		if status == http.StatusUnauthorized {
+			invalidateCookies(host)
+		}
 	}
 
-	resp, err := client.Do(req)
+	return err
+}
+
+// Makes one request of retryVintedJSON, returns the status code of the response, 0 if there is none.
+func requestVintedJSON(ctx context.Context, requestURL string, v any) (int, error) {
+	req, err := prepareVintedRequest(ctx, requestURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %v", err)
+		return 0, fmt.Errorf("failed to prepare request: %v", err)
+	}
+
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make request: %v", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status code: %v", resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests:
+		return resp.StatusCode, ErrRateLimited
+	case http.StatusNotFound:
+		return resp.StatusCode, errNotFound
+	default:
+		return resp.StatusCode, fmt.Errorf("status code: %v", resp.StatusCode)
 	}
 
-	return parseVintedItemsResp(&resp.Body)
-} // The resp.Body is deferred.
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
 
-// Retrieves items from Vinted API based on the given parameters from vinted.Vinted structure
-// The data are json unmarshalled into VintedItemsResp structure.
-func GetVintedItems(requestURL string) (*VintedItemsResp, error) {
-	req, err := prepareVintedRequest(requestURL)
+	return resp.StatusCode, nil
+}
+
+// Retrieves the profile of the seller with the given id from the host of the requestURL,
+// e.g. "https://www.vinted.sk/api/v2/catalog/items?..." -> "https://www.vinted.sk/api/v2/users/123".
+func GetVintedUser(ctx context.Context, requestURL string, id int) (*VintedUser, error) {
+	userURL := extractHost(requestURL) + "/api/v2/users/" + strconv.Itoa(id)
+
+	var userResp struct {
+		User VintedUser `json:"user"`
+	}
+	if err := getVintedJSON(ctx, userURL, &userResp); err != nil {
+		return nil, err
+	}
+
+	return &userResp.User, nil
+}
+
+// Returned by GetVintedItem when the item does not exist anymore.
+var ErrItemNotFound = errors.New("item not found")
+
+// Structure of the item detail response, the fields telling whether the item is still available and the details.
+type VintedItemDetail struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	Url        string `json:"url"`
+	IsClosed   bool   `json:"is_closed"`
+	IsReserved bool   `json:"is_reserved"`
+	IsHidden   bool   `json:"is_hidden"`
+	// Why the item was closed, e.g. "sold".
+	ItemClosingAction string      `json:"item_closing_action"`
+	Price             VintedPrice `json:"price"`
+	// Shown in the item details.
+	Description    string `json:"description"`
+	Condition      string `json:"status"`
+	SizeTitle      string `json:"size_title"`
+	FavouriteCount int    `json:"favourite_count"`
+	ViewCount      int    `json:"view_count"`
+}
+
+// Statuses of an item returned by VintedItemDetail.Status.
+const (
+	ItemAvailable = "available"
+	ItemReserved  = "reserved"
+	ItemSold      = "sold"
+	ItemDeleted   = "deleted"
+)
+
+// Returns the status of the item, one of ItemAvailable, ItemReserved, ItemSold and ItemDeleted.
+func (d VintedItemDetail) Status() string {
+	switch {
+	case d.IsClosed && (d.ItemClosingAction == "" || d.ItemClosingAction == "sold"):
+		return ItemSold
+	case d.IsClosed || d.IsHidden:
+		return ItemDeleted
+	case d.IsReserved:
+		return ItemReserved
+	default:
+		return ItemAvailable
+	}
+}
+
+// Retrieves the detail of the item with the given id from the host of the requestURL,
+// e.g. "https://www.vinted.sk/api/v2/catalog/items?..." -> "https://www.vinted.sk/api/v2/items/123".
+// Returns ErrItemNotFound if the item was deleted.
+func GetVintedItem(ctx context.Context, requestURL string, id int) (*VintedItemDetail, error) {
+	itemURL := extractHost(requestURL) + "/api/v2/items/" + strconv.Itoa(id)
+
+	var itemResp struct {
+		Item VintedItemDetail `json:"item"`
+	}
+	err := getVintedJSON(ctx, itemURL, &itemResp)
+	if errors.Is(err, errNotFound) {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &itemResp.Item, nil
+}
+
+// Thumbnails larger than this are not downloaded.
+const maxPhotoSize = 5 << 20
+
+// Downloads the photo at photoURL, e.g. the thumbnail in VintedPhoto.Url. The photos are served from
+// the CDN, so no cookies are needed.
+func GetVintedPhoto(ctx context.Context, photoURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, photoURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare request: %v", err)
 	}
 
-	result, err := cb.Execute(func() (*VintedItemsResp, error) {
-		return fetchVintedItems(req)
-	})
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %v", resp.StatusCode)
+	}
+
+	photo, err := io.ReadAll(io.LimitReader(resp.Body, maxPhotoSize+1))
 	if err != nil {
-		return nil, fmt.Errorf("circuit breaker error: %v", err)
+		return nil, fmt.Errorf("failed to read the photo: %v", err)
+	}
+	if len(photo) > maxPhotoSize {
+		return nil, fmt.Errorf("photo larger than %d bytes", maxPhotoSize)
 	}
 
-	return result, nil
+	return photo, nil
+}
+
+// Retrieves items from Vinted API based on the given parameters from vinted.Vinted structure
+// The data are json unmarshalled into VintedItemsResp structure.
+func GetVintedItems(ctx context.Context, requestURL string) (*VintedItemsResp, error) {
+	vintedResp := &VintedItemsResp{}
+	if err := getVintedJSON(ctx, requestURL, vintedResp); err != nil {
+		return nil, fmt.Errorf("circuit breaker error: %w", err)
+	}
+
+	return vintedResp, nil
 }
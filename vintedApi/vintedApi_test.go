@@ -1,9 +1,18 @@
 package vintedApi
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/smatand/vinted_go/vinted"
+	"github.com/sony/gobreaker/v2"
 )
 
 func TestConstructVintedAPIRequest(t *testing.T) {
@@ -55,3 +64,164 @@ func TestConstructVintedAPIRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestVintedItemDetailStatus(t *testing.T) {
+	tests := []struct {
+		detail VintedItemDetail
+		want   string
+	}{
+		{detail: VintedItemDetail{}, want: ItemAvailable},
+		{detail: VintedItemDetail{IsReserved: true}, want: ItemReserved},
+		{detail: VintedItemDetail{IsClosed: true, ItemClosingAction: "sold"}, want: ItemSold},
+		{detail: VintedItemDetail{IsClosed: true}, want: ItemSold},
+		{detail: VintedItemDetail{IsClosed: true, ItemClosingAction: "deleted"}, want: ItemDeleted},
+		{detail: VintedItemDetail{IsHidden: true}, want: ItemDeleted},
+	}
+
+	for _, tt := range tests {
+		if got := tt.detail.Status(); got != tt.want {
+			t.Errorf("Status() of %+v = %s, want %s", tt.detail, got, tt.want)
+		}
+	}
+}
+
+func TestFetchVintedCookiesPerHost(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: accessTokenCookieName, Value: "access"})
+		http.SetCookie(w, &http.Cookie{Name: RefreshTokenWebName, Value: "refresh"})
+	}))
+	defer working.Close()
+
+	// The failing host backs off after its first attempt
+	ctx, cancel := context.WithCancel(context.Background())
+	failed := make(chan error, 1)
+	go func() {
+		_, err := fetchVintedCookies(ctx, failing.URL, nil)
+		failed <- err
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		if c, err := fetchVintedCookies(context.Background(), working.URL, nil); err != nil || c.AccessTokenWeb != "access" {
+			t.Errorf("fetchVintedCookies() of the working host = %+v, %v", c, err)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the working host waited for the failing one")
+	}
+
+	// Cancels during the backoff, not during the request
+	for retries := 0; retries == 0; time.Sleep(time.Millisecond) {
+		cookieMu.Lock()
+		retries = cookieRetries[failing.URL]
+		cookieMu.Unlock()
+	}
+	cancel()
+	select {
+	case err := <-failed:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("fetchVintedCookies() after the cancel error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the backoff did not end with the cancel")
+	}
+}
+
+func TestGetVintedUserRefreshesCookies(t *testing.T) {
+	// The requests use the headers file in the working directory
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(headersFilePath, []byte(`[{"User-Agent": "test"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cookieFetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			cookieFetches++
+			http.SetCookie(w, &http.Cookie{Name: accessTokenCookieName, Value: "access" + strconv.Itoa(cookieFetches)})
+			http.SetCookie(w, &http.Cookie{Name: RefreshTokenWebName, Value: "refresh"})
+		case "/api/v2/users/7":
+			// The first cookie went stale
+			if cookie, err := r.Cookie(accessTokenCookieName); err != nil || cookie.Value != "access2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"user": {"id": 7, "login": "anna"}}`))
+		case "/api/v2/users/8":
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	requestURL := server.URL + "/api/v2/catalog/items"
+	user, err := GetVintedUser(context.Background(), requestURL, 7)
+	if err != nil || user.Login != "anna" {
+		t.Fatalf("GetVintedUser() = %+v, %v, want anna", user, err)
+	}
+	if cookieFetches != 2 {
+		t.Errorf("cookies fetched %d times, want 2", cookieFetches)
+	}
+
+	if _, err := GetVintedUser(context.Background(), requestURL, 8); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("GetVintedUser() of a rate limited request error = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestBreakerSharedByAllRequests(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(headersFilePath, []byte(`[{"User-Agent": "test"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := cb
+	cb = newBreaker()
+	t.Cleanup(func() { cb = saved })
+
+	itemRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			http.SetCookie(w, &http.Cookie{Name: accessTokenCookieName, Value: "access"})
+			http.SetCookie(w, &http.Cookie{Name: RefreshTokenWebName, Value: "refresh"})
+		case strings.HasPrefix(r.URL.Path, "/api/v2/items/"):
+			itemRequests++
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	requestURL := server.URL + "/api/v2/catalog/items"
+	// The removed items do not count as failures
+	for range 3 {
+		if _, err := GetVintedItem(context.Background(), requestURL, 1); !errors.Is(err, ErrItemNotFound) {
+			t.Fatalf("GetVintedItem() error = %v, want ErrItemNotFound", err)
+		}
+	}
+	if counts := cb.Counts(); counts.TotalFailures != 0 {
+		t.Errorf("breaker counts %+v, want no failures", counts)
+	}
+
+	cb = newBreaker()
+	for range 3 {
+		if _, err := GetVintedUser(context.Background(), requestURL, 7); err == nil {
+			t.Fatal("GetVintedUser() error = nil, want the status code")
+		}
+	}
+
+	// The failing profiles opened the breaker for the item details as well
+	if _, err := GetVintedItem(context.Background(), requestURL, 1); !errors.Is(err, gobreaker.ErrOpenState) {
+		t.Errorf("GetVintedItem() error = %v, want gobreaker.ErrOpenState", err)
+	}
+	if itemRequests != 3 {
+		t.Errorf("item details requested %d times, want 3", itemRequests)
+	}
+}